@@ -1,13 +1,17 @@
 package main
 
 import (
+	"cmp"
+	"context"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/jlucaspains/sharp-cert-manager/internal/handlers"
 	"github.com/jlucaspains/sharp-cert-manager/internal/jobs"
@@ -18,6 +22,10 @@ import (
 )
 
 var checkCertJob = &jobs.CheckCertJob{}
+var certMetrics = services.NewCertMetrics()
+var resultCache *services.ResultCache
+var deadLetters *jobs.DeadLetterQueue
+var alertStore *services.AlertStore
 var env string
 
 func loadEnv() {
@@ -30,7 +38,61 @@ func loadEnv() {
 	env = os.Getenv("ENV") // reload env from .env file
 }
 
-func getJobNotifier() jobs.Notifier {
+// getJobNotifier configures the notifier selected by NOTIFIER_TYPE. Webhook
+// templates are parsed so mistakes in a custom template are reported at startup.
+func getJobNotifier() (jobs.Notifier, error) {
+	if path, _ := os.LookupEnv("NOTIFICATIONS_CONFIG_FILE"); path != "" {
+		return getCompositeNotifier(path)
+	}
+
+	notifierType, _ := os.LookupEnv("NOTIFIER_TYPE")
+
+	switch notifierType {
+	case "", "webhook":
+		return getWebhookNotifier()
+	case "email":
+		return getEmailNotifier()
+	}
+
+	return nil, fmt.Errorf("invalid NOTIFIER_TYPE %s, expected webhook or email", notifierType)
+}
+
+// getCompositeNotifier sends notifications to every channel in the config
+// file. Channels without their own message settings use the MESSAGE_* ones.
+func getCompositeNotifier(path string) (jobs.Notifier, error) {
+	config, err := services.LoadNotificationsConfig(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	messageUrl, _ := os.LookupEnv("MESSAGE_URL")
+	messageTitle, _ := os.LookupEnv("MESSAGE_TITLE")
+	messageBody, _ := os.LookupEnv("MESSAGE_BODY")
+
+	for i := range config.Channels {
+		channel := &config.Channels[i]
+		channel.Title = cmp.Or(channel.Title, messageTitle)
+		channel.Body = cmp.Or(channel.Body, messageBody)
+		channel.NotificationUrl = cmp.Or(channel.NotificationUrl, messageUrl)
+	}
+
+	result, err := jobs.NewCompositeNotifier(config)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, channel := range result.Channels {
+		if webhook, ok := channel.Notifier.(*jobs.WebHookNotifier); ok {
+			webhook.SetDelivery(getRetryPolicy(), deadLetters)
+		}
+	}
+
+	return result, nil
+}
+
+func getWebhookNotifier() (jobs.Notifier, error) {
 	result := &jobs.WebHookNotifier{}
 
 	webhookType, _ := os.LookupEnv("WEBHOOK_TYPE")
@@ -40,20 +102,83 @@ func getJobNotifier() jobs.Notifier {
 	messageBody, _ := os.LookupEnv("MESSAGE_BODY")
 	messageMentions, _ := os.LookupEnv("MESSAGE_MENTIONS")
 
-	result.Init(jobs.Notifiers[webhookType], WebhookUrl, messageTitle, messageBody, messageUrl, messageMentions)
+	webhookMethod, _ := os.LookupEnv("WEBHOOK_METHOD")
+	webhookContentType, _ := os.LookupEnv("WEBHOOK_CONTENT_TYPE")
+	webhookTemplateFile, _ := os.LookupEnv("WEBHOOK_TEMPLATE_FILE")
+
+	notifierType := jobs.Notifiers[webhookType]
+	result.Init(notifierType, WebhookUrl, messageTitle, messageBody, messageUrl, messageMentions)
+	result.SetRequest(webhookMethod, getWebhookHeaders(), webhookContentType)
+	result.SetDelivery(getRetryPolicy(), deadLetters)
+	result.SetRoutingKey(os.Getenv("PAGERDUTY_ROUTING_KEY"))
+
+	if notifierType == jobs.Custom && webhookTemplateFile != "" {
+		return result, result.LoadTemplate(webhookTemplateFile)
+	}
+
+	return result, result.ParseTemplate()
+}
+
+func getEmailNotifier() (jobs.Notifier, error) {
+	result := &jobs.EmailNotifier{}
+
+	host, _ := os.LookupEnv("SMTP_HOST")
+	portConfig, _ := os.LookupEnv("SMTP_PORT")
+	username, _ := os.LookupEnv("SMTP_USERNAME")
+	password, _ := os.LookupEnv("SMTP_PASSWORD")
+	from, _ := os.LookupEnv("SMTP_FROM")
+	to, _ := os.LookupEnv("SMTP_TO")
+	tlsConfig, _ := os.LookupEnv("SMTP_TLS")
+	messageUrl, _ := os.LookupEnv("MESSAGE_URL")
+	messageTitle, _ := os.LookupEnv("MESSAGE_TITLE")
+	messageBody, _ := os.LookupEnv("MESSAGE_BODY")
+
+	tlsMode, ok := jobs.EmailTLSModes[tlsConfig]
+	if !ok {
+		return nil, fmt.Errorf("invalid SMTP_TLS %s, expected starttls, tls or none", tlsConfig)
+	}
+
+	port, _ := strconv.Atoi(portConfig)
+	result.Init(host, port, username, password, from, to, tlsMode, messageTitle, messageBody, messageUrl)
+
+	return result, nil
+}
+
+// getWebhookHeaders reads WEBHOOK_HEADERS in the format "Name: value; Name: value"
+func getWebhookHeaders() map[string]string {
+	headersConfig, _ := os.LookupEnv("WEBHOOK_HEADERS")
+	result := map[string]string{}
+
+	for _, header := range strings.Split(headersConfig, ";") {
+		name, value, ok := strings.Cut(header, ":")
+		if ok && strings.TrimSpace(name) != "" {
+			result[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		}
+	}
 
 	return result
 }
 
-func startJobs(siteList []models.CheckCertItem) {
+func startJobs(siteList *services.CertRegistry) {
 	schedule, ok := os.LookupEnv("CHECK_CERT_JOB_SCHEDULE")
 
 	if ok {
 		log.Printf("Starting job engine with cron: %s", schedule)
+		notifier, err := getJobNotifier()
+
+		if err != nil {
+			log.Fatalf("Error configuring notifications: %s", err)
+		}
+
 		level, _ := os.LookupEnv("CHECK_CERT_JOB_NOTIFICATION_LEVEL")
 		warningDays := getCertExpirationWarningDays()
-		err := checkCertJob.Init(schedule, level, warningDays, siteList, getJobNotifier())
+		err = checkCertJob.Init(schedule, level, warningDays, siteList, notifier)
 		if err == nil {
+			checkCertJob.SetChangeLevel(getChangeNotificationLevel())
+			checkCertJob.SetWorkers(getJobWorkers())
+			checkCertJob.SetMetrics(certMetrics)
+			checkCertJob.SetCache(resultCache)
+			setJobAlerts()
 			checkCertJob.Start()
 			log.Print("Job engine started")
 		} else {
@@ -64,6 +189,48 @@ func startJobs(siteList []models.CheckCertItem) {
 	}
 }
 
+// setJobAlerts enables stateful alerting when ALERTS_FILE is set
+func setJobAlerts() {
+	if alertStore != nil {
+		checkCertJob.SetAlerts(alertStore, getAlertReminder(), getEscalationDays())
+	}
+}
+
+func getAlertStore() (*services.AlertStore, error) {
+	path, ok := os.LookupEnv("ALERTS_FILE")
+	if !ok || path == "" {
+		return nil, nil
+	}
+
+	return services.NewAlertStore(path)
+}
+
+func getAlertReminder() time.Duration {
+	reminderConfig, ok := os.LookupEnv("ALERT_REMINDER_HOURS")
+	reminder, err := strconv.Atoi(reminderConfig)
+
+	if !ok || err != nil || reminder < 0 {
+		return 24 * time.Hour
+	}
+
+	return time.Duration(reminder) * time.Hour
+}
+
+// getEscalationDays reads the days before expiration at which expiring
+// certificates are notified again, e.g. 30,14,7,1
+func getEscalationDays() []int {
+	escalationConfig, _ := os.LookupEnv("ALERT_ESCALATION_DAYS")
+
+	result := []int{}
+	for _, value := range strings.Split(escalationConfig, ",") {
+		if days, err := strconv.Atoi(strings.TrimSpace(value)); err == nil && days > 0 {
+			result = append(result, days)
+		}
+	}
+
+	return result
+}
+
 func getCertExpirationWarningDays() int {
 	warningDaysConfig, _ := os.LookupEnv("CERT_WARNING_VALIDITY_DAYS")
 	warningDays, _ := strconv.Atoi(warningDaysConfig)
@@ -75,6 +242,85 @@ func getCertExpirationWarningDays() int {
 	return 30
 }
 
+func getChangeNotificationLevel() string {
+	level, _ := os.LookupEnv("CHECK_CERT_JOB_CHANGE_NOTIFICATION_LEVEL")
+
+	return level
+}
+
+func getJobWorkers() int {
+	workersConfig, _ := os.LookupEnv("CHECK_CERT_JOB_WORKERS")
+	workers, _ := strconv.Atoi(workersConfig)
+
+	return workers
+}
+
+func getCheckTimeout() time.Duration {
+	timeoutConfig, _ := os.LookupEnv("CHECK_TIMEOUT_SECONDS")
+	timeout, _ := strconv.Atoi(timeoutConfig)
+
+	return time.Duration(timeout) * time.Second
+}
+
+// getVaultPKIExpiredDays reads how many days after expiring HashiCorp Vault
+// PKI certificates are no longer listed. Zero lists all of them.
+func getVaultPKIExpiredDays() int {
+	daysConfig, _ := os.LookupEnv("VAULT_PKI_EXPIRED_DAYS")
+	days, _ := strconv.Atoi(daysConfig)
+
+	return days
+}
+
+// setAzureCredential configures the Key Vault credential when
+// AZURE_CREDENTIAL_TYPE is set. Otherwise the default credential chain is
+// created the first time Key Vault is used.
+func setAzureCredential() error {
+	credentialType, _ := os.LookupEnv("AZURE_CREDENTIAL_TYPE")
+
+	if credentialType == "" {
+		return nil
+	}
+
+	return services.SetAzureCredential(services.AzureCredentialConfig{
+		Type:                credentialType,
+		TenantID:            os.Getenv("AZURE_TENANT_ID"),
+		ClientID:            os.Getenv("AZURE_CLIENT_ID"),
+		ClientSecret:        os.Getenv("AZURE_CLIENT_SECRET"),
+		CertificatePath:     os.Getenv("AZURE_CLIENT_CERTIFICATE_PATH"),
+		CertificatePassword: os.Getenv("AZURE_CLIENT_CERTIFICATE_PASSWORD"),
+		TokenFilePath:       os.Getenv("AZURE_FEDERATED_TOKEN_FILE"),
+	})
+}
+
+// setVaultAuth configures the HashiCorp Vault token or AppRole login when
+// any of them is set. Otherwise the VAULT_TOKEN read by the Vault client is
+// used.
+func setVaultAuth() error {
+	config := services.VaultAuthConfig{
+		Token:        os.Getenv("VAULT_TOKEN"),
+		RoleID:       os.Getenv("VAULT_ROLE_ID"),
+		SecretID:     os.Getenv("VAULT_SECRET_ID"),
+		AppRoleMount: os.Getenv("VAULT_APPROLE_MOUNT"),
+	}
+
+	if config == (services.VaultAuthConfig{}) {
+		return nil
+	}
+
+	return services.SetVaultAuth(config)
+}
+
+func getResultCacheTTL() time.Duration {
+	ttlConfig, ok := os.LookupEnv("RESULT_CACHE_TTL_SECONDS")
+	ttl, err := strconv.Atoi(ttlConfig)
+
+	if !ok || err != nil || ttl < 0 {
+		return 15 * time.Minute
+	}
+
+	return time.Duration(ttl) * time.Second
+}
+
 func getCORSOrigins() string {
 	corsOrigins, ok := os.LookupEnv("CORS_ORIGINS")
 	if ok {
@@ -88,7 +334,7 @@ func stopJobs() {
 	checkCertJob.Stop()
 }
 
-func startWebServer(siteList []models.CheckCertItem) {
+func startWebServer(siteList *services.CertRegistry) {
 	headless, _ := os.LookupEnv("HEADLESS")
 
 	if headless == "true" {
@@ -98,26 +344,83 @@ func startWebServer(siteList []models.CheckCertItem) {
 
 	handlers := &handlers.Handlers{}
 	handlers.CertList = siteList
+	handlers.Metrics = certMetrics
+	handlers.Cache = resultCache
+	handlers.Job = checkCertJob
+	handlers.DeadLetters = deadLetters
+	handlers.Alerts = alertStore
 	handlers.ExpirationWarningDays = getCertExpirationWarningDays()
 	handlers.CORSOrigins = getCORSOrigins()
 
+	authConfig, err := getAuthConfig()
+
+	if err != nil {
+		log.Fatalf("Error loading auth config: %s", err)
+	}
+
+	var oidc *midlewares.OIDC
+	if authConfig.OIDC != nil {
+		if oidc, err = midlewares.NewOIDC(*authConfig.OIDC); err != nil {
+			log.Fatalf("Error configuring OIDC: %s", err)
+		}
+	}
+
+	admin := func(handler http.HandlerFunc) http.HandlerFunc {
+		return midlewares.RequireRole(models.RoleAdmin, handler)
+	}
+
+	viewer := func(handler http.HandlerFunc) http.HandlerFunc {
+		return midlewares.RequireRole(models.RoleViewer, handler)
+	}
+
 	router := http.NewServeMux()
 
-	router.HandleFunc("GET /api/check-cert", handlers.CheckStatus)
-	router.HandleFunc("GET /api/cert-list", handlers.GetCertList)
+	router.HandleFunc("GET /api/check-cert", viewer(handlers.CheckStatus))
+	router.HandleFunc("GET /api/cert-list", viewer(handlers.GetCertList))
+	router.HandleFunc("GET /api/history", viewer(handlers.GetHistory))
+	router.HandleFunc("POST /api/certs", admin(handlers.AddCert))
+	router.HandleFunc("PUT /api/certs/{name}", admin(handlers.UpdateCert))
+	router.HandleFunc("DELETE /api/certs/{name}", admin(handlers.DeleteCert))
+	router.HandleFunc("POST /api/jobs/check-cert/run", admin(handlers.RunCheckJob))
+	router.HandleFunc("GET /api/alerts", viewer(handlers.GetAlerts))
+	router.HandleFunc("POST /api/alerts/{name}/snooze", admin(handlers.SnoozeAlerts))
+	router.HandleFunc("DELETE /api/alerts/{name}/snooze", admin(handlers.UnsnoozeAlerts))
+	router.HandleFunc("GET /api/dead-letters", admin(handlers.GetDeadLetters))
+	router.HandleFunc("POST /api/dead-letters/replay", admin(handlers.ReplayDeadLetters))
+	router.HandleFunc("POST /api/dead-letters/{id}/replay", admin(handlers.ReplayDeadLetter))
 	router.HandleFunc("GET /health", handlers.HealthCheck)
+	router.HandleFunc("GET /metrics", viewer(handlers.GetMetrics))
 
 	if handlers.CORSOrigins != "" {
 		router.HandleFunc("OPTIONS /api/", handlers.CORS)
 	}
 
-	router.HandleFunc("GET /", handlers.Index)
-	router.HandleFunc("GET /item", handlers.GetItem)
-	router.HandleFunc("GET /itemDetail", handlers.GetItemDetail)
-	router.HandleFunc("GET /empty", handlers.GetEmpty)
+	router.HandleFunc("GET /", viewer(handlers.Index))
+	router.HandleFunc("GET /item", viewer(handlers.GetItem))
+	router.HandleFunc("GET /itemDetail", viewer(handlers.GetItemDetail))
+	router.HandleFunc("GET /itemHistory", viewer(handlers.GetItemHistory))
+	router.HandleFunc("GET /addTarget", admin(handlers.GetAddTarget))
+	router.HandleFunc("POST /addTarget", admin(handlers.PostAddTarget))
+	router.HandleFunc("POST /snooze", admin(handlers.PostSnooze))
+	router.HandleFunc("POST /unsnooze", admin(handlers.PostUnsnooze))
+	router.HandleFunc("GET /empty", viewer(handlers.GetEmpty))
 	router.Handle("GET /static/", http.StripPrefix("/static/", http.FileServer(http.Dir("./public/"))))
 
-	logRouter := midlewares.NewLogger(router)
+	if oidc != nil {
+		router.HandleFunc("GET /auth/login", oidc.Login)
+		router.HandleFunc("GET /auth/callback", oidc.Callback)
+		router.HandleFunc("GET /auth/logout", oidc.Logout)
+	}
+
+	if !authConfig.IsEnabled() {
+		log.Println("No AUTH_CONFIG_FILE defined, the web server does not require authentication")
+
+		if siteList.CanManage() {
+			log.Println("Warning: TARGETS_FILE is set without authentication, anyone reaching the web server can add targets")
+		}
+	}
+
+	logRouter := midlewares.NewLogger(midlewares.NewAuth(router, authConfig, oidc))
 
 	hostPort, ok := os.LookupEnv("WEB_HOST_PORT")
 	if !ok {
@@ -152,7 +455,7 @@ func startWebServer(siteList []models.CheckCertItem) {
 	log.Print("Web Server Started")
 }
 
-func runOnce(siteList []models.CheckCertItem, done chan os.Signal) {
+func runOnce(siteList *services.CertRegistry, done chan os.Signal) {
 	schedule, _ := os.LookupEnv("CHECK_CERT_JOB_SCHEDULE")
 	headless, _ := os.LookupEnv("HEADLESS")
 
@@ -161,10 +464,19 @@ func runOnce(siteList []models.CheckCertItem, done chan os.Signal) {
 	}
 
 	log.Print("Running the checkCertJob once")
+	notifier, err := getJobNotifier()
+
+	if err != nil {
+		log.Fatalf("Error configuring notifications: %s", err)
+	}
+
 	level, _ := os.LookupEnv("CHECK_CERT_JOB_NOTIFICATION_LEVEL")
 	warningDays := getCertExpirationWarningDays()
-	err := checkCertJob.Init("* * * * *", level, warningDays, siteList, getJobNotifier())
+	err = checkCertJob.Init("* * * * *", level, warningDays, siteList, notifier)
 	if err == nil {
+		checkCertJob.SetChangeLevel(getChangeNotificationLevel())
+		checkCertJob.SetWorkers(getJobWorkers())
+		setJobAlerts()
 		checkCertJob.RunNow()
 	} else {
 		log.Fatalf("Error running the checkCertJob once: %s", err)
@@ -174,21 +486,254 @@ func runOnce(siteList []models.CheckCertItem, done chan os.Signal) {
 	done <- syscall.SIGQUIT
 }
 
+func getSiteList() ([]models.CheckCertItem, error) {
+	configFile, ok := os.LookupEnv("CONFIG_FILE")
+
+	if ok && configFile != "" {
+		return services.LoadConfigCerts(configFile)
+	}
+
+	return services.GetConfigCerts(), nil
+}
+
+// reloadSiteList re-reads the .env file and the monitored targets and swaps
+// them into registry. The current list is kept when the new one is invalid.
+func reloadSiteList(registry *services.CertRegistry) error {
+	// .env is optional outside of local environment
+	godotenv.Overload()
+
+	siteList, err := getSiteList()
+
+	if err != nil {
+		return err
+	}
+
+	registry.Replace(siteList)
+	refreshSources(registry)
+	log.Printf("Reloaded %d monitored targets", len(siteList))
+
+	return nil
+}
+
+// refreshSources lists the certificates of the source targets. The
+// targets that could be listed are still monitored when another one fails.
+func refreshSources(registry *services.CertRegistry) {
+	if err := registry.Refresh(context.Background()); err != nil {
+		log.Printf("Error listing source certificates: %s", err)
+	}
+}
+
+// getConfigFileModTime returns the last modification time of CONFIG_FILE or
+// the zero time when it is not set or cannot be read.
+func getConfigFileModTime() time.Time {
+	configFile, _ := os.LookupEnv("CONFIG_FILE")
+
+	if configFile == "" {
+		return time.Time{}
+	}
+
+	info, err := os.Stat(configFile)
+
+	if err != nil {
+		return time.Time{}
+	}
+
+	return info.ModTime()
+}
+
+// watchSiteList reloads the monitored targets on SIGHUP and whenever
+// CONFIG_FILE changes on disk.
+func watchSiteList(registry *services.CertRegistry, interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	ticker := time.NewTicker(interval)
+	lastModTime := getConfigFileModTime()
+
+	go func() {
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-hup:
+				log.Print("Received SIGHUP, reloading monitored targets")
+			case <-ticker.C:
+				modTime := getConfigFileModTime()
+				if modTime.Equal(lastModTime) {
+					continue
+				}
+				log.Print("Config file changed, reloading monitored targets")
+			}
+
+			lastModTime = getConfigFileModTime()
+			if err := reloadSiteList(registry); err != nil {
+				log.Printf("Error reloading monitored targets, keeping the current list: %s", err)
+			}
+		}
+	}()
+}
+
+// getHistoryStore creates the store selected by HISTORY_STORE: file (default),
+// memory or none.
+func getHistoryStore() (services.HistoryStore, error) {
+	storeType, _ := os.LookupEnv("HISTORY_STORE")
+	maxEntriesConfig, _ := os.LookupEnv("HISTORY_MAX_ENTRIES")
+	maxEntries, _ := strconv.Atoi(maxEntriesConfig)
+
+	switch storeType {
+	case "", "file":
+		path, ok := os.LookupEnv("HISTORY_FILE")
+		if !ok || path == "" {
+			path = "history.db"
+		}
+
+		return services.NewBoltHistoryStore(path, maxEntries)
+	case "memory":
+		return services.NewMemoryHistoryStore(maxEntries), nil
+	case "none":
+		return nil, nil
+	}
+
+	return nil, fmt.Errorf("invalid HISTORY_STORE %s, expected file, memory or none", storeType)
+}
+
+// getAuthConfig reads the accepted credentials from AUTH_CONFIG_FILE. An
+// empty config disables authentication.
+func getAuthConfig() (models.AuthConfig, error) {
+	path, ok := os.LookupEnv("AUTH_CONFIG_FILE")
+
+	if !ok || path == "" {
+		return models.AuthConfig{}, nil
+	}
+
+	return services.LoadAuthConfig(path)
+}
+
+// getRetryPolicy reads how failed webhook notifications are retried
+func getRetryPolicy() jobs.RetryPolicy {
+	result := jobs.DefaultRetryPolicy
+
+	if retries, err := strconv.Atoi(os.Getenv("WEBHOOK_RETRIES")); err == nil && retries >= 0 {
+		result.Retries = retries
+	}
+
+	if delay, err := strconv.Atoi(os.Getenv("WEBHOOK_RETRY_DELAY_SECONDS")); err == nil && delay >= 0 {
+		result.BaseDelay = time.Duration(delay) * time.Second
+	}
+
+	if maxDelay, err := strconv.Atoi(os.Getenv("WEBHOOK_RETRY_MAX_DELAY_SECONDS")); err == nil && maxDelay >= 0 {
+		result.MaxDelay = time.Duration(maxDelay) * time.Second
+	}
+
+	return result
+}
+
+// getDeadLetterQueue opens the directory where notifications that could not
+// be delivered are kept. DEAD_LETTER_DIR=none disables it.
+func getDeadLetterQueue() (*jobs.DeadLetterQueue, error) {
+	dir, ok := os.LookupEnv("DEAD_LETTER_DIR")
+	if !ok || dir == "" {
+		dir = "dead-letters"
+	}
+
+	if dir == "none" {
+		return nil, nil
+	}
+
+	return jobs.NewDeadLetterQueue(dir, getRetryPolicy())
+}
+
+// getTargetStore opens the file where targets added through the API are kept.
+// Managing targets is disabled without TARGETS_FILE.
+func getTargetStore() (*services.TargetStore, error) {
+	path, ok := os.LookupEnv("TARGETS_FILE")
+	if !ok || path == "" {
+		return nil, nil
+	}
+
+	return services.NewTargetStore(path)
+}
+
+func loadTrustedCAs() error {
+	trustedCAFile, _ := os.LookupEnv("TRUSTED_CA_FILE")
+
+	return services.SetTrustedCAFile(trustedCAFile)
+}
+
 func main() {
 	loadEnv()
 
-	siteList := services.GetConfigCerts()
+	if err := loadTrustedCAs(); err != nil {
+		log.Fatalf("Error loading trusted CA file: %s", err)
+	}
+
+	tlsVersionSweep, _ := os.LookupEnv("TLS_VERSION_SWEEP")
+	services.SetTLSVersionSweep(tlsVersionSweep == "true")
+	services.SetCheckTimeout(getCheckTimeout())
+	services.SetVaultPKIExpiredDays(getVaultPKIExpiredDays())
+
+	if err := setAzureCredential(); err != nil {
+		log.Fatalf("Error configuring the Azure credential: %s", err)
+	}
+
+	if err := setVaultAuth(); err != nil {
+		log.Fatalf("Error configuring the Vault auth: %s", err)
+	}
+
+	resultCache = services.NewResultCache(getResultCacheTTL())
+
+	historyStore, err := getHistoryStore()
+
+	if err != nil {
+		log.Fatalf("Error opening history store: %s", err)
+	}
+
+	services.SetHistoryStore(historyStore)
+
+	siteList, err := getSiteList()
+
+	if err != nil {
+		log.Fatalf("Error loading monitored targets: %s", err)
+	}
+
+	registry := services.NewCertRegistry(siteList)
+
+	targetStore, err := getTargetStore()
+
+	if err != nil {
+		log.Fatalf("Error loading managed targets: %s", err)
+	}
+
+	registry.SetTargetStore(targetStore)
+	refreshSources(registry)
+
+	alertStore, err = getAlertStore()
+
+	if err != nil {
+		log.Fatalf("Error loading alert states: %s", err)
+	}
+
+	deadLetters, err = getDeadLetterQueue()
+
+	if err != nil {
+		log.Fatalf("Error opening dead letter directory: %s", err)
+	}
 
 	done := make(chan os.Signal, 1)
 	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 
-	startWebServer(siteList)
-	startJobs(siteList)
-	runOnce(siteList, done)
+	watchSiteList(registry, 10*time.Second)
+	startWebServer(registry)
+	startJobs(registry)
+	runOnce(registry, done)
 
 	<-done
 	log.Print("Stopping jobs...")
 	stopJobs()
 
+	if historyStore != nil {
+		historyStore.Close()
+	}
+
 	log.Print("All done. Bye!")
 }
@@ -2,8 +2,13 @@ package main
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/jlucaspains/sharp-cert-manager/internal/jobs"
+	"github.com/jlucaspains/sharp-cert-manager/internal/models"
+	"github.com/jlucaspains/sharp-cert-manager/internal/services"
 	"github.com/joho/godotenv"
 	"github.com/stretchr/testify/assert"
 )
@@ -17,11 +22,44 @@ func TestLoadEnv(t *testing.T) {
 
 func TestGetJobNotifier(t *testing.T) {
 	godotenv.Load("../../.test.env")
-	notifier := getJobNotifier()
+	notifier, err := getJobNotifier()
 
+	assert.Nil(t, err)
 	assert.NotNil(t, notifier)
 }
 
+func TestGetJobNotifierCustomTemplate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "incident.json.tmpl")
+	os.WriteFile(path, []byte(`{"title": {{json .Title}}}`), 0644)
+	os.Setenv("WEBHOOK_TYPE", "custom")
+	os.Setenv("WEBHOOK_TEMPLATE_FILE", path)
+	defer os.Unsetenv("WEBHOOK_TYPE")
+	defer os.Unsetenv("WEBHOOK_TEMPLATE_FILE")
+
+	_, err := getJobNotifier()
+
+	assert.Nil(t, err)
+
+	os.WriteFile(path, []byte(`{"title": {{json .Title}`), 0644)
+
+	_, err = getJobNotifier()
+
+	assert.ErrorContains(t, err, "invalid webhook template "+path)
+
+	os.Unsetenv("WEBHOOK_TEMPLATE_FILE")
+
+	_, err = getJobNotifier()
+
+	assert.Equal(t, "a template file is required for custom webhooks", err.Error())
+}
+
+func TestGetWebhookHeaders(t *testing.T) {
+	os.Setenv("WEBHOOK_HEADERS", "Authorization: Bearer abc; X-Source:sharp;invalid")
+	defer os.Unsetenv("WEBHOOK_HEADERS")
+
+	assert.Equal(t, map[string]string{"Authorization": "Bearer abc", "X-Source": "sharp"}, getWebhookHeaders())
+}
+
 func TestGetCertExpirationWarningDays(t *testing.T) {
 	godotenv.Load("../../.test.env")
 	warningDays := getCertExpirationWarningDays()
@@ -35,3 +73,372 @@ func TestGetCORSOrigins(t *testing.T) {
 
 	assert.Equal(t, "https://localhost", origins)
 }
+
+func TestLoadTrustedCAs(t *testing.T) {
+	os.Setenv("TRUSTED_CA_FILE", "")
+	defer os.Unsetenv("TRUSTED_CA_FILE")
+
+	assert.Nil(t, loadTrustedCAs())
+}
+
+func TestLoadTrustedCAsMissingFile(t *testing.T) {
+	os.Setenv("TRUSTED_CA_FILE", "missing-ca.pem")
+	defer os.Unsetenv("TRUSTED_CA_FILE")
+
+	assert.NotNil(t, loadTrustedCAs())
+}
+
+func TestGetSiteListFromEnv(t *testing.T) {
+	godotenv.Load("../../.test.env")
+	siteList, err := getSiteList()
+
+	assert.Nil(t, err)
+	assert.Len(t, siteList, 2)
+}
+
+func TestGetSiteListFromConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "targets.yaml")
+	os.WriteFile(path, []byte("targets:\n  - name: blog\n    url: https://blog.lpains.net\n"), 0644)
+	os.Setenv("CONFIG_FILE", path)
+	defer os.Unsetenv("CONFIG_FILE")
+
+	siteList, err := getSiteList()
+
+	assert.Nil(t, err)
+	assert.Len(t, siteList, 1)
+	assert.Equal(t, "blog", siteList[0].Name)
+}
+
+func TestGetSiteListInvalidConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "targets.yaml")
+	os.WriteFile(path, []byte("targets:\n  - name: blog\n"), 0644)
+	os.Setenv("CONFIG_FILE", path)
+	defer os.Unsetenv("CONFIG_FILE")
+
+	_, err := getSiteList()
+
+	assert.Contains(t, err.Error(), "targets[0].url is required")
+}
+
+func TestReloadSiteList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "targets.yaml")
+	os.WriteFile(path, []byte("targets:\n  - name: blog\n    url: https://blog.lpains.net\n"), 0644)
+	os.Setenv("CONFIG_FILE", path)
+	defer os.Unsetenv("CONFIG_FILE")
+
+	registry := services.NewCertRegistry([]models.CheckCertItem{})
+	err := reloadSiteList(registry)
+
+	assert.Nil(t, err)
+	assert.Len(t, registry.List(), 1)
+	assert.Equal(t, "blog", registry.List()[0].Name)
+}
+
+func TestReloadSiteListKeepsCurrentOnError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "targets.yaml")
+	os.WriteFile(path, []byte("targets:\n  - name: blog\n"), 0644)
+	os.Setenv("CONFIG_FILE", path)
+	defer os.Unsetenv("CONFIG_FILE")
+
+	registry := services.NewCertRegistry([]models.CheckCertItem{{Name: "current", Url: "https://current.lpains.net"}})
+	err := reloadSiteList(registry)
+
+	assert.NotNil(t, err)
+	assert.Len(t, registry.List(), 1)
+	assert.Equal(t, "current", registry.List()[0].Name)
+}
+
+func TestWatchSiteListReloadsOnFileChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "targets.yaml")
+	os.WriteFile(path, []byte("targets:\n  - name: blog\n    url: https://blog.lpains.net\n"), 0644)
+	os.Setenv("CONFIG_FILE", path)
+	defer os.Unsetenv("CONFIG_FILE")
+
+	registry := services.NewCertRegistry([]models.CheckCertItem{})
+	watchSiteList(registry, 10*time.Millisecond)
+
+	os.WriteFile(path, []byte("targets:\n  - name: blog\n    url: https://blog.lpains.net\n  - name: mail\n    url: smtp://mail.lpains.net\n"), 0644)
+	os.Chtimes(path, time.Now(), time.Now().Add(time.Minute))
+
+	assert.Eventually(t, func() bool { return len(registry.List()) == 2 }, time.Second, 10*time.Millisecond)
+}
+
+func TestGetHistoryStoreFile(t *testing.T) {
+	os.Setenv("HISTORY_FILE", filepath.Join(t.TempDir(), "history.db"))
+	defer os.Unsetenv("HISTORY_FILE")
+
+	store, err := getHistoryStore()
+
+	assert.Nil(t, err)
+	assert.IsType(t, &services.BoltHistoryStore{}, store)
+	store.Close()
+}
+
+func TestGetHistoryStoreMemory(t *testing.T) {
+	os.Setenv("HISTORY_STORE", "memory")
+	defer os.Unsetenv("HISTORY_STORE")
+
+	store, err := getHistoryStore()
+
+	assert.Nil(t, err)
+	assert.IsType(t, &services.MemoryHistoryStore{}, store)
+}
+
+func TestGetHistoryStoreInvalid(t *testing.T) {
+	os.Setenv("HISTORY_STORE", "sqlite")
+	defer os.Unsetenv("HISTORY_STORE")
+
+	_, err := getHistoryStore()
+
+	assert.Equal(t, "invalid HISTORY_STORE sqlite, expected file, memory or none", err.Error())
+}
+
+func TestGetJobWorkers(t *testing.T) {
+	os.Setenv("CHECK_CERT_JOB_WORKERS", "25")
+	defer os.Unsetenv("CHECK_CERT_JOB_WORKERS")
+
+	assert.Equal(t, 25, getJobWorkers())
+}
+
+func TestGetCheckTimeout(t *testing.T) {
+	os.Setenv("CHECK_TIMEOUT_SECONDS", "5")
+	defer os.Unsetenv("CHECK_TIMEOUT_SECONDS")
+
+	assert.Equal(t, 5*time.Second, getCheckTimeout())
+}
+
+func TestGetVaultPKIExpiredDays(t *testing.T) {
+	assert.Equal(t, 0, getVaultPKIExpiredDays())
+
+	os.Setenv("VAULT_PKI_EXPIRED_DAYS", "30")
+	defer os.Unsetenv("VAULT_PKI_EXPIRED_DAYS")
+
+	assert.Equal(t, 30, getVaultPKIExpiredDays())
+}
+
+func TestSetAzureCredential(t *testing.T) {
+	assert.Nil(t, setAzureCredential())
+
+	os.Setenv("AZURE_CREDENTIAL_TYPE", "clientsecret")
+	defer os.Unsetenv("AZURE_CREDENTIAL_TYPE")
+
+	assert.Equal(t, "the clientsecret Azure credential requires a tenant ID, client ID and client secret", setAzureCredential().Error())
+
+	os.Setenv("AZURE_TENANT_ID", "00000000-0000-0000-0000-000000000000")
+	os.Setenv("AZURE_CLIENT_ID", "11111111-1111-1111-1111-111111111111")
+	os.Setenv("AZURE_CLIENT_SECRET", "secret")
+	defer os.Unsetenv("AZURE_TENANT_ID")
+	defer os.Unsetenv("AZURE_CLIENT_ID")
+	defer os.Unsetenv("AZURE_CLIENT_SECRET")
+
+	assert.Nil(t, setAzureCredential())
+}
+
+func TestSetVaultAuth(t *testing.T) {
+	defer services.SetVaultAuth(services.VaultAuthConfig{})
+	assert.Nil(t, setVaultAuth())
+
+	os.Setenv("VAULT_ROLE_ID", "role")
+	defer os.Unsetenv("VAULT_ROLE_ID")
+
+	assert.Equal(t, "the AppRole Vault auth requires a role ID and secret ID", setVaultAuth().Error())
+
+	os.Setenv("VAULT_SECRET_ID", "secret")
+	defer os.Unsetenv("VAULT_SECRET_ID")
+
+	assert.Nil(t, setVaultAuth())
+}
+
+func TestGetResultCacheTTL(t *testing.T) {
+	assert.Equal(t, 15*time.Minute, getResultCacheTTL())
+
+	os.Setenv("RESULT_CACHE_TTL_SECONDS", "0")
+	defer os.Unsetenv("RESULT_CACHE_TTL_SECONDS")
+
+	assert.Equal(t, time.Duration(0), getResultCacheTTL())
+}
+
+func TestGetTargetStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "targets.json")
+	os.WriteFile(path, []byte(`[{"Name":"mail","Url":"smtp://mail.lpains.net:587"}]`), 0644)
+	os.Setenv("TARGETS_FILE", path)
+	defer os.Unsetenv("TARGETS_FILE")
+
+	store, err := getTargetStore()
+
+	assert.Nil(t, err)
+	assert.True(t, store.Contains("mail"))
+
+	os.Unsetenv("TARGETS_FILE")
+	store, err = getTargetStore()
+
+	assert.Nil(t, err)
+	assert.Nil(t, store)
+}
+
+func TestGetAuthConfigDisabled(t *testing.T) {
+	config, err := getAuthConfig()
+
+	assert.Nil(t, err)
+	assert.False(t, config.IsEnabled())
+}
+
+func TestGetAuthConfigFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auth.yaml")
+	os.WriteFile(path, []byte("apiKeys:\n  - name: ci\n    keyHash: 2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b\n    role: admin\n"), 0644)
+	os.Setenv("AUTH_CONFIG_FILE", path)
+	defer os.Unsetenv("AUTH_CONFIG_FILE")
+
+	config, err := getAuthConfig()
+
+	assert.Nil(t, err)
+	assert.True(t, config.IsEnabled())
+}
+
+func TestGetJobNotifierEmail(t *testing.T) {
+	os.Setenv("NOTIFIER_TYPE", "email")
+	os.Setenv("SMTP_HOST", "smtp.lpains.net")
+	os.Setenv("SMTP_FROM", "certs@lpains.net")
+	os.Setenv("SMTP_TO", "ops@lpains.net,sec@lpains.net")
+	os.Setenv("SMTP_TLS", "tls")
+	defer os.Unsetenv("NOTIFIER_TYPE")
+	defer os.Unsetenv("SMTP_HOST")
+	defer os.Unsetenv("SMTP_FROM")
+	defer os.Unsetenv("SMTP_TO")
+	defer os.Unsetenv("SMTP_TLS")
+
+	notifier, err := getJobNotifier()
+
+	assert.Nil(t, err)
+	assert.True(t, notifier.IsReady())
+	assert.Equal(t, 465, notifier.(*jobs.EmailNotifier).Port)
+	assert.Equal(t, []string{"ops@lpains.net", "sec@lpains.net"}, notifier.(*jobs.EmailNotifier).To)
+
+	os.Setenv("SMTP_TLS", "ssl")
+	_, err = getJobNotifier()
+	assert.Equal(t, "invalid SMTP_TLS ssl, expected starttls, tls or none", err.Error())
+
+	os.Setenv("NOTIFIER_TYPE", "sms")
+	_, err = getJobNotifier()
+	assert.Equal(t, "invalid NOTIFIER_TYPE sms, expected webhook or email", err.Error())
+}
+
+func TestGetJobNotifierChannels(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notifications.yaml")
+	os.WriteFile(path, []byte(`
+channels:
+  - name: ops
+    type: slack
+    url: https://hooks.slack.com/services/ops
+  - name: security
+    type: teams
+    url: https://lpains.webhook.office.com/security
+    title: Security certificates
+    rules:
+      - tags: [public]
+`), 0644)
+	os.Setenv("NOTIFICATIONS_CONFIG_FILE", path)
+	os.Setenv("MESSAGE_TITLE", "Certificate check")
+	defer os.Unsetenv("NOTIFICATIONS_CONFIG_FILE")
+	defer os.Unsetenv("MESSAGE_TITLE")
+
+	notifier, err := getJobNotifier()
+
+	assert.Nil(t, err)
+	assert.True(t, notifier.IsReady())
+
+	channels := notifier.(*jobs.CompositeNotifier).Channels
+	assert.Equal(t, "Certificate check", channels[0].Notifier.(*jobs.WebHookNotifier).NotificationTitle)
+	assert.Equal(t, "Security certificates", channels[1].Notifier.(*jobs.WebHookNotifier).NotificationTitle)
+	assert.Equal(t, []string{"public"}, channels[1].Rules[0].Tags)
+
+	os.WriteFile(path, []byte("channels: []"), 0644)
+	_, err = getJobNotifier()
+
+	assert.ErrorContains(t, err, "channels")
+}
+
+func TestGetRetryPolicy(t *testing.T) {
+	assert.Equal(t, jobs.DefaultRetryPolicy, getRetryPolicy())
+
+	os.Setenv("WEBHOOK_RETRIES", "5")
+	os.Setenv("WEBHOOK_RETRY_DELAY_SECONDS", "2")
+	os.Setenv("WEBHOOK_RETRY_MAX_DELAY_SECONDS", "-1")
+	defer os.Unsetenv("WEBHOOK_RETRIES")
+	defer os.Unsetenv("WEBHOOK_RETRY_DELAY_SECONDS")
+	defer os.Unsetenv("WEBHOOK_RETRY_MAX_DELAY_SECONDS")
+
+	assert.Equal(t, jobs.RetryPolicy{Retries: 5, BaseDelay: 2 * time.Second, MaxDelay: 30 * time.Second}, getRetryPolicy())
+}
+
+func TestGetDeadLetterQueue(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "dead-letters")
+	os.Setenv("DEAD_LETTER_DIR", dir)
+	defer os.Unsetenv("DEAD_LETTER_DIR")
+
+	queue, err := getDeadLetterQueue()
+
+	assert.Nil(t, err)
+	assert.NotNil(t, queue)
+	assert.DirExists(t, dir)
+
+	os.Setenv("DEAD_LETTER_DIR", "none")
+	queue, err = getDeadLetterQueue()
+
+	assert.Nil(t, err)
+	assert.Nil(t, queue)
+}
+
+func TestGetAlertStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "alerts.json")
+	os.Setenv("ALERTS_FILE", path)
+	defer os.Unsetenv("ALERTS_FILE")
+
+	store, err := getAlertStore()
+
+	assert.Nil(t, err)
+	assert.NotNil(t, store)
+
+	os.Unsetenv("ALERTS_FILE")
+	store, err = getAlertStore()
+
+	assert.Nil(t, err)
+	assert.Nil(t, store)
+}
+
+func TestGetAlertReminder(t *testing.T) {
+	assert.Equal(t, 24*time.Hour, getAlertReminder())
+
+	os.Setenv("ALERT_REMINDER_HOURS", "0")
+	defer os.Unsetenv("ALERT_REMINDER_HOURS")
+
+	assert.Equal(t, time.Duration(0), getAlertReminder())
+}
+
+func TestGetEscalationDays(t *testing.T) {
+	assert.Empty(t, getEscalationDays())
+
+	os.Setenv("ALERT_ESCALATION_DAYS", "60, 30,x,7,-1")
+	defer os.Unsetenv("ALERT_ESCALATION_DAYS")
+
+	assert.Equal(t, []int{60, 30, 7}, getEscalationDays())
+}
+
+func TestGetJobNotifierPagerDuty(t *testing.T) {
+	os.Setenv("WEBHOOK_TYPE", "pagerduty")
+	defer os.Unsetenv("WEBHOOK_TYPE")
+
+	notifier, err := getJobNotifier()
+
+	assert.Nil(t, err)
+	assert.False(t, notifier.IsReady())
+
+	os.Setenv("PAGERDUTY_ROUTING_KEY", "R0UT1NGK3Y")
+	defer os.Unsetenv("PAGERDUTY_ROUTING_KEY")
+
+	notifier, err = getJobNotifier()
+
+	assert.Nil(t, err)
+	assert.True(t, notifier.IsReady())
+	assert.Equal(t, "https://events.pagerduty.com/v2/enqueue", notifier.(*jobs.WebHookNotifier).WebhookUrl)
+}
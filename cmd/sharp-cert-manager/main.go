@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"net/url"
@@ -9,6 +10,7 @@ import (
 	"time"
 
 	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jlucaspains/sharp-cert-manager/internal/jobs"
 	"github.com/jlucaspains/sharp-cert-manager/internal/models"
 	"github.com/jlucaspains/sharp-cert-manager/internal/services"
 	"github.com/spf13/cobra"
@@ -18,6 +20,12 @@ var (
 	verbose             bool
 	validityDaysWarning int
 	urls                []string
+	trustedCAFile       string
+	tlsVersionSweep     bool
+	timeout             time.Duration
+	deadLetterDir       string
+	deadLetterID        string
+	replayRetries       int
 )
 
 var rootCmd = &cobra.Command{
@@ -35,12 +43,29 @@ var checkCmd = &cobra.Command{
 	RunE:  runCheck,
 }
 
+var replayCmd = &cobra.Command{
+	Use:   "replay",
+	Short: "Replay failed notifications",
+	Long: `Send the webhook notifications kept in the dead letter directory again.
+
+Delivered notifications are removed from the directory. The others are kept with the new error.`,
+	RunE: runReplay,
+}
+
 func init() {
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose logging")
 	checkCmd.Flags().IntVar(&validityDaysWarning, "warning-threshold", 90, "Number of days to trigger warning for certificate validity")
-	checkCmd.Flags().StringArrayVar(&urls, "url", []string{}, "URL of the website to check")
+	checkCmd.Flags().StringVar(&trustedCAFile, "trusted-ca-file", "", "PEM bundle of additional CAs trusted when verifying certificate chains")
+	checkCmd.Flags().BoolVar(&tlsVersionSweep, "tls-sweep", false, "Attempt each TLS protocol version and report the ones accepted by the server")
+	checkCmd.Flags().DurationVar(&timeout, "timeout", 10*time.Second, "Maximum time to check each certificate")
+	checkCmd.Flags().StringArrayVar(&urls, "url", []string{}, "URL of the website to check. smtp, imap, pop3, ftp, ldap and postgres URLs use STARTTLS")
+
+	replayCmd.Flags().StringVar(&deadLetterDir, "dir", "dead-letters", "Dead letter directory of the web server, see DEAD_LETTER_DIR")
+	replayCmd.Flags().StringVar(&deadLetterID, "id", "", "Only replay the dead letter with this id")
+	replayCmd.Flags().IntVar(&replayRetries, "retries", jobs.DefaultRetryPolicy.Retries, "Number of retries of each notification")
 
 	rootCmd.AddCommand(checkCmd)
+	rootCmd.AddCommand(replayCmd)
 }
 
 func main() {
@@ -67,6 +92,13 @@ func runCheck(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("\033[31mWarning threshold must be a non-negative integer\033[0m")
 	}
 
+	if err := services.SetTrustedCAFile(trustedCAFile); err != nil {
+		return fmt.Errorf("\033[31mInvalid trusted CA file %s: %w\033[0m", trustedCAFile, err)
+	}
+
+	services.SetTLSVersionSweep(tlsVersionSweep)
+	services.SetCheckTimeout(timeout)
+
 	logger.Debug("Starting Sharp Cert Manager...", "urls", urls, "validityDaysWarning", validityDaysWarning)
 
 	t := table.NewWriter()
@@ -75,7 +107,7 @@ func runCheck(cmd *cobra.Command, args []string) error {
 	for domain, parsedUrl := range parsedUrls {
 		logger.Debug("Checking certificate for url", "domain", domain, "url", parsedUrl)
 
-		checkStatus, err := services.CheckCertStatus(models.CheckCertItem{
+		checkStatus, err := services.CheckCertStatus(context.Background(), models.CheckCertItem{
 			Name: domain,
 			Url:  parsedUrl,
 			Type: models.CertCheckURL,
@@ -107,6 +139,43 @@ func runCheck(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+func runReplay(cmd *cobra.Command, args []string) error {
+	logger := setupLogger()
+
+	if info, err := os.Stat(deadLetterDir); err != nil || !info.IsDir() {
+		return fmt.Errorf("\033[31mDead letter directory %s not found\033[0m", deadLetterDir)
+	}
+
+	policy := jobs.DefaultRetryPolicy
+	policy.Retries = replayRetries
+
+	queue, err := jobs.NewDeadLetterQueue(deadLetterDir, policy)
+
+	if err != nil {
+		return fmt.Errorf("\033[31mInvalid dead letter directory %s: %w\033[0m", deadLetterDir, err)
+	}
+
+	if deadLetterID != "" {
+		logger.Debug("Replaying dead letter", "id", deadLetterID)
+
+		if err := queue.Replay(deadLetterID); err != nil {
+			return fmt.Errorf("\033[31mFailed to replay dead letter %s: %w\033[0m", deadLetterID, err)
+		}
+
+		fmt.Printf("Replayed dead letter %s\n", deadLetterID)
+		return nil
+	}
+
+	replayed, err := queue.ReplayAll()
+	fmt.Printf("Replayed %d dead letters\n", replayed)
+
+	if err != nil {
+		return fmt.Errorf("\033[31mFailed to replay dead letters: %w\033[0m", err)
+	}
+
+	return nil
+}
+
 func setupLogger() *slog.Logger {
 	opts := &slog.HandlerOptions{}
 
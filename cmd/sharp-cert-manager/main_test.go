@@ -1,11 +1,32 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/jlucaspains/sharp-cert-manager/internal/jobs"
 	"github.com/spf13/cobra"
 )
 
@@ -116,6 +137,152 @@ func TestRunCheck_URLWithPort(t *testing.T) {
 	}
 }
 
+func TestRunCheck_StartTLSURL(t *testing.T) {
+	dir := t.TempDir()
+	smtpCert := writeTestCert(t, dir, "smtp.test")
+	postgresCert := writeTestCert(t, dir, "postgres.test")
+
+	smtpAddress, smtpHandshakes := startFakeStartTLSServer(t, smtpCert, func(conn net.Conn, reader *bufio.Reader) error {
+		fmt.Fprint(conn, "220 smtp.test ESMTP\r\n")
+		if _, err := reader.ReadString('\n'); err != nil {
+			return err
+		}
+
+		fmt.Fprint(conn, "250-smtp.test\r\n250 STARTTLS\r\n")
+		if line, err := reader.ReadString('\n'); err != nil || line != "STARTTLS\r\n" {
+			return fmt.Errorf("unexpected command %q: %v", line, err)
+		}
+
+		_, err := fmt.Fprint(conn, "220 ready\r\n")
+		return err
+	})
+
+	postgresAddress, postgresHandshakes := startFakeStartTLSServer(t, postgresCert, func(conn net.Conn, reader *bufio.Reader) error {
+		request := make([]byte, 8)
+		if _, err := io.ReadFull(reader, request); err != nil {
+			return err
+		}
+
+		_, err := conn.Write([]byte("S"))
+		return err
+	})
+
+	urls = []string{"smtp://" + smtpAddress, "postgres://" + postgresAddress}
+	validityDaysWarning = 90
+	verbose = false
+	trustedCAFile = filepath.Join(dir, "ca.pem")
+	defer func() { trustedCAFile = "" }()
+
+	cmd := &cobra.Command{}
+	var err error
+	output := captureStdout(t, func() { err = runCheck(cmd, []string{}) })
+
+	if err != nil {
+		t.Errorf("expected no error for STARTTLS URLs, got %v", err)
+	}
+
+	for name, handshakes := range map[string]chan struct{}{"smtp": smtpHandshakes, "postgres": postgresHandshakes} {
+		select {
+		case <-handshakes:
+		case <-time.After(5 * time.Second):
+			t.Errorf("expected a TLS handshake after the %s upgrade", name)
+		}
+	}
+
+	for _, row := range [][]string{{smtpAddress, "smtp.test"}, {postgresAddress, "postgres.test"}} {
+		if !slices.ContainsFunc(strings.Split(output, "\n"), func(line string) bool {
+			return strings.Contains(line, row[0]) && strings.Contains(line, row[1]) && strings.Contains(line, "Valid") && strings.Contains(line, "Expires in")
+		}) {
+			t.Errorf("expected a valid %s certificate for %s, got\n%s", row[1], row[0], output)
+		}
+	}
+}
+
+// writeTestCert creates a self signed certificate for 127.0.0.1 and appends
+// it to ca.pem in dir so the check trusts it
+func writeTestCert(t *testing.T, dir string, commonName string) tls.Certificate {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(365 * 24 * time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, _ := os.OpenFile(filepath.Join(dir, "ca.pem"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	defer file.Close()
+	pem.Encode(file, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// startFakeStartTLSServer answers one connection with upgrade and then a TLS
+// handshake. A value is sent on the returned channel once the handshake is
+// done.
+func startFakeStartTLSServer(t *testing.T, cert tls.Certificate, upgrade func(conn net.Conn, reader *bufio.Reader) error) (string, chan struct{}) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { listener.Close() })
+
+	handshakes := make(chan struct{}, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+
+		defer conn.Close()
+
+		if err := upgrade(conn, bufio.NewReader(conn)); err != nil {
+			return
+		}
+
+		tlsConn := tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{cert}})
+		if tlsConn.Handshake() == nil {
+			handshakes <- struct{}{}
+		}
+	}()
+
+	return listener.Addr().String(), handshakes
+}
+
+// captureStdout returns what run prints to the standard output
+func captureStdout(t *testing.T, run func()) string {
+	reader, writer, err := os.Pipe()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := os.Stdout
+	os.Stdout = writer
+	defer func() { os.Stdout = stdout }()
+
+	output := make(chan string)
+	go func() {
+		var buffer bytes.Buffer
+		io.Copy(&buffer, reader)
+		output <- buffer.String()
+	}()
+
+	run()
+	writer.Close()
+
+	return <-output
+}
+
 func TestRunCheck_ZeroWarningThreshold(t *testing.T) {
 	urls = []string{"https://example.com"}
 	validityDaysWarning = 0
@@ -129,6 +296,25 @@ func TestRunCheck_ZeroWarningThreshold(t *testing.T) {
 	}
 }
 
+func TestRunCheck_InvalidTrustedCAFile(t *testing.T) {
+	urls = []string{"https://example.com"}
+	validityDaysWarning = 90
+	trustedCAFile = "missing-ca.pem"
+	verbose = false
+	defer func() { trustedCAFile = "" }()
+
+	cmd := &cobra.Command{}
+	err := runCheck(cmd, []string{})
+
+	if err == nil {
+		t.Error("expected error for missing trusted CA file, got nil")
+	}
+
+	if !strings.Contains(err.Error(), "Invalid trusted CA file") {
+		t.Errorf("expected error message about trusted CA file, got %v", err)
+	}
+}
+
 func TestInit(t *testing.T) {
 	if rootCmd == nil {
 		t.Fatal("rootCmd should not be nil")
@@ -156,6 +342,16 @@ func TestInit(t *testing.T) {
 		t.Error("expected 'warning-threshold' flag to be defined")
 	}
 
+	trustedCAFlag := checkCmd.Flags().Lookup("trusted-ca-file")
+	if trustedCAFlag == nil {
+		t.Error("expected 'trusted-ca-file' flag to be defined")
+	}
+
+	tlsSweepFlag := checkCmd.Flags().Lookup("tls-sweep")
+	if tlsSweepFlag == nil {
+		t.Error("expected 'tls-sweep' flag to be defined")
+	}
+
 	urlFlag := checkCmd.Flags().Lookup("url")
 	if urlFlag == nil {
 		t.Error("expected 'url' flag to be defined")
@@ -179,3 +375,51 @@ func TestMain_CommandStructure(t *testing.T) {
 		t.Error("expected rootCmd to have 'check' subcommand")
 	}
 }
+
+func TestRunReplay_MissingDirectory(t *testing.T) {
+	deadLetterDir = filepath.Join(t.TempDir(), "missing")
+	deadLetterID = ""
+
+	err := runReplay(&cobra.Command{}, []string{})
+
+	if err == nil || !strings.Contains(err.Error(), "Dead letter directory") {
+		t.Errorf("expected missing directory error, got %v", err)
+	}
+}
+
+func TestRunReplay(t *testing.T) {
+	delivered := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delivered++
+	}))
+	defer ts.Close()
+
+	deadLetterDir = t.TempDir()
+	replayRetries = 0
+	queue, _ := jobs.NewDeadLetterQueue(deadLetterDir, jobs.RetryPolicy{})
+	letter, _ := queue.Add(jobs.WebhookDelivery{Notifier: "Teams", Method: "POST", Url: ts.URL}, 4, errors.New("timeout"))
+	queue.Add(jobs.WebhookDelivery{Notifier: "Slack", Method: "POST", Url: ts.URL}, 4, errors.New("timeout"))
+
+	deadLetterID = letter.ID
+	if err := runReplay(&cobra.Command{}, []string{}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	deadLetterID = letter.ID
+	if err := runReplay(&cobra.Command{}, []string{}); err == nil || !strings.Contains(err.Error(), "dead letter not found") {
+		t.Errorf("expected not found error, got %v", err)
+	}
+
+	deadLetterID = ""
+	if err := runReplay(&cobra.Command{}, []string{}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if delivered != 2 {
+		t.Errorf("expected 2 deliveries, got %d", delivered)
+	}
+
+	if letters, _ := queue.List(); len(letters) != 0 {
+		t.Errorf("expected no dead letters left, got %d", len(letters))
+	}
+}
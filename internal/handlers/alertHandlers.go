@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/jlucaspains/sharp-cert-manager/internal/midlewares"
+	"github.com/jlucaspains/sharp-cert-manager/internal/models"
+	"github.com/jlucaspains/sharp-cert-manager/internal/services"
+)
+
+var errSnoozeInPast = errors.New("until should be in the future")
+
+func (h Handlers) GetAlerts(w http.ResponseWriter, r *http.Request) {
+	if !h.hasAlerts(w) {
+		return
+	}
+
+	h.JSON(w, http.StatusOK, h.Alerts.List())
+}
+
+// SnoozeAlerts acknowledges the alerts of a target so it is not notified
+// until the given time
+func (h Handlers) SnoozeAlerts(w http.ResponseWriter, r *http.Request) {
+	if !h.hasAlerts(w) {
+		return
+	}
+
+	params := models.SnoozeParams{}
+
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		h.JSON(w, http.StatusBadRequest, &models.ErrorResult{Errors: []string{"invalid request body"}})
+		return
+	}
+
+	state, err := h.snooze(r, r.PathValue("name"), params)
+
+	if err != nil {
+		h.writeSnoozeError(w, err)
+		return
+	}
+
+	h.JSON(w, http.StatusOK, state)
+}
+
+func (h Handlers) UnsnoozeAlerts(w http.ResponseWriter, r *http.Request) {
+	if !h.hasAlerts(w) {
+		return
+	}
+
+	if err := h.unsnooze(r.PathValue("name")); err != nil {
+		h.writeSnoozeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h Handlers) snooze(r *http.Request, name string, params models.SnoozeParams) (models.AlertState, error) {
+	if _, ok := h.CertList.Find(name); !ok {
+		return models.AlertState{}, services.ErrTargetNotFound
+	}
+
+	if !params.Until.After(time.Now()) {
+		return models.AlertState{}, errSnoozeInPast
+	}
+
+	principal, _ := midlewares.GetPrincipal(r.Context())
+
+	return h.Alerts.Snooze(name, params.Until, principal.Name, params.Comment)
+}
+
+func (h Handlers) unsnooze(name string) error {
+	if _, ok := h.CertList.Find(name); !ok {
+		return services.ErrTargetNotFound
+	}
+
+	return h.Alerts.Unsnooze(name)
+}
+
+func (h Handlers) writeSnoozeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrTargetNotFound):
+		h.JSON(w, http.StatusNotFound, &models.ErrorResult{Errors: []string{err.Error()}})
+	case errors.Is(err, errSnoozeInPast):
+		h.JSON(w, http.StatusBadRequest, &models.ErrorResult{Errors: []string{err.Error()}})
+	default:
+		log.Printf("Error saving alerts: %s", err)
+		h.JSON(w, http.StatusInternalServerError, &models.ErrorResult{Errors: []string{"failed to save alerts"}})
+	}
+}
+
+func (h Handlers) hasAlerts(w http.ResponseWriter) bool {
+	if h.Alerts == nil {
+		h.JSON(w, http.StatusNotImplemented, &models.ErrorResult{Errors: []string{"alerting is not enabled"}})
+		return false
+	}
+
+	return true
+}
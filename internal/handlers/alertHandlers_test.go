@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jlucaspains/sharp-cert-manager/internal/midlewares"
+	"github.com/jlucaspains/sharp-cert-manager/internal/models"
+	"github.com/jlucaspains/sharp-cert-manager/internal/services"
+	"github.com/stretchr/testify/assert"
+)
+
+func newAlertRouter(t *testing.T) (http.Handler, *Handlers) {
+	handlers := new(Handlers)
+	handlers.CertList = services.NewCertRegistry([]models.CheckCertItem{
+		{Name: "blog.lpains.net", Url: "https://blog.lpains.net", Type: models.CertCheckURL},
+	})
+	handlers.Alerts, _ = services.NewAlertStore(filepath.Join(t.TempDir(), "alerts.json"))
+
+	router := http.NewServeMux()
+	router.HandleFunc("GET /api/alerts", handlers.GetAlerts)
+	router.HandleFunc("POST /api/alerts/{name}/snooze", handlers.SnoozeAlerts)
+	router.HandleFunc("DELETE /api/alerts/{name}/snooze", handlers.UnsnoozeAlerts)
+
+	return midlewares.NewAuth(router, models.AuthConfig{}, nil), handlers
+}
+
+func TestSnoozeAlerts(t *testing.T) {
+	router, handlers := newAlertRouter(t)
+	until := time.Now().Add(48 * time.Hour).UTC().Truncate(time.Second)
+
+	code, body, _, _, err := makeRequest[models.AlertState](router, "POST", "/api/alerts/blog.lpains.net/snooze", models.SnoozeParams{Until: until, Comment: "renewal scheduled"})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 200, code)
+	assert.Equal(t, until, *body.SnoozedUntil)
+	assert.Equal(t, "anonymous", body.SnoozedBy)
+	assert.Equal(t, "renewal scheduled", body.Comment)
+
+	code, list, _, _, err := makeRequest[[]models.AlertState](router, "GET", "/api/alerts", nil)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 200, code)
+	assert.Equal(t, "blog.lpains.net", (*list)[0].Name)
+
+	code, _, _, _, _ = makeRequest[string](router, "DELETE", "/api/alerts/blog.lpains.net/snooze", nil)
+
+	assert.Equal(t, 204, code)
+	assert.Nil(t, handlers.Alerts.Get("blog.lpains.net").SnoozedUntil)
+}
+
+func TestSnoozeAlertsInvalid(t *testing.T) {
+	router, _ := newAlertRouter(t)
+
+	code, body, _, _, err := makeRequest[models.ErrorResult](router, "POST", "/api/alerts/blog.lpains.net/snooze", models.SnoozeParams{Until: time.Now().Add(-time.Hour)})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 400, code)
+	assert.Equal(t, []string{"until should be in the future"}, body.Errors)
+
+	code, body, _, _, err = makeRequest[models.ErrorResult](router, "POST", "/api/alerts/mail/snooze", models.SnoozeParams{Until: time.Now().Add(time.Hour)})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 404, code)
+	assert.Equal(t, []string{"the provided cert name is not configured"}, body.Errors)
+
+	code, _, _, _, _ = makeRequest[string](router, "DELETE", "/api/alerts/mail/snooze", nil)
+
+	assert.Equal(t, 404, code)
+}
+
+func TestAlertsNotEnabled(t *testing.T) {
+	handlers := new(Handlers)
+
+	router := http.NewServeMux()
+	router.HandleFunc("GET /api/alerts", handlers.GetAlerts)
+
+	code, body, _, _, err := makeRequest[models.ErrorResult](router, "GET", "/api/alerts", nil)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 501, code)
+	assert.Equal(t, []string{"alerting is not enabled"}, body.Errors)
+}
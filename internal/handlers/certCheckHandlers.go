@@ -1,16 +1,17 @@
 package handlers
 
 import (
+	"errors"
 	"log"
 	"net/http"
-	"slices"
+	"strconv"
 
 	"github.com/jlucaspains/sharp-cert-manager/internal/models"
 	"github.com/jlucaspains/sharp-cert-manager/internal/services"
 )
 
 func (h Handlers) GetCertList(w http.ResponseWriter, r *http.Request) {
-	result := h.CertList
+	result := h.CertList.List()
 
 	h.JSON(w, http.StatusOK, result)
 }
@@ -25,15 +26,14 @@ func (h Handlers) CheckStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	idx := slices.IndexFunc(h.CertList, func(c models.CheckCertItem) bool { return c.Name == name })
+	item, ok := h.CertList.Find(name)
 
-	if idx < 0 {
+	if !ok {
 		h.JSON(w, http.StatusBadRequest, &models.ErrorResult{Errors: []string{"the provided cert name is not configured"}})
 		return
 	}
 
-	item := h.CertList[idx]
-	result, err := services.CheckCertStatus(item, h.ExpirationWarningDays)
+	result, err := h.Cache.CheckCertStatus(r.Context(), item, h.ExpirationWarningDays, h.isRefresh(r))
 
 	if err != nil {
 		h.JSON(w, http.StatusBadRequest, &models.ErrorResult{Errors: []string{err.Error()}})
@@ -42,3 +42,58 @@ func (h Handlers) CheckStatus(w http.ResponseWriter, r *http.Request) {
 
 	h.JSON(w, http.StatusOK, result)
 }
+
+func (h Handlers) GetHistory(w http.ResponseWriter, r *http.Request) {
+	name, _ := h.getQueryParam(r, "name")
+
+	if name == "" {
+		h.JSON(w, http.StatusBadRequest, &models.ErrorResult{Errors: []string{"name is required"}})
+		return
+	}
+
+	limit, err := h.getHistoryLimit(r)
+
+	if err != nil {
+		h.JSON(w, http.StatusBadRequest, &models.ErrorResult{Errors: []string{err.Error()}})
+		return
+	}
+
+	result, err := services.GetCertHistory(name, limit)
+
+	if err != nil {
+		log.Printf("Error reading history for %s: %s", name, err)
+		h.JSON(w, http.StatusInternalServerError, &models.ErrorResult{Errors: []string{"failed to read history"}})
+		return
+	}
+
+	h.JSON(w, http.StatusOK, result)
+}
+
+// getHistoryLimit reads the optional limit query param, 100 by default
+func (h Handlers) getHistoryLimit(r *http.Request) (int, error) {
+	rawLimit, _ := h.getQueryParam(r, "limit")
+
+	if rawLimit == "" {
+		return 100, nil
+	}
+
+	limit, err := strconv.Atoi(rawLimit)
+
+	if err != nil || limit <= 0 || limit > 1000 {
+		return 0, errors.New("limit should be between 1 and 1000")
+	}
+
+	return limit, nil
+}
+
+// RunCheckJob starts a run of the scheduled check job in the background
+func (h Handlers) RunCheckJob(w http.ResponseWriter, r *http.Request) {
+	if !h.Job.IsRunning() {
+		h.JSON(w, http.StatusNotImplemented, &models.ErrorResult{Errors: []string{"the check job is not scheduled"}})
+		return
+	}
+
+	go h.Job.RunNow()
+
+	w.WriteHeader(http.StatusAccepted)
+}
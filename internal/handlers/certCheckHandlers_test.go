@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/jlucaspains/sharp-cert-manager/internal/models"
+	"github.com/jlucaspains/sharp-cert-manager/internal/services"
 	"github.com/joho/godotenv"
 	"github.com/stretchr/testify/assert"
 )
@@ -18,7 +19,7 @@ var certList = []models.CheckCertItem{
 func TestGetCertList(t *testing.T) {
 	godotenv.Load("../.test.env")
 	handlers := new(Handlers)
-	handlers.CertList = certList
+	handlers.CertList = services.NewCertRegistry(certList)
 
 	router := http.NewServeMux()
 	router.HandleFunc("GET /cert-list", handlers.GetCertList)
@@ -32,7 +33,7 @@ func TestGetCertList(t *testing.T) {
 
 func TestGetCheckStatus(t *testing.T) {
 	handlers := new(Handlers)
-	handlers.CertList = certList
+	handlers.CertList = services.NewCertRegistry(certList)
 
 	router := http.NewServeMux()
 	router.HandleFunc("GET /check-cert", handlers.CheckStatus)
@@ -51,7 +52,7 @@ func TestGetCheckStatus(t *testing.T) {
 
 func TestGetCheckStatusNoName(t *testing.T) {
 	handlers := new(Handlers)
-	handlers.CertList = certList
+	handlers.CertList = services.NewCertRegistry(certList)
 
 	router := http.NewServeMux()
 	router.HandleFunc("GET /check-cert", handlers.CheckStatus)
@@ -65,7 +66,7 @@ func TestGetCheckStatusNoName(t *testing.T) {
 
 func TestGetCheckStatusInvalidName(t *testing.T) {
 	handlers := new(Handlers)
-	handlers.CertList = certList
+	handlers.CertList = services.NewCertRegistry(certList)
 
 	router := http.NewServeMux()
 	router.HandleFunc("GET /check-cert", handlers.CheckStatus)
@@ -76,3 +77,79 @@ func TestGetCheckStatusInvalidName(t *testing.T) {
 	assert.Equal(t, 400, code)
 	assert.Equal(t, "the provided cert name is not configured", body.Errors[0])
 }
+
+func TestGetHistory(t *testing.T) {
+	store := services.NewMemoryHistoryStore(10)
+	store.Record(models.CertHistoryEntry{Name: "blog.lpains.net", Result: models.CertCheckResult{Hostname: "blog.lpains.net", IsValid: true}})
+	services.SetHistoryStore(store)
+	defer services.SetHistoryStore(nil)
+
+	handlers := new(Handlers)
+	router := http.NewServeMux()
+	router.HandleFunc("GET /api/history", handlers.GetHistory)
+
+	code, body, _, _, err := makeRequest[[]models.CertHistoryEntry](router, "GET", "/api/history?name=blog.lpains.net", nil)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 200, code)
+	assert.Len(t, *body, 1)
+	assert.True(t, (*body)[0].Result.IsValid)
+}
+
+func TestGetHistoryNoName(t *testing.T) {
+	handlers := new(Handlers)
+	router := http.NewServeMux()
+	router.HandleFunc("GET /api/history", handlers.GetHistory)
+
+	code, body, _, _, err := makeRequest[models.ErrorResult](router, "GET", "/api/history", nil)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 400, code)
+	assert.Equal(t, "name is required", body.Errors[0])
+}
+
+func TestGetHistoryBadLimit(t *testing.T) {
+	handlers := new(Handlers)
+	router := http.NewServeMux()
+	router.HandleFunc("GET /api/history", handlers.GetHistory)
+
+	code, body, _, _, err := makeRequest[models.ErrorResult](router, "GET", "/api/history?name=blog.lpains.net&limit=0", nil)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 400, code)
+	assert.Equal(t, "limit should be between 1 and 1000", body.Errors[0])
+}
+
+func TestGetCheckStatusFromCache(t *testing.T) {
+	item := models.CheckCertItem{Name: "blo.lpains.net", Url: "https://blo.lpains.net", Type: models.CertCheckURL}
+	handlers := new(Handlers)
+	handlers.CertList = services.NewCertRegistry([]models.CheckCertItem{item})
+	handlers.Cache = services.NewResultCache(time.Minute)
+	handlers.Cache.Set(item, &models.CertCheckResult{Hostname: "blo.lpains.net", IsValid: true, CheckedAt: time.Now()})
+
+	router := http.NewServeMux()
+	router.HandleFunc("GET /api/check-cert", handlers.CheckStatus)
+
+	code, body, _, _, err := makeRequest[models.CertCheckResult](router, "GET", "/api/check-cert?name=blo.lpains.net", nil)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 200, code)
+	assert.True(t, body.IsValid)
+
+	code, _, _, _, _ = makeRequest[models.ErrorResult](router, "GET", "/api/check-cert?name=blo.lpains.net&refresh=true", nil)
+
+	assert.Equal(t, 400, code)
+}
+
+func TestRunCheckJobNotScheduled(t *testing.T) {
+	handlers := new(Handlers)
+
+	router := http.NewServeMux()
+	router.HandleFunc("POST /api/jobs/check-cert/run", handlers.RunCheckJob)
+
+	code, body, _, _, err := makeRequest[models.ErrorResult](router, "POST", "/api/jobs/check-cert/run", nil)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 501, code)
+	assert.Equal(t, []string{"the check job is not scheduled"}, body.Errors)
+}
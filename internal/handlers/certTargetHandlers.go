@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/jlucaspains/sharp-cert-manager/internal/models"
+	"github.com/jlucaspains/sharp-cert-manager/internal/services"
+)
+
+// validate reports fields by their json name so errors match the payload
+var validate = services.NewValidator("json")
+
+func (h Handlers) AddCert(w http.ResponseWriter, r *http.Request) {
+	item, ok := h.readCertTarget(w, r)
+
+	if !ok {
+		return
+	}
+
+	if err := h.CertList.Add(item); err != nil {
+		h.writeTargetError(w, err)
+		return
+	}
+
+	h.refreshSource(r, item)
+	h.JSON(w, http.StatusCreated, item)
+}
+
+func (h Handlers) UpdateCert(w http.ResponseWriter, r *http.Request) {
+	item, ok := h.readCertTarget(w, r)
+
+	if !ok {
+		return
+	}
+
+	if err := h.CertList.Update(r.PathValue("name"), item); err != nil {
+		h.writeTargetError(w, err)
+		return
+	}
+
+	h.refreshSource(r, item)
+	h.JSON(w, http.StatusOK, item)
+}
+
+// refreshSource lists the certificates of a source target right away so
+// they are monitored without waiting for the next job run
+func (h Handlers) refreshSource(r *http.Request, item models.CheckCertItem) {
+	if !services.IsCertSource(item) {
+		return
+	}
+
+	if err := h.CertList.Refresh(r.Context()); err != nil {
+		log.Printf("Error listing source certificates: %s", err)
+	}
+}
+
+func (h Handlers) DeleteCert(w http.ResponseWriter, r *http.Request) {
+	if err := h.CertList.Delete(r.PathValue("name")); err != nil {
+		h.writeTargetError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h Handlers) readCertTarget(w http.ResponseWriter, r *http.Request) (models.CheckCertItem, bool) {
+	params := models.CertTargetParams{}
+
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		h.JSON(w, http.StatusBadRequest, &models.ErrorResult{Errors: []string{"invalid request body"}})
+		return models.CheckCertItem{}, false
+	}
+
+	item, err := getCertTarget(params)
+
+	if err != nil {
+		status, result := h.ErrorToHttpResult(err)
+		h.JSON(w, status, result)
+		return models.CheckCertItem{}, false
+	}
+
+	return item, true
+}
+
+// getCertTarget validates params and converts them to a monitored item
+func getCertTarget(params models.CertTargetParams) (models.CheckCertItem, error) {
+	if err := validate.Struct(params); err != nil {
+		return models.CheckCertItem{}, err
+	}
+
+	item, err := services.GetCheckCertItem(params)
+
+	if err != nil {
+		return models.CheckCertItem{}, &targetValidationError{err}
+	}
+
+	return item, nil
+}
+
+type targetValidationError struct {
+	error
+}
+
+func (h Handlers) writeTargetError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrTargetNotFound):
+		h.JSON(w, http.StatusNotFound, &models.ErrorResult{Errors: []string{err.Error()}})
+	case errors.Is(err, services.ErrTargetExists), errors.Is(err, services.ErrTargetReadOnly):
+		h.JSON(w, http.StatusConflict, &models.ErrorResult{Errors: []string{err.Error()}})
+	case errors.Is(err, services.ErrNoTargetStore):
+		h.JSON(w, http.StatusNotImplemented, &models.ErrorResult{Errors: []string{err.Error()}})
+	default:
+		log.Printf("Error saving targets: %s", err)
+		h.JSON(w, http.StatusInternalServerError, &models.ErrorResult{Errors: []string{"failed to save targets"}})
+	}
+}
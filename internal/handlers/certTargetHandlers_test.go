@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jlucaspains/sharp-cert-manager/internal/models"
+	"github.com/jlucaspains/sharp-cert-manager/internal/services"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTargetRouter(t *testing.T, withStore bool) (*http.ServeMux, *Handlers) {
+	handlers := new(Handlers)
+	handlers.CertList = services.NewCertRegistry([]models.CheckCertItem{
+		{Name: "blog.lpains.net", Url: "https://blog.lpains.net", Type: models.CertCheckURL},
+	})
+
+	if withStore {
+		store, _ := services.NewTargetStore(filepath.Join(t.TempDir(), "targets.json"))
+		handlers.CertList.SetTargetStore(store)
+	}
+
+	router := http.NewServeMux()
+	router.HandleFunc("POST /api/certs", handlers.AddCert)
+	router.HandleFunc("PUT /api/certs/{name}", handlers.UpdateCert)
+	router.HandleFunc("DELETE /api/certs/{name}", handlers.DeleteCert)
+	router.HandleFunc("POST /addTarget", handlers.PostAddTarget)
+
+	return router, handlers
+}
+
+func TestAddCert(t *testing.T) {
+	router, handlers := newTargetRouter(t, true)
+
+	code, body, _, _, err := makeRequest[models.CheckCertItem](router, "POST", "/api/certs", models.CertTargetParams{
+		Name: "mail", Url: "smtp://mail.lpains.net:587", Tags: []string{"mail"},
+	})
+
+	item, ok := handlers.CertList.Find("mail")
+
+	assert.Nil(t, err)
+	assert.Equal(t, 201, code)
+	assert.Equal(t, "mail", body.Name)
+	assert.True(t, ok)
+	assert.Equal(t, models.CertCheckURL, item.Type)
+	assert.Equal(t, []string{"mail"}, item.Tags)
+}
+
+func TestAddCertInvalid(t *testing.T) {
+	router, _ := newTargetRouter(t, true)
+
+	code, body, _, _, err := makeRequest[models.ErrorResult](router, "POST", "/api/certs", models.CertTargetParams{
+		Type: "gcp", Url: "not a url", WarningDays: -1,
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 400, code)
+	assert.Equal(t, []string{
+		"name is required",
+		"type should be one of: url azure aws vault",
+		"url should be a valid URL",
+		"warningDays should be greater than or equal to 0",
+	}, body.Errors)
+}
+
+func TestAddCertInvalidAzureUrl(t *testing.T) {
+	router, _ := newTargetRouter(t, true)
+
+	code, body, _, _, err := makeRequest[models.ErrorResult](router, "POST", "/api/certs", models.CertTargetParams{
+		Name: "vault", Type: "azure", Url: "https://vault.vault.azure.net/keys/key",
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 400, code)
+	assert.Equal(t, []string{"url should be an Azure Key Vault or certificate URL"}, body.Errors)
+}
+
+func TestAddCertInvalidBody(t *testing.T) {
+	router, _ := newTargetRouter(t, true)
+
+	code, body, _, _, err := makeRequest[models.ErrorResult](router, "POST", "/api/certs", "name")
+
+	assert.Nil(t, err)
+	assert.Equal(t, 400, code)
+	assert.Equal(t, []string{"invalid request body"}, body.Errors)
+}
+
+func TestAddCertExisting(t *testing.T) {
+	router, _ := newTargetRouter(t, true)
+
+	code, body, _, _, err := makeRequest[models.ErrorResult](router, "POST", "/api/certs", models.CertTargetParams{
+		Name: "blog.lpains.net", Url: "https://blog.lpains.net",
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 409, code)
+	assert.Equal(t, []string{"a target with the same name already exists"}, body.Errors)
+}
+
+func TestAddCertWithoutStore(t *testing.T) {
+	router, _ := newTargetRouter(t, false)
+
+	code, body, _, _, err := makeRequest[models.ErrorResult](router, "POST", "/api/certs", models.CertTargetParams{
+		Name: "mail", Url: "smtp://mail.lpains.net:587",
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 501, code)
+	assert.Equal(t, []string{"target management is not enabled"}, body.Errors)
+}
+
+func TestUpdateCert(t *testing.T) {
+	router, handlers := newTargetRouter(t, true)
+	makeRequest[models.CheckCertItem](router, "POST", "/api/certs", models.CertTargetParams{Name: "mail", Url: "smtp://mail.lpains.net:587"})
+
+	code, _, _, _, err := makeRequest[models.CheckCertItem](router, "PUT", "/api/certs/mail", models.CertTargetParams{
+		Name: "mail", Url: "smtp://mail.lpains.net:25", WarningDays: 10,
+	})
+
+	item, _ := handlers.CertList.Find("mail")
+
+	assert.Nil(t, err)
+	assert.Equal(t, 200, code)
+	assert.Equal(t, "smtp://mail.lpains.net:25", item.Url)
+	assert.Equal(t, 10, item.WarningDays)
+}
+
+func TestUpdateCertConfigured(t *testing.T) {
+	router, _ := newTargetRouter(t, true)
+
+	code, body, _, _, err := makeRequest[models.ErrorResult](router, "PUT", "/api/certs/blog.lpains.net", models.CertTargetParams{
+		Name: "blog.lpains.net", Url: "https://blog.lpains.net",
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 409, code)
+	assert.Equal(t, []string{"the target is defined in the configuration and cannot be changed"}, body.Errors)
+}
+
+func TestDeleteCert(t *testing.T) {
+	router, handlers := newTargetRouter(t, true)
+	makeRequest[models.CheckCertItem](router, "POST", "/api/certs", models.CertTargetParams{Name: "mail", Url: "smtp://mail.lpains.net:587"})
+
+	code, _, _, _, _ := makeRequest[string](router, "DELETE", "/api/certs/mail", nil)
+	_, ok := handlers.CertList.Find("mail")
+
+	assert.Equal(t, 204, code)
+	assert.False(t, ok)
+}
+
+func TestDeleteCertNotFound(t *testing.T) {
+	router, _ := newTargetRouter(t, true)
+
+	code, body, _, _, err := makeRequest[models.ErrorResult](router, "DELETE", "/api/certs/mail", nil)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 404, code)
+	assert.Equal(t, []string{"the provided cert name is not configured"}, body.Errors)
+}
+
+func postForm(router http.Handler, path string, values url.Values) (int, string) {
+	req, _ := http.NewRequest("POST", path, strings.NewReader(values.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	return rr.Code, rr.Body.String()
+}
+
+func TestPostAddTarget(t *testing.T) {
+	templatePath = "../../frontend"
+	router, handlers := newTargetRouter(t, true)
+
+	code, body := postForm(router, "/addTarget", url.Values{
+		"name": {"mail"}, "type": {"url"}, "url": {"smtp://mail.lpains.net:587"}, "tags": {"mail, internal ,"}, "warningDays": {"15"},
+	})
+
+	item, ok := handlers.CertList.Find("mail")
+
+	assert.Equal(t, 200, code)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"mail", "internal"}, item.Tags)
+	assert.Equal(t, 15, item.WarningDays)
+	assert.Contains(t, body, "hx-swap-oob=\"beforeend:#cert-grid\"")
+	assert.Contains(t, body, "hx-get=\"/item?name=mail\"")
+}
+
+func TestPostAddTargetInvalid(t *testing.T) {
+	templatePath = "../../frontend"
+	router, handlers := newTargetRouter(t, true)
+
+	code, body := postForm(router, "/addTarget", url.Values{"name": {"blog.lpains.net"}, "url": {"https://blog.lpains.net"}})
+
+	assert.Equal(t, 200, code)
+	assert.Contains(t, body, "data-testid=\"form-errors\"")
+	assert.Contains(t, body, "a target with the same name already exists")
+	assert.Contains(t, body, "value=\"blog.lpains.net\"")
+
+	code, body = postForm(router, "/addTarget", url.Values{"name": {"mail"}, "url": {"invalid"}})
+
+	assert.Equal(t, 200, code)
+	assert.Contains(t, body, "url should be a valid URL")
+	assert.Len(t, handlers.CertList.List(), 1)
+}
@@ -28,7 +28,7 @@ func TestCORSCheckURL(t *testing.T) {
 func TestCORSGetSiteList(t *testing.T) {
 	godotenv.Load("../../.test.env")
 	handlers := new(Handlers)
-	handlers.CertList = services.GetConfigCerts()
+	handlers.CertList = services.NewCertRegistry(services.GetConfigCerts())
 	handlers.CORSOrigins = "http://localhost:5173"
 
 	router := http.NewServeMux()
@@ -45,7 +45,7 @@ func TestCORSGetSiteList(t *testing.T) {
 func TestNoCORSGetSiteList(t *testing.T) {
 	godotenv.Load("../.test.env")
 	handlers := new(Handlers)
-	handlers.CertList = services.GetConfigCerts()
+	handlers.CertList = services.NewCertRegistry(services.GetConfigCerts())
 
 	router := http.NewServeMux()
 	router.HandleFunc("GET /cert-list", handlers.GetCertList)
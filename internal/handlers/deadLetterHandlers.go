@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/jlucaspains/sharp-cert-manager/internal/jobs"
+	"github.com/jlucaspains/sharp-cert-manager/internal/models"
+)
+
+func (h Handlers) GetDeadLetters(w http.ResponseWriter, r *http.Request) {
+	if !h.hasDeadLetters(w) {
+		return
+	}
+
+	letters, err := h.DeadLetters.List()
+
+	if err != nil {
+		log.Printf("Error reading dead letters: %s", err)
+		h.JSON(w, http.StatusInternalServerError, &models.ErrorResult{Errors: []string{"failed to read dead letters"}})
+		return
+	}
+
+	result := []models.DeadLetterResult{}
+	for _, letter := range letters {
+		result = append(result, getDeadLetterResult(letter))
+	}
+
+	h.JSON(w, http.StatusOK, result)
+}
+
+// getDeadLetterResult keeps the webhook secrets on disk for replays and only
+// tells where the notification was going
+func getDeadLetterResult(letter jobs.DeadLetter) models.DeadLetterResult {
+	host := ""
+	if parsedUrl, err := url.Parse(letter.Url); err == nil {
+		host = parsedUrl.Host
+	}
+
+	return models.DeadLetterResult{
+		ID:        letter.ID,
+		Notifier:  letter.Notifier,
+		Host:      host,
+		Error:     strings.ReplaceAll(letter.Error, letter.Url, host),
+		Attempts:  letter.Attempts,
+		CreatedAt: letter.CreatedAt,
+	}
+}
+
+// ReplayDeadLetter sends a failed notification again and removes it once
+// delivered
+func (h Handlers) ReplayDeadLetter(w http.ResponseWriter, r *http.Request) {
+	if !h.hasDeadLetters(w) {
+		return
+	}
+
+	err := h.DeadLetters.Replay(r.PathValue("id"))
+
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, jobs.ErrDeadLetterNotFound):
+		h.JSON(w, http.StatusNotFound, &models.ErrorResult{Errors: []string{err.Error()}})
+	case errors.Is(err, jobs.ErrDeadLetterReplaying):
+		h.JSON(w, http.StatusConflict, &models.ErrorResult{Errors: []string{err.Error()}})
+	default:
+		h.JSON(w, http.StatusBadGateway, &models.ErrorResult{Errors: []string{err.Error()}})
+	}
+}
+
+func (h Handlers) ReplayDeadLetters(w http.ResponseWriter, r *http.Request) {
+	if !h.hasDeadLetters(w) {
+		return
+	}
+
+	replayed, err := h.DeadLetters.ReplayAll()
+	result := models.ReplayResult{Replayed: replayed, Errors: []string{}}
+
+	// every failed letter is on its own line of the joined error
+	if err != nil {
+		result.Errors = strings.Split(err.Error(), "\n")
+	}
+
+	h.JSON(w, http.StatusOK, result)
+}
+
+func (h Handlers) hasDeadLetters(w http.ResponseWriter) bool {
+	if h.DeadLetters == nil {
+		h.JSON(w, http.StatusNotImplemented, &models.ErrorResult{Errors: []string{"dead letters are not enabled"}})
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jlucaspains/sharp-cert-manager/internal/jobs"
+	"github.com/jlucaspains/sharp-cert-manager/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func newDeadLetterRouter(t *testing.T) (*http.ServeMux, *jobs.DeadLetterQueue) {
+	handlers := new(Handlers)
+	handlers.DeadLetters, _ = jobs.NewDeadLetterQueue(t.TempDir(), jobs.RetryPolicy{})
+
+	router := http.NewServeMux()
+	router.HandleFunc("GET /api/dead-letters", handlers.GetDeadLetters)
+	router.HandleFunc("POST /api/dead-letters/replay", handlers.ReplayDeadLetters)
+	router.HandleFunc("POST /api/dead-letters/{id}/replay", handlers.ReplayDeadLetter)
+
+	return router, handlers.DeadLetters
+}
+
+func TestGetDeadLetters(t *testing.T) {
+	router, queue := newDeadLetterRouter(t)
+	delivery := jobs.WebhookDelivery{
+		Notifier: "Teams",
+		Method:   "POST",
+		Url:      "https://lpains.net/hook/s3cr3t",
+		Headers:  map[string]string{"Authorization": "Bearer abc"},
+		Body:     `{"routing_key": "R0UT1NGK3Y"}`,
+	}
+	letter, _ := queue.Add(delivery, 4, errors.New(`Post "https://lpains.net/hook/s3cr3t": EOF`))
+
+	code, body, bodyString, _, err := makeRequest[[]models.DeadLetterResult](router, "GET", "/api/dead-letters", nil)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 200, code)
+	assert.Equal(t, letter.ID, (*body)[0].ID)
+	assert.Equal(t, "Teams", (*body)[0].Notifier)
+	assert.Equal(t, "lpains.net", (*body)[0].Host)
+	assert.Equal(t, `Post "lpains.net": EOF`, (*body)[0].Error)
+	assert.Equal(t, 4, (*body)[0].Attempts)
+	assert.NotContains(t, bodyString, "s3cr3t")
+	assert.NotContains(t, bodyString, "Bearer abc")
+	assert.NotContains(t, bodyString, "R0UT1NGK3Y")
+
+	letters, _ := queue.List()
+	assert.Equal(t, delivery, letters[0].WebhookDelivery)
+}
+
+func TestReplayDeadLetter(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	router, queue := newDeadLetterRouter(t)
+	letter, _ := queue.Add(jobs.WebhookDelivery{Notifier: "Slack", Method: "POST", Url: ts.URL}, 4, assert.AnError)
+
+	code, _, _, _, _ := makeRequest[string](router, "POST", "/api/dead-letters/"+letter.ID+"/replay", nil)
+
+	assert.Equal(t, 204, code)
+
+	code, body, _, _, err := makeRequest[models.ErrorResult](router, "POST", "/api/dead-letters/"+letter.ID+"/replay", nil)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 404, code)
+	assert.Equal(t, []string{"dead letter not found"}, body.Errors)
+}
+
+func TestReplayDeadLetterFailure(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	router, queue := newDeadLetterRouter(t)
+	letter, _ := queue.Add(jobs.WebhookDelivery{Notifier: "Slack", Method: "POST", Url: ts.URL}, 4, assert.AnError)
+
+	code, body, _, _, err := makeRequest[models.ErrorResult](router, "POST", "/api/dead-letters/"+letter.ID+"/replay", nil)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 502, code)
+	assert.Equal(t, []string{"error sending notification to Slack"}, body.Errors)
+
+	code, result, _, _, err := makeRequest[models.ReplayResult](router, "POST", "/api/dead-letters/replay", nil)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 200, code)
+	assert.Equal(t, 0, result.Replayed)
+	assert.Equal(t, []string{"dead letter " + letter.ID + ": error sending notification to Slack"}, result.Errors)
+}
+
+func TestDeadLettersNotEnabled(t *testing.T) {
+	handlers := new(Handlers)
+
+	router := http.NewServeMux()
+	router.HandleFunc("GET /api/dead-letters", handlers.GetDeadLetters)
+
+	code, body, _, _, err := makeRequest[models.ErrorResult](router, "GET", "/api/dead-letters", nil)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 501, code)
+	assert.Equal(t, []string{"dead letters are not enabled"}, body.Errors)
+}
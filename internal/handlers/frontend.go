@@ -1,13 +1,18 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"html/template"
 	"log"
 	"net/http"
-	"slices"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/jlucaspains/sharp-cert-manager/internal/midlewares"
 	"github.com/jlucaspains/sharp-cert-manager/internal/models"
+
 	"github.com/jlucaspains/sharp-cert-manager/internal/services"
 )
 
@@ -22,10 +27,18 @@ func initTemplates() {
 	indexTemplate = template.Must(template.ParseGlob(fmt.Sprintf("%s/*", templatePath)))
 }
 
+type indexPage struct {
+	Items     []models.CheckCertItem
+	CanManage bool
+}
+
 func (h Handlers) Index(w http.ResponseWriter, r *http.Request) {
 	initTemplates()
 
-	err := indexTemplate.ExecuteTemplate(w, "index.html", h.CertList)
+	err := indexTemplate.ExecuteTemplate(w, "index.html", indexPage{
+		Items:     h.CertList.List(),
+		CanManage: h.CertList.CanManage() && midlewares.HasRole(r.Context(), models.RoleAdmin),
+	})
 
 	handleError(w, err)
 }
@@ -42,15 +55,14 @@ func (h Handlers) GetItem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	idx := slices.IndexFunc(h.CertList, func(c models.CheckCertItem) bool { return c.Name == name })
+	item, ok := h.CertList.Find(name)
 
-	if idx < 0 {
+	if !ok {
 		h.HTML(w, http.StatusBadRequest, "the provided cert name is not configured")
 		return
 	}
 
-	item := h.CertList[idx]
-	result, err := services.CheckCertStatus(item, h.ExpirationWarningDays)
+	result, err := h.Cache.CheckCertStatus(r.Context(), item, h.ExpirationWarningDays, h.isRefresh(r))
 
 	if err != nil {
 		handleError(w, err)
@@ -62,6 +74,16 @@ func (h Handlers) GetItem(w http.ResponseWriter, r *http.Request) {
 	handleError(w, err)
 }
 
+// itemDetail is the check result with the alert state of the target, which
+// is nil when alerting is disabled
+type itemDetail struct {
+	*models.CertCheckResult
+	Alert     *models.AlertState
+	Snoozed   bool
+	CanManage bool
+	Errors    []string
+}
+
 func (h Handlers) GetItemDetail(w http.ResponseWriter, r *http.Request) {
 	initTemplates()
 
@@ -69,31 +91,205 @@ func (h Handlers) GetItemDetail(w http.ResponseWriter, r *http.Request) {
 
 	log.Println("Received detail message for name: " + name)
 
+	h.renderItemDetail(w, r, name, h.isRefresh(r), nil)
+}
+
+// PostSnooze snoozes the alerts of the target until the start of the date
+// chosen in the item detail
+func (h Handlers) PostSnooze(w http.ResponseWriter, r *http.Request) {
+	initTemplates()
+
+	name := r.PostFormValue("name")
+	errs := []string{}
+
+	until, err := time.ParseInLocation("2006-01-02", r.PostFormValue("until"), time.Local)
+
+	if err != nil {
+		errs = append(errs, "until should be a date")
+	} else if h.Alerts != nil {
+		_, err = h.snooze(r, name, models.SnoozeParams{Until: until, Comment: strings.TrimSpace(r.PostFormValue("comment"))})
+		errs = append(errs, getSnoozeFormErrors(err)...)
+	}
+
+	h.renderItemDetail(w, r, name, false, errs)
+}
+
+func (h Handlers) PostUnsnooze(w http.ResponseWriter, r *http.Request) {
+	initTemplates()
+
+	name := r.PostFormValue("name")
+	errs := []string{}
+
+	if h.Alerts != nil {
+		errs = getSnoozeFormErrors(h.unsnooze(name))
+	}
+
+	h.renderItemDetail(w, r, name, false, errs)
+}
+
+func getSnoozeFormErrors(err error) []string {
+	if err == nil {
+		return []string{}
+	}
+
+	if errors.Is(err, errSnoozeInPast) {
+		return []string{err.Error()}
+	}
+
+	log.Printf("Error saving alerts: %s", err)
+
+	return []string{"failed to save alerts"}
+}
+
+func (h Handlers) renderItemDetail(w http.ResponseWriter, r *http.Request, name string, refresh bool, errs []string) {
 	if name == "" {
 		h.HTML(w, http.StatusBadRequest, "name is required")
 		return
 	}
 
-	idx := slices.IndexFunc(h.CertList, func(c models.CheckCertItem) bool { return c.Name == name })
+	item, ok := h.CertList.Find(name)
 
-	if idx < 0 {
+	if !ok {
 		h.HTML(w, http.StatusBadRequest, "the provided cert name is not configured")
 		return
 	}
 
-	item := h.CertList[idx]
-	result, err := services.CheckCertStatus(item, h.ExpirationWarningDays)
+	result, err := h.Cache.CheckCertStatus(r.Context(), item, h.ExpirationWarningDays, refresh)
 
 	if err != nil {
 		handleError(w, err)
 		return
 	}
 
-	err = indexTemplate.ExecuteTemplate(w, "itemModal.html", result)
+	detail := itemDetail{
+		CertCheckResult: result,
+		CanManage:       midlewares.HasRole(r.Context(), models.RoleAdmin),
+		Errors:          errs,
+	}
+
+	if h.Alerts != nil {
+		alert := h.Alerts.Get(item.Name)
+		detail.Alert = &alert
+		detail.Snoozed = alert.IsSnoozed(time.Now())
+	}
+
+	err = indexTemplate.ExecuteTemplate(w, "itemModal.html", detail)
 
 	handleError(w, err)
 }
 
+func (h Handlers) GetItemHistory(w http.ResponseWriter, r *http.Request) {
+	initTemplates()
+
+	name, _ := h.getQueryParam(r, "name")
+
+	if name == "" {
+		h.HTML(w, http.StatusBadRequest, "name is required")
+		return
+	}
+
+	result, err := services.GetCertHistory(name, 50)
+
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	err = indexTemplate.ExecuteTemplate(w, "itemHistory.html", result)
+
+	handleError(w, err)
+}
+
+type addTargetForm struct {
+	Values models.CertTargetParams
+	Errors []string
+}
+
+func (h Handlers) GetAddTarget(w http.ResponseWriter, r *http.Request) {
+	initTemplates()
+
+	err := indexTemplate.ExecuteTemplate(w, "addTargetModal.html", addTargetForm{})
+
+	handleError(w, err)
+}
+
+// PostAddTarget adds the target from the form. On success the modal is closed
+// and the new item is appended to the list, otherwise the form is rendered
+// again with the errors.
+func (h Handlers) PostAddTarget(w http.ResponseWriter, r *http.Request) {
+	initTemplates()
+
+	form := addTargetForm{Values: getTargetFormValues(r)}
+	item, err := getCertTarget(form.Values)
+
+	if err == nil {
+		err = h.CertList.Add(item)
+	}
+
+	if err != nil {
+		form.Errors = getTargetFormErrors(h, err)
+		err = indexTemplate.ExecuteTemplate(w, "addTargetModal.html", form)
+		handleError(w, err)
+		return
+	}
+
+	// a source target is shown through the certificates found in it
+	items := []models.CheckCertItem{item}
+	if services.IsCertSource(item) {
+		h.refreshSource(r, item)
+		items = h.CertList.SourceItems(item.Name)
+	}
+
+	for _, item := range items {
+		if err = indexTemplate.ExecuteTemplate(w, "newItem.html", item); err != nil {
+			break
+		}
+	}
+
+	handleError(w, err)
+}
+
+func getTargetFormValues(r *http.Request) models.CertTargetParams {
+	warningDays, _ := strconv.Atoi(r.PostFormValue("warningDays"))
+
+	return models.CertTargetParams{
+		Name:        strings.TrimSpace(r.PostFormValue("name")),
+		Type:        r.PostFormValue("type"),
+		Url:         strings.TrimSpace(r.PostFormValue("url")),
+		WarningDays: warningDays,
+		Tags:        getFormList(r, "tags"),
+		SNI:         strings.TrimSpace(r.PostFormValue("sni")),
+		IP:          strings.TrimSpace(r.PostFormValue("ip")),
+		Recipients:  getFormList(r, "recipients"),
+	}
+}
+
+// getFormList splits a comma separated form value
+func getFormList(r *http.Request, key string) []string {
+	result := []string{}
+	for _, value := range strings.Split(r.PostFormValue(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			result = append(result, value)
+		}
+	}
+
+	return result
+}
+
+func getTargetFormErrors(h Handlers, err error) []string {
+	if status, result := h.ErrorToHttpResult(err); status == http.StatusBadRequest {
+		return result.Errors
+	}
+
+	if errors.Is(err, services.ErrTargetExists) || errors.Is(err, services.ErrNoTargetStore) {
+		return []string{err.Error()}
+	}
+
+	log.Printf("Error saving targets: %s", err)
+
+	return []string{"failed to save targets"}
+}
+
 func (h Handlers) GetEmpty(w http.ResponseWriter, r *http.Request) {
 	h.HTML(w, http.StatusOK, "")
 }
@@ -2,9 +2,16 @@ package handlers
 
 import (
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/jlucaspains/sharp-cert-manager/internal/midlewares"
 	"github.com/jlucaspains/sharp-cert-manager/internal/models"
+	"github.com/jlucaspains/sharp-cert-manager/internal/services"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -18,14 +25,17 @@ func TestInitTemplate(t *testing.T) {
 	assert.NotNil(t, indexTemplate.Lookup("item.html"))
 	assert.NotNil(t, indexTemplate.Lookup("itemLoaded.html"))
 	assert.NotNil(t, indexTemplate.Lookup("itemModal.html"))
+	assert.NotNil(t, indexTemplate.Lookup("itemHistory.html"))
+	assert.NotNil(t, indexTemplate.Lookup("addTargetModal.html"))
+	assert.NotNil(t, indexTemplate.Lookup("newItem.html"))
 }
 
 func TestRendersIndex(t *testing.T) {
 	templatePath = "../../frontend"
 	handlers := new(Handlers)
-	handlers.CertList = []models.CheckCertItem{
+	handlers.CertList = services.NewCertRegistry([]models.CheckCertItem{
 		{Name: "blog.lpains.net", Url: "https://blog.lpains.net", Type: models.CertCheckURL},
-	}
+	})
 
 	router := http.NewServeMux()
 	router.HandleFunc("GET /", handlers.Index)
@@ -42,9 +52,9 @@ func TestRendersIndex(t *testing.T) {
 func TestRendersItem(t *testing.T) {
 	templatePath = "../../frontend"
 	handlers := new(Handlers)
-	handlers.CertList = []models.CheckCertItem{
+	handlers.CertList = services.NewCertRegistry([]models.CheckCertItem{
 		{Name: "blog.lpains.net", Url: "https://blog.lpains.net", Type: models.CertCheckURL},
-	}
+	})
 
 	router := http.NewServeMux()
 	router.HandleFunc("GET /item", handlers.GetItem)
@@ -61,9 +71,9 @@ func TestRendersItem(t *testing.T) {
 func TestRendersItemError(t *testing.T) {
 	templatePath = "../frontend"
 	handlers := new(Handlers)
-	handlers.CertList = []models.CheckCertItem{
+	handlers.CertList = services.NewCertRegistry([]models.CheckCertItem{
 		{Name: "blo.lpains.net", Url: "https://blo.lpains.net", Type: models.CertCheckURL},
-	}
+	})
 
 	router := http.NewServeMux()
 	router.HandleFunc("GET /item", handlers.GetItem)
@@ -78,9 +88,9 @@ func TestRendersItemError(t *testing.T) {
 func TestRendersItemNoName(t *testing.T) {
 	templatePath = "../frontend"
 	handlers := new(Handlers)
-	handlers.CertList = []models.CheckCertItem{
+	handlers.CertList = services.NewCertRegistry([]models.CheckCertItem{
 		{Name: "blog.lpains.net", Url: "https://blog.lpains.net", Type: models.CertCheckURL},
-	}
+	})
 
 	router := http.NewServeMux()
 	router.HandleFunc("GET /item", handlers.GetItem)
@@ -95,9 +105,9 @@ func TestRendersItemNoName(t *testing.T) {
 func TestRendersItemBadName(t *testing.T) {
 	templatePath = "../frontend"
 	handlers := new(Handlers)
-	handlers.CertList = []models.CheckCertItem{
+	handlers.CertList = services.NewCertRegistry([]models.CheckCertItem{
 		{Name: "blog.lpains.net", Url: "https://blog.lpains.net", Type: models.CertCheckURL},
-	}
+	})
 
 	router := http.NewServeMux()
 	router.HandleFunc("GET /item", handlers.GetItem)
@@ -112,9 +122,9 @@ func TestRendersItemBadName(t *testing.T) {
 func TestRendersItemDetail(t *testing.T) {
 	templatePath = "../frontend"
 	handlers := new(Handlers)
-	handlers.CertList = []models.CheckCertItem{
+	handlers.CertList = services.NewCertRegistry([]models.CheckCertItem{
 		{Name: "blog.lpains.net", Url: "https://blog.lpains.net", Type: models.CertCheckURL},
-	}
+	})
 
 	router := http.NewServeMux()
 	router.HandleFunc("GET /itemDetail", handlers.GetItemDetail)
@@ -130,9 +140,9 @@ func TestRendersItemDetail(t *testing.T) {
 func TestRendersItemDetailError(t *testing.T) {
 	templatePath = "../frontend"
 	handlers := new(Handlers)
-	handlers.CertList = []models.CheckCertItem{
+	handlers.CertList = services.NewCertRegistry([]models.CheckCertItem{
 		{Name: "blo.lpains.net", Url: "https://blo.lpains.net", Type: models.CertCheckURL},
-	}
+	})
 
 	router := http.NewServeMux()
 	router.HandleFunc("GET /itemDetail", handlers.GetItemDetail)
@@ -147,9 +157,9 @@ func TestRendersItemDetailError(t *testing.T) {
 func TestRendersItemDetailNoName(t *testing.T) {
 	templatePath = "../frontend"
 	handlers := new(Handlers)
-	handlers.CertList = []models.CheckCertItem{
+	handlers.CertList = services.NewCertRegistry([]models.CheckCertItem{
 		{Name: "blog.lpains.net", Url: "https://blog.lpains.net", Type: models.CertCheckURL},
-	}
+	})
 
 	router := http.NewServeMux()
 	router.HandleFunc("GET /itemDetail", handlers.GetItemDetail)
@@ -165,9 +175,9 @@ func TestRendersItemDetailNoName(t *testing.T) {
 func TestRendersItemDetailBadName(t *testing.T) {
 	templatePath = "../frontend"
 	handlers := new(Handlers)
-	handlers.CertList = []models.CheckCertItem{
+	handlers.CertList = services.NewCertRegistry([]models.CheckCertItem{
 		{Name: "blog.lpains.net", Url: "https://blog.lpains.net", Type: models.CertCheckURL},
-	}
+	})
 
 	router := http.NewServeMux()
 	router.HandleFunc("GET /itemDetail", handlers.GetItemDetail)
@@ -193,3 +203,204 @@ func TestRendersEmpty(t *testing.T) {
 	assert.Equal(t, 200, code)
 	assert.Equal(t, body, "")
 }
+
+func TestRendersItemHistory(t *testing.T) {
+	templatePath = "../../frontend"
+	store := services.NewMemoryHistoryStore(10)
+	store.Record(models.CertHistoryEntry{Name: "blog.lpains.net", Result: models.CertCheckResult{Fingerprint: "a", SerialNumber: "01"}})
+	store.Record(models.CertHistoryEntry{Name: "blog.lpains.net", Result: models.CertCheckResult{Fingerprint: "b", SerialNumber: "02", IsValid: true}})
+	services.SetHistoryStore(store)
+	defer services.SetHistoryStore(nil)
+
+	handlers := new(Handlers)
+	router := http.NewServeMux()
+	router.HandleFunc("GET /itemHistory", handlers.GetItemHistory)
+
+	code, _, body, _, err := makeRequest[string](router, "GET", "/itemHistory?name=blog.lpains.net", nil)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 200, code)
+	assert.Contains(t, body, "Certificate rotated.")
+	assert.Contains(t, body, "Serial: 02")
+}
+
+func TestRendersItemHistoryNoName(t *testing.T) {
+	handlers := new(Handlers)
+	router := http.NewServeMux()
+	router.HandleFunc("GET /itemHistory", handlers.GetItemHistory)
+
+	code, _, body, _, err := makeRequest[string](router, "GET", "/itemHistory", nil)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 400, code)
+	assert.Equal(t, "name is required", body)
+}
+
+func TestRendersItemDetailFromCache(t *testing.T) {
+	templatePath = "../../frontend"
+	item := models.CheckCertItem{Name: "blo.lpains.net", Url: "https://blo.lpains.net", Type: models.CertCheckURL}
+	handlers := new(Handlers)
+	handlers.CertList = services.NewCertRegistry([]models.CheckCertItem{item})
+	handlers.Cache = services.NewResultCache(time.Minute)
+	checkedAt := time.Now().UTC()
+	handlers.Cache.Set(item, &models.CertCheckResult{Hostname: "blo.lpains.net", CommonName: "blo.lpains.net", CheckedAt: checkedAt})
+
+	router := http.NewServeMux()
+	router.HandleFunc("GET /itemDetail", handlers.GetItemDetail)
+
+	code, _, body, _, err := makeRequest[string](router, "GET", "/itemDetail?name=blo.lpains.net", nil)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 200, code)
+	assert.Contains(t, body, "<td class=\"px-4 py-2\">"+checkedAt.Format("Jan 02, 2006 15:04:05 MST")+"</td>")
+	assert.Contains(t, body, "hx-get=\"/itemDetail?name=blo.lpains.net&refresh=true\"")
+
+	// a refresh bypasses the cache and probes the unreachable host
+	code, _, _, _, _ = makeRequest[string](router, "GET", "/itemDetail?name=blo.lpains.net&refresh=true", nil)
+
+	assert.Equal(t, 500, code)
+}
+
+func TestRendersItemDetailKeyVault(t *testing.T) {
+	templatePath = "../../frontend"
+	item := models.CheckCertItem{Name: "vault/web", Url: "https://vault.vault.azure.net/certificates/web", Type: models.CertCheckAzure}
+	handlers := new(Handlers)
+	handlers.CertList = services.NewCertRegistry([]models.CheckCertItem{item})
+	handlers.Cache = services.NewResultCache(time.Minute)
+	handlers.Cache.Set(item, &models.CertCheckResult{Hostname: "vault/web", CheckedAt: time.Now().UTC(), KeyVault: &models.KeyVaultInfo{
+		Enabled:         true,
+		IssuerName:      "Self",
+		AutoRenew:       true,
+		LifetimeActions: []models.LifetimeAction{{Action: "AutoRenew", DaysBeforeExpiry: 30}},
+		Tags:            map[string]string{"team": "web"},
+	}})
+
+	router := http.NewServeMux()
+	router.HandleFunc("GET /itemDetail", handlers.GetItemDetail)
+
+	code, _, body, _, err := makeRequest[string](router, "GET", "/itemDetail?name=vault/web", nil)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 200, code)
+	assert.Contains(t, body, "<li>Issuer: Self</li>")
+	assert.Contains(t, body, "<li>Auto-renew: configured</li>")
+	assert.Contains(t, body, "<li>AutoRenew: 30 days before expiry</li>")
+	assert.Contains(t, body, "<li>Tags: team=web </li>")
+}
+
+func TestRendersItemDetailAWS(t *testing.T) {
+	templatePath = "../../frontend"
+	item := models.CheckCertItem{Name: "acm/web", Url: "arn:aws:acm:us-east-1:123456789012:certificate/1111", Type: models.CertCheckAWS}
+	handlers := new(Handlers)
+	handlers.CertList = services.NewCertRegistry([]models.CheckCertItem{item})
+	handlers.Cache = services.NewResultCache(time.Minute)
+	handlers.Cache.Set(item, &models.CertCheckResult{Hostname: "acm/web", CheckedAt: time.Now().UTC(), AWS: &models.AWSInfo{
+		Service:            "acm",
+		Arn:                item.Url,
+		Status:             "ISSUED",
+		Type:               "AMAZON_ISSUED",
+		InUse:              true,
+		InUseBy:            []string{"arn:aws:elasticloadbalancing:us-east-1:123456789012:loadbalancer/app/web/1"},
+		RenewalEligibility: "ELIGIBLE",
+		AutoRenew:          true,
+	}})
+
+	router := http.NewServeMux()
+	router.HandleFunc("GET /itemDetail", handlers.GetItemDetail)
+
+	code, _, body, _, err := makeRequest[string](router, "GET", "/itemDetail?name=acm/web", nil)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 200, code)
+	assert.Contains(t, body, "<li>Status: ISSUED (AMAZON_ISSUED)</li>")
+	assert.Contains(t, body, "<li>In use: arn:aws:elasticloadbalancing:us-east-1:123456789012:loadbalancer/app/web/1</li>")
+	assert.Contains(t, body, "<li>Renewal: ELIGIBLE</li>")
+	assert.Contains(t, body, "<li>Auto-renew: yes</li>")
+}
+
+func TestRendersIndexAddTargetForAdmins(t *testing.T) {
+	templatePath = "../../frontend"
+	handlers := new(Handlers)
+	handlers.CertList = services.NewCertRegistry([]models.CheckCertItem{})
+	store, _ := services.NewTargetStore(filepath.Join(t.TempDir(), "targets.json"))
+
+	router := http.NewServeMux()
+	router.HandleFunc("GET /", handlers.Index)
+
+	viewer := midlewares.NewAuth(router, models.AuthConfig{APIKeys: []models.APIKeyConfig{
+		{Name: "viewer", KeyHash: "d35ca5051b82ffc326a3b0b6574a9a3161dee16b9478a199ee39cd803ce5b799", Role: models.RoleViewer},
+	}}, nil)
+	admin := midlewares.NewAuth(router, models.AuthConfig{}, nil)
+
+	for _, test := range []struct {
+		handler   http.Handler
+		store     *services.TargetStore
+		canManage bool
+	}{{viewer, store, false}, {admin, store, true}, {admin, nil, false}} {
+		handlers.CertList.SetTargetStore(test.store)
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Set("X-API-Key", "viewer")
+		rr := httptest.NewRecorder()
+		test.handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, 200, rr.Code)
+		assert.Equal(t, test.canManage, strings.Contains(rr.Body.String(), "hx-get=\"/addTarget\""))
+	}
+}
+
+func TestRendersSnoozeForm(t *testing.T) {
+	templatePath = "../../frontend"
+	item := models.CheckCertItem{Name: "blo.lpains.net", Url: "https://blo.lpains.net", Type: models.CertCheckURL}
+	handlers := new(Handlers)
+	handlers.CertList = services.NewCertRegistry([]models.CheckCertItem{item})
+	handlers.Cache = services.NewResultCache(time.Minute)
+	handlers.Cache.Set(item, &models.CertCheckResult{Hostname: "blo.lpains.net", CheckedAt: time.Now()})
+	handlers.Alerts, _ = services.NewAlertStore(filepath.Join(t.TempDir(), "alerts.json"))
+
+	router := http.NewServeMux()
+	router.HandleFunc("GET /itemDetail", handlers.GetItemDetail)
+	router.HandleFunc("POST /snooze", handlers.PostSnooze)
+	router.HandleFunc("POST /unsnooze", handlers.PostUnsnooze)
+	admin := midlewares.NewAuth(router, models.AuthConfig{}, nil)
+
+	code, _, body, _, _ := makeRequest[string](admin, "GET", "/itemDetail?name=blo.lpains.net", nil)
+
+	assert.Equal(t, 200, code)
+	assert.Contains(t, body, "No alerts sent")
+	assert.Contains(t, body, "hx-post=\"/snooze\"")
+
+	until := time.Now().AddDate(0, 0, 7).Format("2006-01-02")
+	_, body = postForm(admin, "/snooze", url.Values{"name": {"blo.lpains.net"}, "until": {until}, "comment": {"renewal scheduled"}})
+
+	assert.Contains(t, body, "by anonymous: renewal scheduled")
+	assert.Contains(t, body, "hx-post=\"/unsnooze\"")
+	assert.True(t, handlers.Alerts.Get("blo.lpains.net").IsSnoozed(time.Now()))
+
+	_, body = postForm(admin, "/snooze", url.Values{"name": {"blo.lpains.net"}, "until": {"2020-01-01"}})
+
+	assert.Contains(t, body, "<li>until should be in the future</li>")
+
+	_, body = postForm(admin, "/unsnooze", url.Values{"name": {"blo.lpains.net"}})
+
+	assert.Contains(t, body, "hx-post=\"/snooze\"")
+	assert.False(t, handlers.Alerts.Get("blo.lpains.net").IsSnoozed(time.Now()))
+}
+
+func TestRendersItemDetailWithoutSnoozeForViewers(t *testing.T) {
+	templatePath = "../../frontend"
+	item := models.CheckCertItem{Name: "blo.lpains.net", Url: "https://blo.lpains.net", Type: models.CertCheckURL}
+	handlers := new(Handlers)
+	handlers.CertList = services.NewCertRegistry([]models.CheckCertItem{item})
+	handlers.Cache = services.NewResultCache(time.Minute)
+	handlers.Cache.Set(item, &models.CertCheckResult{Hostname: "blo.lpains.net", CheckedAt: time.Now()})
+	handlers.Alerts, _ = services.NewAlertStore(filepath.Join(t.TempDir(), "alerts.json"))
+
+	router := http.NewServeMux()
+	router.HandleFunc("GET /itemDetail", handlers.GetItemDetail)
+
+	code, _, body, _, _ := makeRequest[string](router, "GET", "/itemDetail?name=blo.lpains.net", nil)
+
+	assert.Equal(t, 200, code)
+	assert.Contains(t, body, "No alerts sent")
+	assert.NotContains(t, body, "hx-post=\"/snooze\"")
+}
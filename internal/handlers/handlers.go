@@ -6,11 +6,18 @@ import (
 	"net/http"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/jlucaspains/sharp-cert-manager/internal/jobs"
 	"github.com/jlucaspains/sharp-cert-manager/internal/models"
+	"github.com/jlucaspains/sharp-cert-manager/internal/services"
 )
 
 type Handlers struct {
-	CertList              []models.CheckCertItem
+	CertList              *services.CertRegistry
+	Metrics               *services.CertMetrics
+	Cache                 *services.ResultCache
+	Job                   *jobs.CheckCertJob
+	DeadLetters           *jobs.DeadLetterQueue
+	Alerts                *services.AlertStore
 	ExpirationWarningDays int
 	CORSOrigins           string
 }
@@ -39,6 +46,13 @@ func (h Handlers) HTML(w http.ResponseWriter, statusCode int, data string) {
 	w.Write([]byte(data))
 }
 
+// isRefresh tells whether the request asks to bypass the result cache
+func (h Handlers) isRefresh(r *http.Request) bool {
+	refresh, _ := h.getQueryParam(r, "refresh")
+
+	return refresh == "true"
+}
+
 func (h Handlers) getQueryParam(r *http.Request, key string) (string, error) {
 	if param := r.URL.Query()[key]; param != nil {
 		return param[0], nil
@@ -53,35 +67,17 @@ func (h Handlers) ErrorToHttpResult(err error) (int, *models.ErrorResult) {
 		return http.StatusBadRequest, &models.ErrorResult{Errors: out}
 	}
 
+	if tErr, ok := err.(*targetValidationError); ok {
+		return http.StatusBadRequest, &models.ErrorResult{Errors: []string{tErr.Error()}}
+	}
+
 	return http.StatusInternalServerError, &models.ErrorResult{Errors: []string{"Unknown error"}}
 }
 
 func translateErrors(err validator.ValidationErrors) []string {
 	out := make([]string, len(err))
 	for i, fe := range err {
-		out[i] = getValidationErrorMsg(fe)
+		out[i] = services.GetValidationErrorMsg(fe)
 	}
 	return out
 }
-
-func getValidationErrorMsg(fe validator.FieldError) string {
-	switch fe.Tag() {
-	case "required":
-		return fmt.Sprintf("%s is required", fe.Field())
-	case "lte":
-		return fmt.Sprintf("%s should be less than or equal to %s", fe.Field(), fe.Param())
-	case "lt":
-		return fmt.Sprintf("%s should be less than %s", fe.Field(), fe.Param())
-	case "gte":
-		return fmt.Sprintf("%s should be greater than or equal to %s", fe.Field(), fe.Param())
-	case "gt":
-		return fmt.Sprintf("%s should be greater than %s", fe.Field(), fe.Param())
-	case "min":
-		return fmt.Sprintf("%s should have minimum length of %s", fe.Field(), fe.Param())
-	case "max":
-		return fmt.Sprintf("%s should have maximum length of %s", fe.Field(), fe.Param())
-	case "alpha":
-		return fmt.Sprintf("%s should contain alpha characters only", fe.Field())
-	}
-	return "Unknown error"
-}
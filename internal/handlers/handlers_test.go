@@ -61,7 +61,7 @@ func TestErrorTranslationServerError(t *testing.T) {
 	assert.Equal(t, "Unknown error", result.Errors[0])
 }
 
-func makeRequest[K any | []any](router *http.ServeMux, method string, url string, body any) (code int, respBody *K, bodyString string, headers http.Header, err error) {
+func makeRequest[K any | []any](router http.Handler, method string, url string, body any) (code int, respBody *K, bodyString string, headers http.Header, err error) {
 	inputBody := ""
 
 	if body != nil {
@@ -4,11 +4,27 @@ import (
 	"net/http"
 
 	"github.com/jlucaspains/sharp-cert-manager/internal/models"
+	"github.com/jlucaspains/sharp-cert-manager/internal/services"
 )
 
+var getAzureHealth = services.GetAzureHealth
+
 func (h Handlers) HealthCheck(w http.ResponseWriter, r *http.Request) {
-	h.JSON(w, http.StatusOK, &models.HealthResult{
+	result := &models.HealthResult{
 		Healthy:      true,
 		Dependencies: []models.HealthResultItem{},
-	})
+	}
+
+	// Key Vault is only a dependency once it is used
+	if azure, ok := getAzureHealth(); ok {
+		result.Dependencies = append(result.Dependencies, azure)
+		result.Healthy = azure.Healthy
+	}
+
+	status := http.StatusOK
+	if !result.Healthy {
+		status = http.StatusServiceUnavailable
+	}
+
+	h.JSON(w, status, result)
 }
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/jlucaspains/sharp-cert-manager/internal/models"
+	"github.com/jlucaspains/sharp-cert-manager/internal/services"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -19,4 +20,24 @@ func TestGetHealth(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, 200, code)
 	assert.True(t, body.Healthy)
+	assert.Empty(t, body.Dependencies)
+}
+
+func TestGetHealthUnhealthy(t *testing.T) {
+	getAzureHealth = func() (models.HealthResultItem, bool) {
+		return models.HealthResultItem{Name: "Azure Key Vault", Error: "token could not be acquired"}, true
+	}
+	defer func() { getAzureHealth = services.GetAzureHealth }()
+
+	handlers := new(Handlers)
+
+	router := http.NewServeMux()
+	router.HandleFunc("GET /health", handlers.HealthCheck)
+
+	code, body, _, _, err := makeRequest[models.HealthResult](router, "GET", "/health", nil)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 503, code)
+	assert.False(t, body.Healthy)
+	assert.Equal(t, []models.HealthResultItem{{Name: "Azure Key Vault", Error: "token could not be acquired"}}, body.Dependencies)
 }
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jlucaspains/sharp-cert-manager/internal/models"
+	"github.com/jlucaspains/sharp-cert-manager/internal/services"
+)
+
+type metricDefinition struct {
+	name  string
+	help  string
+	value func(metric services.CertMetric, now time.Time) (float64, bool)
+}
+
+// metrics in the Prometheus text exposition format. Expiry values are only
+// exposed once a certificate was read.
+var metricDefinitions = []metricDefinition{
+	{"sharp_cert_expiry_days", "Days until the certificate expires.", func(metric services.CertMetric, now time.Time) (float64, bool) {
+		return metric.Result.CertEndDate.Sub(now).Hours() / 24, !metric.Result.CertEndDate.IsZero()
+	}},
+	{"sharp_cert_not_after_timestamp_seconds", "Certificate expiration as a unix timestamp.", func(metric services.CertMetric, now time.Time) (float64, bool) {
+		return float64(metric.Result.CertEndDate.Unix()), !metric.Result.CertEndDate.IsZero()
+	}},
+	{"sharp_cert_valid", "Whether the certificate passed all validations.", func(metric services.CertMetric, now time.Time) (float64, bool) {
+		return getMetricBool(metric.Success && metric.Result.IsValid), true
+	}},
+	{"sharp_cert_last_check_success", "Whether the last check completed without errors.", func(metric services.CertMetric, now time.Time) (float64, bool) {
+		return getMetricBool(metric.Success), true
+	}},
+	{"sharp_cert_last_check_timestamp_seconds", "Time of the last check as a unix timestamp.", func(metric services.CertMetric, now time.Time) (float64, bool) {
+		return float64(metric.CheckedAt.Unix()), true
+	}},
+	{"sharp_cert_check_duration_seconds", "Duration of the last check.", func(metric services.CertMetric, now time.Time) (float64, bool) {
+		return metric.Duration.Seconds(), true
+	}},
+}
+
+var certCheckTypeNames = map[models.CertCheckType]string{
+	models.CertCheckURL:   "url",
+	models.CertCheckAzure: "azure",
+	models.CertCheckAWS:   "aws",
+	models.CertCheckVault: "vault",
+}
+
+func (h Handlers) GetMetrics(w http.ResponseWriter, r *http.Request) {
+	metrics := h.Metrics.List()
+	now := time.Now()
+
+	var body bytes.Buffer
+	for _, definition := range metricDefinitions {
+		fmt.Fprintf(&body, "# HELP %s %s\n# TYPE %s gauge\n", definition.name, definition.help, definition.name)
+
+		for _, metric := range metrics {
+			if value, ok := definition.value(metric, now); ok {
+				fmt.Fprintf(&body, "%s{%s} %g\n", definition.name, getMetricLabels(metric), value)
+			}
+		}
+	}
+
+	// the issuer is missing when a check fails so it is kept off the other
+	// metrics to not start new series
+	fmt.Fprintf(&body, "# HELP sharp_cert_info Issuer of the certificate.\n# TYPE sharp_cert_info gauge\n")
+	for _, metric := range metrics {
+		if metric.Result.Issuer != "" {
+			fmt.Fprintf(&body, "sharp_cert_info{%s,issuer=\"%s\"} 1\n", getMetricLabels(metric), escapeMetricLabel(metric.Result.Issuer))
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body.Bytes())
+}
+
+func getMetricLabels(metric services.CertMetric) string {
+	labels := [][2]string{
+		{"name", metric.Item.Name},
+		{"type", certCheckTypeNames[metric.Item.Type]},
+		{"tags", strings.Join(metric.Item.Tags, ",")},
+	}
+
+	result := []string{}
+	for _, label := range labels {
+		result = append(result, fmt.Sprintf("%s=\"%s\"", label[0], escapeMetricLabel(label[1])))
+	}
+
+	return strings.Join(result, ",")
+}
+
+var metricLabelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeMetricLabel(value string) string {
+	return metricLabelReplacer.Replace(value)
+}
+
+func getMetricBool(value bool) float64 {
+	if value {
+		return 1
+	}
+
+	return 0
+}
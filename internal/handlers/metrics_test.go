@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jlucaspains/sharp-cert-manager/internal/models"
+	"github.com/jlucaspains/sharp-cert-manager/internal/services"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetMetrics(t *testing.T) {
+	handlers := new(Handlers)
+	handlers.Metrics = services.NewCertMetrics()
+	handlers.Metrics.Record(
+		models.CheckCertItem{Name: "blog", Type: models.CertCheckURL, Tags: []string{"public", "blog"}},
+		&models.CertCheckResult{Issuer: "Test \"CA\"", IsValid: true, CertEndDate: time.Unix(1893456000, 0)},
+		nil,
+		1500*time.Millisecond)
+	handlers.Metrics.Record(models.CheckCertItem{Name: "vault", Type: models.CertCheckAzure}, nil, errors.New("timeout"), time.Second)
+
+	router := http.NewServeMux()
+	router.HandleFunc("GET /metrics", handlers.GetMetrics)
+
+	code, _, body, headers, err := makeRequest[string](router, "GET", "/metrics", nil)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 200, code)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", headers.Get("Content-Type"))
+	assert.Contains(t, body, "# TYPE sharp_cert_expiry_days gauge\n")
+	assert.Contains(t, body, "sharp_cert_not_after_timestamp_seconds{name=\"blog\",type=\"url\",tags=\"public,blog\"} 1.893456e+09\n")
+	assert.Contains(t, body, "sharp_cert_valid{name=\"blog\",type=\"url\",tags=\"public,blog\"} 1\n")
+	assert.Contains(t, body, "sharp_cert_check_duration_seconds{name=\"blog\",type=\"url\",tags=\"public,blog\"} 1.5\n")
+	assert.Contains(t, body, "sharp_cert_last_check_success{name=\"vault\",type=\"azure\",tags=\"\"} 0\n")
+	assert.Contains(t, body, "sharp_cert_valid{name=\"vault\",type=\"azure\",tags=\"\"} 0\n")
+	assert.Contains(t, body, "sharp_cert_info{name=\"blog\",type=\"url\",tags=\"public,blog\",issuer=\"Test \\\"CA\\\"\"} 1\n")
+	assert.NotContains(t, body, "sharp_cert_expiry_days{name=\"vault\"")
+	assert.NotContains(t, body, "sharp_cert_info{name=\"vault\"")
+}
+
+func TestGetMetricsEmpty(t *testing.T) {
+	handlers := new(Handlers)
+
+	router := http.NewServeMux()
+	router.HandleFunc("GET /metrics", handlers.GetMetrics)
+
+	code, _, body, _, err := makeRequest[string](router, "GET", "/metrics", nil)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 200, code)
+	assert.Contains(t, body, "# HELP sharp_cert_valid Whether the certificate passed all validations.\n")
+}
@@ -1,8 +1,13 @@
 package jobs
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/adhocore/gronx"
@@ -15,15 +20,43 @@ type Notifier interface {
 	IsReady() bool
 }
 
+// Resolver is implemented by notifiers that close incidents, e.g. PagerDuty.
+// They are given the valid targets that are not expiring regardless of the
+// notification level.
+type Resolver interface {
+	Resolve(result []CertCheckNotification) error
+}
+
 type CheckCertJob struct {
-	cron        string
-	ticker      *time.Ticker
-	gron        *gronx.Gronx
-	certList    []models.CheckCertItem
-	running     bool
-	notifier    Notifier
-	level       Level
-	warningDays int
+	cron            string
+	ticker          *time.Ticker
+	gron            *gronx.Gronx
+	certList        *services.CertRegistry
+	running         atomic.Bool
+	notifier        Notifier
+	level           Level
+	changeLevel     Level
+	warningDays     int
+	workers         int
+	metrics         *services.CertMetrics
+	cache           *services.ResultCache
+	previousResults map[string]*models.CertCheckResult
+	alerts          *services.AlertStore
+	reminder        time.Duration
+	escalationDays  []int
+	previousLock    sync.Mutex
+	runLock         sync.Mutex
+	ctx             context.Context
+	cancel          context.CancelFunc
+}
+
+// default number of targets checked at the same time
+const defaultWorkers = 10
+
+type certCheckOutcome struct {
+	previous *models.CertCheckResult
+	result   *models.CertCheckResult
+	err      error
 }
 
 type Level int
@@ -45,9 +78,38 @@ type CertCheckNotification struct {
 	IsValid           bool
 	Messages          []string
 	ExpirationWarning bool
+	Changed           bool
+	Resolved          bool
+	Name              string
+	Url               string
+	Tags              []string
+	Recipients        []string
+	Result            *models.CertCheckResult
+}
+
+// Severity is error for invalid certificates, warning for expiring or changed
+// ones and info otherwise
+func (n CertCheckNotification) Severity() string {
+	switch {
+	case !n.IsValid:
+		return "error"
+	case n.ExpirationWarning || n.Changed:
+		return "warning"
+	}
+
+	return "info"
+}
+
+// setTarget adds the target and full check result for custom templates
+func (n *CertCheckNotification) setTarget(item models.CheckCertItem, result *models.CertCheckResult) {
+	n.Name = item.Name
+	n.Url = item.Url
+	n.Tags = item.Tags
+	n.Recipients = item.Recipients
+	n.Result = result
 }
 
-func (c *CheckCertJob) Init(schedule string, level string, warningDays int, certList []models.CheckCertItem, notifier Notifier) error {
+func (c *CheckCertJob) Init(schedule string, level string, warningDays int, certList *services.CertRegistry, notifier Notifier) error {
 	c.gron = gronx.New()
 
 	if schedule == "" || !c.gron.IsValid(schedule) {
@@ -74,17 +136,56 @@ func (c *CheckCertJob) Init(schedule string, level string, warningDays int, cert
 	c.ticker = time.NewTicker(time.Minute)
 	c.notifier = notifier
 	c.level = levelValue
+	c.changeLevel = Warning
 	c.warningDays = warningDays
+	c.workers = defaultWorkers
+	c.ctx, c.cancel = context.WithCancel(context.Background())
 
 	return nil
 }
 
+// SetWorkers sets how many targets are checked at the same time. A zero or
+// negative value restores the default.
+func (c *CheckCertJob) SetWorkers(workers int) {
+	if workers <= 0 {
+		workers = defaultWorkers
+	}
+
+	c.workers = workers
+}
+
+// SetMetrics sets where the outcome of each check is published
+func (c *CheckCertJob) SetMetrics(metrics *services.CertMetrics) {
+	c.metrics = metrics
+}
+
+// SetCache sets the cache refreshed with the result of each check
+func (c *CheckCertJob) SetCache(cache *services.ResultCache) {
+	c.cache = cache
+}
+
+// SetChangeLevel sets the level of the certificate changed notifications.
+// They are sent when it is at or above the job notification level.
+func (c *CheckCertJob) SetChangeLevel(level string) {
+	levelValue, ok := levels[level]
+	if !ok {
+		levelValue = Warning
+	}
+
+	c.changeLevel = levelValue
+}
+
 func (c *CheckCertJob) RunNow() {
 	c.execute()
 }
 
+// IsRunning tells whether the job was started on its schedule
+func (c *CheckCertJob) IsRunning() bool {
+	return c != nil && c.running.Load()
+}
+
 func (c *CheckCertJob) Start() {
-	c.running = true
+	c.running.Store(true)
 	go func() {
 		for range c.ticker.C {
 			c.tryExecute()
@@ -93,7 +194,11 @@ func (c *CheckCertJob) Start() {
 }
 
 func (c *CheckCertJob) Stop() {
-	c.running = false
+	c.running.Store(false)
+
+	if c.cancel != nil {
+		c.cancel()
+	}
 
 	if c.ticker != nil {
 		c.ticker.Stop()
@@ -111,28 +216,181 @@ func (c *CheckCertJob) tryExecute() {
 }
 
 func (c *CheckCertJob) execute() {
+	// scheduled and on-demand runs must not overlap
+	c.runLock.Lock()
+	defer c.runLock.Unlock()
+
+	// sources are listed on every run to pick up new certificates
+	if err := c.certList.Refresh(c.context()); err != nil {
+		log.Printf("Error listing source certificates: %s", err)
+	}
+
+	certList := c.certList.List()
+	outcomes := c.checkAll(certList)
+
+	if c.metrics != nil {
+		c.metrics.Retain(certList)
+	}
+
+	// notifications are built in the configured order regardless of the
+	// order the checks completed in
+	now := time.Now()
 	result := []CertCheckNotification{}
-	for _, item := range c.certList {
-		checkStatus, err := services.CheckCertStatus(item, c.warningDays)
+	healthy := []CertCheckNotification{}
+	states := []models.AlertState{}
+	for i, item := range certList {
+		previous, checkStatus, err := outcomes[i].previous, outcomes[i].result, outcomes[i].err
 
 		if err != nil {
-			log.Printf("Error checking cert status: %s", err)
+			log.Printf("Error checking cert status for %s: %s", item.Name, err)
 			continue
 		}
 
 		log.Printf("Cert status for %s: %t", item.Name, checkStatus.IsValid)
 
-		item := c.getNotificationModel(checkStatus)
-		if c.shouldNotify(item) {
-			result = append(result, item)
+		state := models.AlertState{}
+		if c.alerts != nil {
+			state = c.alerts.Get(item.Name)
+		}
+
+		change, changed := c.getChangeNotificationModel(previous, checkStatus)
+
+		if checkStatus.Fingerprint != "" {
+			c.setPreviousResult(item.Name, checkStatus)
+		}
+
+		if state.IsSnoozed(now) {
+			log.Printf("Notifications for %s are snoozed until %s", item.Name, state.SnoozedUntil.Format(time.RFC3339))
+			continue
+		}
+
+		if changed && c.shouldNotifyChange() {
+			change.setTarget(item, checkStatus)
+			result = append(result, change)
+		}
+
+		notification := c.getNotificationModel(checkStatus)
+		notification.setTarget(item, checkStatus)
+
+		if c.alerts == nil {
+			if c.shouldNotify(notification) {
+				result = append(result, notification)
+			} else if notification.Severity() == "info" {
+				healthy = append(healthy, notification)
+			}
+
+			continue
+		}
+
+		alert, next := c.applyAlertState(state, notification, c.shouldNotify(notification), now)
+		states = append(states, next)
+
+		if alert != nil {
+			result = append(result, *alert)
 		}
 	}
 
+	// with stateful alerting there is nothing to say when nothing changed
+	if c.alerts != nil && len(result) == 0 {
+		c.recordAlerts(certList, states)
+		return
+	}
+
 	err := c.notifier.Notify(result)
+	c.resolve(healthy)
 
 	if err != nil {
 		log.Printf("Error sending notification: %s", err)
+
+		// the channels that were notified must not get the same alerts on the
+		// next run, the failed ones keep theirs in the dead letter queue
+		if !errors.Is(err, ErrPartialDelivery) {
+			return
+		}
+	}
+
+	c.recordAlerts(certList, states)
+}
+
+// resolve gives the healthy targets that were not notified to the notifier
+// when it closes incidents
+func (c *CheckCertJob) resolve(healthy []CertCheckNotification) {
+	resolver, ok := c.notifier.(Resolver)
+
+	if !ok || len(healthy) == 0 {
+		return
 	}
+
+	if err := resolver.Resolve(healthy); err != nil {
+		log.Printf("Error resolving incidents: %s", err)
+	}
+}
+
+// recordAlerts saves the alert states once the notification is sent so a
+// failed one is sent again on the next run
+func (c *CheckCertJob) recordAlerts(certList []models.CheckCertItem, states []models.AlertState) {
+	if c.alerts == nil {
+		return
+	}
+
+	if err := c.alerts.Record(certList, states...); err != nil {
+		log.Printf("Error saving alert states: %s", err)
+	}
+}
+
+// checkAll checks every target using a bounded pool of workers. The outcome
+// of each target is stored at the same index it has in certList.
+func (c *CheckCertJob) checkAll(certList []models.CheckCertItem) []certCheckOutcome {
+	ctx := c.context()
+
+	workers := c.workers
+	if workers <= 0 {
+		workers = defaultWorkers
+	}
+
+	outcomes := make([]certCheckOutcome, len(certList))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+
+	for range min(workers, len(certList)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := range indexes {
+				outcome := certCheckOutcome{previous: c.getPreviousResult(certList[i].Name)}
+				start := time.Now()
+				outcome.result, outcome.err = services.CheckCertStatus(ctx, certList[i], c.warningDays)
+				outcomes[i] = outcome
+
+				if c.metrics != nil {
+					c.metrics.Record(certList[i], outcome.result, outcome.err, time.Since(start))
+				}
+
+				if outcome.err == nil {
+					c.cache.Set(certList[i], outcome.result)
+				}
+			}
+		}()
+	}
+
+	for i := range certList {
+		indexes <- i
+	}
+
+	close(indexes)
+	wg.Wait()
+
+	return outcomes
+}
+
+// context is canceled when the job stops
+func (c *CheckCertJob) context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+
+	return c.ctx
 }
 
 func (c *CheckCertJob) shouldNotify(model CertCheckNotification) bool {
@@ -140,14 +398,15 @@ func (c *CheckCertJob) shouldNotify(model CertCheckNotification) bool {
 }
 
 func (c *CheckCertJob) getNotificationModel(certificate *models.CertCheckResult) CertCheckNotification {
+	// a revoked certificate is always reported at the error level
 	result := CertCheckNotification{
 		Hostname:          certificate.Hostname,
-		IsValid:           certificate.IsValid,
+		IsValid:           certificate.IsValid && certificate.RevocationStatus != services.RevocationRevoked,
 		ExpirationWarning: certificate.ExpirationWarning,
-		Messages:          certificate.ValidationIssues,
+		Messages:          slices.Clone(certificate.ValidationIssues),
 	}
 
-	if certificate.IsValid {
+	if result.IsValid {
 		days := int(time.Until(certificate.CertEndDate).Hours() / 24)
 		result.Messages = append(result.Messages, fmt.Sprintf("Certificate expires in %d days", days))
 	}
@@ -1,20 +1,24 @@
 package jobs
 
 import (
+	"fmt"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/jlucaspains/sharp-cert-manager/internal/models"
+	"github.com/jlucaspains/sharp-cert-manager/internal/services"
 	"github.com/stretchr/testify/assert"
 )
 
 type mockNotifier struct {
 	executed bool
+	result   []CertCheckNotification
 }
 
 func (m *mockNotifier) Notify(result []CertCheckNotification) error {
 	m.executed = true
+	m.result = result
 	return nil
 }
 
@@ -22,9 +26,9 @@ func (m *mockNotifier) IsReady() bool {
 	return true
 }
 
-var certList = []models.CheckCertItem{
+var certList = services.NewCertRegistry([]models.CheckCertItem{
 	{Name: "blog.lpains.net", Url: "https://blog.lpains.net", Type: models.CertCheckURL},
-}
+})
 
 func TestJobInit(t *testing.T) {
 	checkCertJob := &CheckCertJob{}
@@ -32,9 +36,9 @@ func TestJobInit(t *testing.T) {
 	checkCertJob.Init("* * * * *", "", 1, certList, &mockNotifier{})
 
 	assert.Equal(t, "* * * * *", checkCertJob.cron)
-	assert.Equal(t, "https://blog.lpains.net", checkCertJob.certList[0].Url)
-	assert.Equal(t, "blog.lpains.net", checkCertJob.certList[0].Name)
-	assert.Equal(t, models.CertCheckURL, checkCertJob.certList[0].Type)
+	assert.Equal(t, "https://blog.lpains.net", checkCertJob.certList.List()[0].Url)
+	assert.Equal(t, "blog.lpains.net", checkCertJob.certList.List()[0].Name)
+	assert.Equal(t, models.CertCheckURL, checkCertJob.certList.List()[0].Type)
 
 	checkCertJob.ticker.Stop()
 }
@@ -45,9 +49,9 @@ func TestJobInitDefaultWarningDays(t *testing.T) {
 	checkCertJob.Init("* * * * *", "", 0, certList, &mockNotifier{})
 
 	assert.Equal(t, "* * * * *", checkCertJob.cron)
-	assert.Equal(t, "blog.lpains.net", checkCertJob.certList[0].Name)
-	assert.Equal(t, "https://blog.lpains.net", checkCertJob.certList[0].Url)
-	assert.Equal(t, models.CertCheckURL, checkCertJob.certList[0].Type)
+	assert.Equal(t, "blog.lpains.net", checkCertJob.certList.List()[0].Name)
+	assert.Equal(t, "https://blog.lpains.net", checkCertJob.certList.List()[0].Url)
+	assert.Equal(t, models.CertCheckURL, checkCertJob.certList.List()[0].Type)
 	assert.Equal(t, 30, checkCertJob.warningDays)
 
 	checkCertJob.ticker.Stop()
@@ -75,9 +79,9 @@ func TestJobStartStop(t *testing.T) {
 	err := checkCertJob.Init("* * * * *", "", 0, certList, &mockNotifier{})
 	assert.Nil(t, err)
 	checkCertJob.Start()
-	assert.True(t, checkCertJob.running)
+	assert.True(t, checkCertJob.IsRunning())
 	checkCertJob.Stop()
-	assert.False(t, checkCertJob.running)
+	assert.False(t, checkCertJob.IsRunning())
 }
 
 func TestTryExecuteNotDue(t *testing.T) {
@@ -187,6 +191,27 @@ func TestGetNotificationModelValidCertWithValidationIssues(t *testing.T) {
 	assert.True(t, strings.Contains(result.Messages[2], "Certificate expires in"), "Third message should be expiration")
 }
 
+func TestGetNotificationModelKeepsValidationIssues(t *testing.T) {
+	checkCertJob := &CheckCertJob{}
+	checkCertJob.Init("* * * * *", "", 30, certList, &mockNotifier{})
+
+	// the result is shared with the cache so spare capacity must not be written
+	issues := make([]string, 1, 2)
+	issues[0] = "Issue 1"
+	cert := &models.CertCheckResult{
+		Hostname:         "test.example.com",
+		IsValid:          true,
+		CertEndDate:      time.Now().AddDate(0, 1, 0),
+		ValidationIssues: issues,
+	}
+
+	result := checkCertJob.getNotificationModel(cert)
+
+	assert.Equal(t, 2, len(result.Messages))
+	assert.Equal(t, []string{"Issue 1"}, cert.ValidationIssues)
+	assert.Empty(t, issues[:2][1])
+}
+
 func TestGetNotificationModelInvalidCert(t *testing.T) {
 	checkCertJob := &CheckCertJob{}
 	checkCertJob.Init("* * * * *", "", 30, certList, &mockNotifier{})
@@ -207,3 +232,122 @@ func TestGetNotificationModelInvalidCert(t *testing.T) {
 	assert.Equal(t, "Certificate expired", result.Messages[0])
 	assert.False(t, strings.Contains(strings.Join(result.Messages, " "), "Certificate expires in"))
 }
+
+func TestGetNotificationModelRevokedCert(t *testing.T) {
+	checkCertJob := &CheckCertJob{}
+	checkCertJob.Init("* * * * *", "Error", 30, certList, &mockNotifier{})
+
+	cert := &models.CertCheckResult{
+		Hostname:         "test.example.com",
+		IsValid:          true,
+		CertEndDate:      time.Now().AddDate(0, 1, 0),
+		ValidationIssues: []string{},
+		RevocationStatus: "Revoked",
+	}
+
+	result := checkCertJob.getNotificationModel(cert)
+
+	assert.False(t, result.IsValid)
+	assert.True(t, checkCertJob.shouldNotify(result))
+	assert.False(t, strings.Contains(strings.Join(result.Messages, " "), "Certificate expires in"))
+
+	checkCertJob.ticker.Stop()
+}
+
+func TestCheckAllKeepsOrder(t *testing.T) {
+	items := []models.CheckCertItem{}
+	for i := range 50 {
+		// non TLS urls are not probed so no network is needed
+		items = append(items, models.CheckCertItem{Name: fmt.Sprintf("host%d", i), Url: fmt.Sprintf("http://host%d", i), Type: models.CertCheckURL})
+	}
+
+	checkCertJob := &CheckCertJob{}
+	checkCertJob.Init("* * * * *", "", 30, services.NewCertRegistry(items), &mockNotifier{})
+	checkCertJob.SetWorkers(4)
+	defer checkCertJob.ticker.Stop()
+
+	outcomes := checkCertJob.checkAll(items)
+
+	assert.Len(t, outcomes, 50)
+	for i, outcome := range outcomes {
+		assert.Nil(t, outcome.err)
+		assert.Equal(t, items[i].Name, outcome.result.Hostname)
+	}
+}
+
+func TestCheckAllEmpty(t *testing.T) {
+	checkCertJob := &CheckCertJob{}
+
+	outcomes := checkCertJob.checkAll([]models.CheckCertItem{})
+
+	assert.Empty(t, outcomes)
+}
+
+func TestSetWorkers(t *testing.T) {
+	checkCertJob := &CheckCertJob{}
+	checkCertJob.Init("* * * * *", "", 30, certList, &mockNotifier{})
+	defer checkCertJob.ticker.Stop()
+
+	assert.Equal(t, 10, checkCertJob.workers)
+
+	checkCertJob.SetWorkers(3)
+	assert.Equal(t, 3, checkCertJob.workers)
+
+	checkCertJob.SetWorkers(0)
+	assert.Equal(t, 10, checkCertJob.workers)
+}
+
+func TestExecuteRecordsMetrics(t *testing.T) {
+	items := []models.CheckCertItem{
+		{Name: "host1", Url: "http://host1", Type: models.CertCheckURL},
+		{Name: "host2", Url: "http://host2", Type: models.CertCheckURL},
+	}
+	metrics := services.NewCertMetrics()
+	metrics.Record(models.CheckCertItem{Name: "removed"}, nil, nil, 0)
+
+	checkCertJob := &CheckCertJob{}
+	checkCertJob.Init("* * * * *", "", 30, services.NewCertRegistry(items), &mockNotifier{})
+	checkCertJob.SetMetrics(metrics)
+	defer checkCertJob.ticker.Stop()
+
+	checkCertJob.RunNow()
+
+	result := metrics.List()
+	assert.Len(t, result, 2)
+	assert.Equal(t, "host1", result[0].Item.Name)
+	assert.True(t, result[0].Success)
+	assert.Equal(t, "host2", result[1].Item.Name)
+}
+
+func TestExecuteRefreshesCache(t *testing.T) {
+	item := models.CheckCertItem{Name: "host1", Url: "http://host1", Type: models.CertCheckURL}
+	cache := services.NewResultCache(time.Minute)
+
+	checkCertJob := &CheckCertJob{}
+	checkCertJob.Init("* * * * *", "", 30, services.NewCertRegistry([]models.CheckCertItem{item}), &mockNotifier{})
+	checkCertJob.SetCache(cache)
+	defer checkCertJob.ticker.Stop()
+
+	checkCertJob.RunNow()
+
+	result, ok := cache.Get(item)
+	assert.True(t, ok)
+	assert.Equal(t, "host1", result.Hostname)
+}
+
+func TestExecuteAddsTargetToNotifications(t *testing.T) {
+	item := models.CheckCertItem{Name: "host1", Url: "http://host1", Type: models.CertCheckURL, Tags: []string{"public"}}
+	notifier := &mockNotifier{}
+
+	checkCertJob := &CheckCertJob{}
+	checkCertJob.Init("* * * * *", "Info", 30, services.NewCertRegistry([]models.CheckCertItem{item}), notifier)
+	defer checkCertJob.ticker.Stop()
+
+	checkCertJob.RunNow()
+
+	assert.Len(t, notifier.result, 1)
+	assert.Equal(t, "host1", notifier.result[0].Name)
+	assert.Equal(t, "http://host1", notifier.result[0].Url)
+	assert.Equal(t, []string{"public"}, notifier.result[0].Tags)
+	assert.Equal(t, "host1", notifier.result[0].Result.Hostname)
+}
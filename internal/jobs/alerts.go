@@ -0,0 +1,86 @@
+package jobs
+
+import (
+	"time"
+
+	"github.com/jlucaspains/sharp-cert-manager/internal/models"
+	"github.com/jlucaspains/sharp-cert-manager/internal/services"
+)
+
+// default days before expiration at which expiring certificates escalate
+var defaultEscalationDays = []int{30, 14, 7, 1}
+
+// SetAlerts enables stateful alerting. Targets are only notified when their
+// status changes, when an expiring certificate crosses one of the escalation
+// days or every reminder interval. A zero reminder disables reminders.
+func (c *CheckCertJob) SetAlerts(store *services.AlertStore, reminder time.Duration, escalationDays []int) {
+	if len(escalationDays) == 0 {
+		escalationDays = defaultEscalationDays
+	}
+
+	c.alerts = store
+	c.reminder = reminder
+	c.escalationDays = escalationDays
+}
+
+// getAlertStatus returns the status of the notification and the escalation
+// threshold an expiring certificate is within
+func (c *CheckCertJob) getAlertStatus(notification CertCheckNotification) (string, int) {
+	switch {
+	case !notification.IsValid:
+		return models.AlertError, 0
+	case notification.ExpirationWarning && notification.Result != nil:
+		days := int(time.Until(notification.Result.CertEndDate).Hours() / 24)
+		return models.AlertWarning, getEscalationThreshold(c.escalationDays, days)
+	case notification.ExpirationWarning:
+		return models.AlertWarning, 0
+	}
+
+	return models.AlertOK, 0
+}
+
+// getEscalationThreshold returns the smallest threshold days is within or
+// zero when it is above all of them
+func getEscalationThreshold(thresholds []int, days int) int {
+	result := 0
+	for _, threshold := range thresholds {
+		if days <= threshold && (result == 0 || threshold < result) {
+			result = threshold
+		}
+	}
+
+	return result
+}
+
+// applyAlertState decides whether the notification is sent given the last
+// alert sent for the target. It returns the notification to send, if any,
+// and the new state. A target that was alerted on and is fine again is sent
+// as resolved even when its level is not notified.
+func (c *CheckCertJob) applyAlertState(state models.AlertState, notification CertCheckNotification, notify bool, now time.Time) (*CertCheckNotification, models.AlertState) {
+	status, threshold := c.getAlertStatus(notification)
+	resolved := status == models.AlertOK && state.IsAlerting()
+
+	if !notify && !resolved {
+		return nil, state
+	}
+
+	escalated := threshold > 0 && (state.Threshold == 0 || threshold < state.Threshold)
+	reminderDue := c.reminder > 0 && now.Sub(state.NotifiedAt) >= c.reminder
+
+	// the threshold follows the certificate so a renewed one escalates again
+	if status == state.Status && !escalated && !reminderDue {
+		state.Threshold = threshold
+		return nil, state
+	}
+
+	if resolved {
+		notification.Resolved = true
+		notification.Messages = append([]string{"Alert resolved"}, notification.Messages...)
+	}
+
+	state.Status = status
+	state.Threshold = threshold
+	state.NotifiedAt = now
+
+	return &notification, state
+}
@@ -0,0 +1,165 @@
+package jobs
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jlucaspains/sharp-cert-manager/internal/models"
+	"github.com/jlucaspains/sharp-cert-manager/internal/services"
+	"github.com/stretchr/testify/assert"
+)
+
+func expiringNotification(days int) CertCheckNotification {
+	return CertCheckNotification{
+		Name:              "blog",
+		IsValid:           true,
+		ExpirationWarning: true,
+		Messages:          []string{"Certificate expires soon"},
+		Result:            &models.CertCheckResult{CertEndDate: time.Now().Add(time.Duration(days)*24*time.Hour + time.Hour)},
+	}
+}
+
+func TestGetEscalationThreshold(t *testing.T) {
+	assert.Equal(t, 0, getEscalationThreshold(defaultEscalationDays, 45))
+	assert.Equal(t, 30, getEscalationThreshold(defaultEscalationDays, 30))
+	assert.Equal(t, 14, getEscalationThreshold(defaultEscalationDays, 10))
+	assert.Equal(t, 1, getEscalationThreshold(defaultEscalationDays, 0))
+	assert.Equal(t, 1, getEscalationThreshold(defaultEscalationDays, -3))
+}
+
+func TestApplyAlertStateTransitions(t *testing.T) {
+	job := &CheckCertJob{}
+	job.SetAlerts(nil, 0, nil)
+	now := time.Now()
+
+	alert, state := job.applyAlertState(models.AlertState{Name: "blog"}, expiringNotification(20), true, now)
+
+	assert.NotNil(t, alert)
+	assert.Equal(t, models.AlertState{Name: "blog", Status: models.AlertWarning, Threshold: 30, NotifiedAt: now}, state)
+
+	// same status and threshold on the next run
+	alert, state = job.applyAlertState(state, expiringNotification(19), true, now.Add(time.Hour))
+
+	assert.Nil(t, alert)
+	assert.Equal(t, now, state.NotifiedAt)
+
+	// escalates once 14 days are left
+	alert, state = job.applyAlertState(state, expiringNotification(13), true, now.Add(2*time.Hour))
+
+	assert.NotNil(t, alert)
+	assert.Equal(t, 14, state.Threshold)
+
+	// invalid certificates are a transition to error
+	alert, state = job.applyAlertState(state, CertCheckNotification{Name: "blog", IsValid: false}, true, now.Add(3*time.Hour))
+
+	assert.NotNil(t, alert)
+	assert.Equal(t, models.AlertError, state.Status)
+	assert.Equal(t, 0, state.Threshold)
+}
+
+func TestApplyAlertStateResolved(t *testing.T) {
+	job := &CheckCertJob{}
+	job.SetAlerts(nil, 0, nil)
+	now := time.Now()
+	state := models.AlertState{Name: "blog", Status: models.AlertWarning, Threshold: 7, NotifiedAt: now.Add(-time.Hour)}
+
+	// resolutions are sent even when valid certificates are not notified
+	alert, state := job.applyAlertState(state, CertCheckNotification{Name: "blog", IsValid: true, Messages: []string{"Certificate expires in 90 days"}}, false, now)
+
+	assert.True(t, alert.Resolved)
+	assert.Equal(t, []string{"Alert resolved", "Certificate expires in 90 days"}, alert.Messages)
+	assert.Equal(t, models.AlertOK, state.Status)
+
+	alert, _ = job.applyAlertState(state, CertCheckNotification{Name: "blog", IsValid: true}, false, now.Add(time.Hour))
+
+	assert.Nil(t, alert)
+}
+
+func TestApplyAlertStateReminder(t *testing.T) {
+	job := &CheckCertJob{}
+	job.SetAlerts(nil, 24*time.Hour, []int{10})
+	now := time.Now()
+	state := models.AlertState{Name: "blog", Status: models.AlertError, NotifiedAt: now.Add(-23 * time.Hour)}
+
+	alert, _ := job.applyAlertState(state, CertCheckNotification{Name: "blog", IsValid: false}, true, now)
+	assert.Nil(t, alert)
+
+	alert, state = job.applyAlertState(state, CertCheckNotification{Name: "blog", IsValid: false}, true, now.Add(time.Hour))
+	assert.NotNil(t, alert)
+	assert.Equal(t, now.Add(time.Hour), state.NotifiedAt)
+}
+
+func TestApplyAlertStateRenewal(t *testing.T) {
+	job := &CheckCertJob{}
+	job.SetAlerts(nil, 0, nil)
+	now := time.Now()
+	state := models.AlertState{Name: "blog", Status: models.AlertWarning, Threshold: 7, NotifiedAt: now}
+
+	// renewed with a short lived certificate that is still expiring
+	alert, state := job.applyAlertState(state, expiringNotification(25), true, now)
+
+	assert.Nil(t, alert)
+	assert.Equal(t, 30, state.Threshold)
+
+	alert, _ = job.applyAlertState(state, expiringNotification(12), true, now)
+
+	assert.NotNil(t, alert)
+}
+
+func TestExecuteDeduplicatesAlerts(t *testing.T) {
+	items := []models.CheckCertItem{
+		{Name: "host1", Url: "http://host1", Type: models.CertCheckURL},
+		{Name: "host2", Url: "http://host2", Type: models.CertCheckURL},
+	}
+	store, _ := services.NewAlertStore(filepath.Join(t.TempDir(), "alerts.json"))
+	notifier := &mockNotifier{}
+
+	checkCertJob := &CheckCertJob{}
+	checkCertJob.Init("* * * * *", "Info", 30, services.NewCertRegistry(items), notifier)
+	checkCertJob.SetAlerts(store, 0, nil)
+	defer checkCertJob.ticker.Stop()
+
+	checkCertJob.RunNow()
+
+	assert.Len(t, notifier.result, 2)
+	assert.Equal(t, models.AlertError, store.Get("host1").Status)
+
+	notifier.executed = false
+	checkCertJob.RunNow()
+
+	assert.False(t, notifier.executed)
+
+	store.Record(items, models.AlertState{Name: "host1", Status: models.AlertOK}, models.AlertState{Name: "host2", Status: models.AlertOK})
+	store.Snooze("host2", time.Now().Add(time.Hour), "jane", "renewal scheduled")
+	checkCertJob.RunNow()
+
+	assert.Len(t, notifier.result, 1)
+	assert.Equal(t, "host1", notifier.result[0].Name)
+	assert.Equal(t, models.AlertOK, store.Get("host2").Status)
+}
+
+func TestExecuteRecordsAlertsWhenSomeChannelsFail(t *testing.T) {
+	items := []models.CheckCertItem{{Name: "host1", Url: "http://host1", Type: models.CertCheckURL}}
+	store, _ := services.NewAlertStore(filepath.Join(t.TempDir(), "alerts.json"))
+	delivered := &mockNotifier{}
+	notifier := &CompositeNotifier{Channels: []NotifierChannel{
+		{Name: "teams", Notifier: &failingNotifier{}},
+		{Name: "slack", Notifier: delivered},
+	}}
+
+	checkCertJob := &CheckCertJob{}
+	checkCertJob.Init("* * * * *", "Info", 30, services.NewCertRegistry(items), notifier)
+	checkCertJob.SetAlerts(store, 0, nil)
+	defer checkCertJob.ticker.Stop()
+
+	checkCertJob.RunNow()
+
+	assert.Len(t, delivered.result, 1)
+	assert.Equal(t, models.AlertError, store.Get("host1").Status)
+
+	delivered.executed = false
+	checkCertJob.RunNow()
+
+	assert.False(t, delivered.executed)
+}
@@ -0,0 +1,108 @@
+package jobs
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/jlucaspains/sharp-cert-manager/internal/models"
+	"github.com/jlucaspains/sharp-cert-manager/internal/services"
+)
+
+// getPreviousResult returns the result of the last run for name. After a
+// restart it falls back to the last successful check in the history store.
+func (c *CheckCertJob) getPreviousResult(name string) *models.CertCheckResult {
+	c.previousLock.Lock()
+	previous, ok := c.previousResults[name]
+	c.previousLock.Unlock()
+
+	if ok {
+		return previous
+	}
+
+	entries, err := services.GetCertHistory(name, 10)
+
+	if err != nil {
+		return nil
+	}
+
+	for _, entry := range entries {
+		if entry.Error == "" && entry.Result.Fingerprint != "" {
+			return &entry.Result
+		}
+	}
+
+	return nil
+}
+
+func (c *CheckCertJob) setPreviousResult(name string, result *models.CertCheckResult) {
+	c.previousLock.Lock()
+	defer c.previousLock.Unlock()
+
+	if c.previousResults == nil {
+		c.previousResults = map[string]*models.CertCheckResult{}
+	}
+
+	c.previousResults[name] = result
+}
+
+func (c *CheckCertJob) shouldNotifyChange() bool {
+	return c.changeLevel >= c.level
+}
+
+// getChangeNotificationModel compares the leaf fingerprints of both results
+// and describes what changed. It returns false when the certificate is the same.
+func (c *CheckCertJob) getChangeNotificationModel(previous *models.CertCheckResult, current *models.CertCheckResult) (CertCheckNotification, bool) {
+	if previous == nil || previous.Fingerprint == "" || current.Fingerprint == "" || previous.Fingerprint == current.Fingerprint {
+		return CertCheckNotification{}, false
+	}
+
+	return CertCheckNotification{
+		Hostname: current.Hostname,
+		IsValid:  current.IsValid,
+		Changed:  true,
+		Messages: getCertChanges(previous, current),
+	}, true
+}
+
+func getCertChanges(previous *models.CertCheckResult, current *models.CertCheckResult) []string {
+	result := []string{fmt.Sprintf("Certificate changed, serial %s replaced by %s", previous.SerialNumber, current.SerialNumber)}
+
+	if previous.Issuer != current.Issuer {
+		result = append(result, fmt.Sprintf("Issuer changed from %s to %s", previous.Issuer, current.Issuer))
+	}
+
+	if added := getMissingNames(current.CertDnsNames, previous.CertDnsNames); len(added) > 0 {
+		result = append(result, fmt.Sprintf("SANs added: %s", strings.Join(added, ", ")))
+	}
+
+	if removed := getMissingNames(previous.CertDnsNames, current.CertDnsNames); len(removed) > 0 {
+		result = append(result, fmt.Sprintf("SANs removed: %s", strings.Join(removed, ", ")))
+	}
+
+	if !previous.CertStartDate.Equal(current.CertStartDate) || !previous.CertEndDate.Equal(current.CertEndDate) {
+		result = append(result, fmt.Sprintf("Validity changed from %s to %s", getValidityRange(previous), getValidityRange(current)))
+	}
+
+	if previous.KeyType != current.KeyType {
+		result = append(result, fmt.Sprintf("Key type changed from %s to %s", previous.KeyType, current.KeyType))
+	}
+
+	return result
+}
+
+// getMissingNames returns the names in source that are not in target
+func getMissingNames(source []string, target []string) []string {
+	result := []string{}
+	for _, name := range source {
+		if !slices.Contains(target, name) {
+			result = append(result, name)
+		}
+	}
+
+	return result
+}
+
+func getValidityRange(result *models.CertCheckResult) string {
+	return fmt.Sprintf("%s - %s", result.CertStartDate.Format("Jan 02, 2006"), result.CertEndDate.Format("Jan 02, 2006"))
+}
@@ -0,0 +1,106 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jlucaspains/sharp-cert-manager/internal/models"
+	"github.com/jlucaspains/sharp-cert-manager/internal/services"
+	"github.com/stretchr/testify/assert"
+)
+
+func getChangeTestResult(fingerprint string, serial string) *models.CertCheckResult {
+	return &models.CertCheckResult{
+		Hostname:      "test.example.com",
+		IsValid:       true,
+		Fingerprint:   fingerprint,
+		SerialNumber:  serial,
+		Issuer:        "Test CA",
+		CertDnsNames:  []string{"test.example.com", "www.example.com"},
+		CertStartDate: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		CertEndDate:   time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC),
+		KeyType:       "RSA 2048",
+	}
+}
+
+func TestGetChangeNotificationModelSameCert(t *testing.T) {
+	checkCertJob := &CheckCertJob{}
+
+	_, changed := checkCertJob.getChangeNotificationModel(getChangeTestResult("a", "01"), getChangeTestResult("a", "01"))
+
+	assert.False(t, changed)
+}
+
+func TestGetChangeNotificationModelNoPrevious(t *testing.T) {
+	checkCertJob := &CheckCertJob{}
+
+	_, changed := checkCertJob.getChangeNotificationModel(nil, getChangeTestResult("a", "01"))
+
+	assert.False(t, changed)
+}
+
+func TestGetChangeNotificationModelRenewed(t *testing.T) {
+	checkCertJob := &CheckCertJob{}
+	current := getChangeTestResult("b", "02")
+	current.CertStartDate = time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	current.CertEndDate = time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	result, changed := checkCertJob.getChangeNotificationModel(getChangeTestResult("a", "01"), current)
+
+	assert.True(t, changed)
+	assert.True(t, result.Changed)
+	assert.True(t, result.IsValid)
+	assert.Equal(t, "test.example.com", result.Hostname)
+	assert.Equal(t, []string{
+		"Certificate changed, serial 01 replaced by 02",
+		"Validity changed from Jan 01, 2026 - Apr 01, 2026 to Mar 01, 2026 - Jun 01, 2026",
+	}, result.Messages)
+}
+
+func TestGetCertChangesIssuerSANsAndKey(t *testing.T) {
+	current := getChangeTestResult("b", "02")
+	current.Issuer = "Other CA"
+	current.CertDnsNames = []string{"test.example.com", "api.example.com"}
+	current.KeyType = "ECDSA P-256"
+
+	result := getCertChanges(getChangeTestResult("a", "01"), current)
+
+	assert.Equal(t, []string{
+		"Certificate changed, serial 01 replaced by 02",
+		"Issuer changed from Test CA to Other CA",
+		"SANs added: api.example.com",
+		"SANs removed: www.example.com",
+		"Key type changed from RSA 2048 to ECDSA P-256",
+	}, result)
+}
+
+func TestShouldNotifyChange(t *testing.T) {
+	checkCertJob := &CheckCertJob{}
+	checkCertJob.Init("* * * * *", "Warning", 30, certList, &mockNotifier{})
+	defer checkCertJob.ticker.Stop()
+
+	assert.True(t, checkCertJob.shouldNotifyChange())
+
+	checkCertJob.SetChangeLevel("Info")
+	assert.False(t, checkCertJob.shouldNotifyChange())
+
+	checkCertJob.SetChangeLevel("Error")
+	assert.True(t, checkCertJob.shouldNotifyChange())
+}
+
+func TestGetPreviousResultFromHistory(t *testing.T) {
+	store := services.NewMemoryHistoryStore(10)
+	store.Record(models.CertHistoryEntry{Name: "test.example.com", Result: *getChangeTestResult("a", "01")})
+	store.Record(models.CertHistoryEntry{Name: "test.example.com", Error: "connection refused"})
+	services.SetHistoryStore(store)
+	defer services.SetHistoryStore(nil)
+
+	checkCertJob := &CheckCertJob{}
+
+	assert.Equal(t, "a", checkCertJob.getPreviousResult("test.example.com").Fingerprint)
+
+	checkCertJob.setPreviousResult("test.example.com", getChangeTestResult("b", "02"))
+
+	assert.Equal(t, "b", checkCertJob.getPreviousResult("test.example.com").Fingerprint)
+	assert.Nil(t, checkCertJob.getPreviousResult("other.example.com"))
+}
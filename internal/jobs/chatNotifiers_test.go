@@ -0,0 +1,164 @@
+package jobs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var chatTestItems = []CertCheckNotification{
+	{Hostname: "blog", Name: "blog", IsValid: false, Messages: []string{"Certificate \"expired\""}, Tags: []string{"public"}},
+	{Hostname: "mail", Name: "mail", IsValid: true, ExpirationWarning: true, Messages: []string{"Certificate expires in 5 days"}},
+	{Hostname: "shop", Name: "shop", IsValid: true, Resolved: true, Messages: []string{"Alert resolved"}},
+}
+
+// notifyAll sends items with a new notifier of the type and returns the
+// decoded request bodies
+func notifyAll(t *testing.T, notifierType NotifierType, mentions string, items []CertCheckNotification) []map[string]any {
+	mux := http.NewServeMux()
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	result := []map[string]any{}
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		buf := new(bytes.Buffer)
+		buf.ReadFrom(r.Body)
+
+		body := map[string]any{}
+		assert.Nil(t, json.Unmarshal(buf.Bytes(), &body), buf.String())
+		result = append(result, body)
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	notifier := &WebHookNotifier{}
+	notifier.Init(notifierType, ts.URL, "Certs <daily>", "Checked today", "https://certs.lpains.net", mentions)
+	notifier.SetRoutingKey("R0UT1NGK3Y")
+	err := notifier.Notify(items)
+
+	assert.Nil(t, err)
+
+	return result
+}
+
+func TestDiscordWebHookNotifier(t *testing.T) {
+	result := notifyAll(t, Discord, "80351110224678912", chatTestItems)
+
+	assert.Len(t, result, 1)
+	assert.Equal(t, "Certs <daily> <@80351110224678912>", result[0]["content"])
+
+	embed := result[0]["embeds"].([]any)[0].(map[string]any)
+	assert.Equal(t, "https://certs.lpains.net", embed["url"])
+	assert.Equal(t, float64(15158332), embed["color"])
+
+	fields := embed["fields"].([]any)
+	assert.Len(t, fields, 3)
+	assert.Equal(t, map[string]any{"name": "❌ blog", "value": "Certificate \"expired\""}, fields[0])
+	assert.Equal(t, "✅ shop", fields[2].(map[string]any)["name"])
+}
+
+func TestDiscordWebHookNotifierLimitsFields(t *testing.T) {
+	items := []CertCheckNotification{}
+	for i := range 30 {
+		items = append(items, CertCheckNotification{Hostname: fmt.Sprintf("host%d", i), IsValid: true})
+	}
+
+	result := notifyAll(t, Discord, "", items)
+
+	embed := result[0]["embeds"].([]any)[0].(map[string]any)
+	assert.Len(t, embed["fields"], 25)
+	assert.Equal(t, float64(3066993), embed["color"])
+	assert.Equal(t, "30 certificates, showing the first 25", embed["footer"].(map[string]any)["text"])
+}
+
+func TestGoogleChatWebHookNotifier(t *testing.T) {
+	result := notifyAll(t, GoogleChat, "all", chatTestItems)
+
+	assert.Len(t, result, 1)
+	assert.Equal(t, "Certs <daily> <users/all>", result[0]["text"])
+
+	card := result[0]["cardsV2"].([]any)[0].(map[string]any)["card"].(map[string]any)
+	assert.Equal(t, "Checked today", card["header"].(map[string]any)["subtitle"])
+
+	sections := card["sections"].([]any)
+	widgets := sections[0].(map[string]any)["widgets"].([]any)
+	assert.Len(t, widgets, 3)
+	assert.Equal(t, "⚠️ mail", widgets[1].(map[string]any)["decoratedText"].(map[string]any)["topLabel"])
+	assert.Contains(t, fmt.Sprint(sections[1]), "https://certs.lpains.net")
+}
+
+func TestMattermostWebHookNotifier(t *testing.T) {
+	result := notifyAll(t, Mattermost, "ops,sec", chatTestItems)
+
+	assert.Len(t, result, 1)
+	assert.Equal(t, "#### Certs <daily>\n@ops @sec Checked today\n\n| | Certificate | Details |\n|:-:|:--|:--|\n"+
+		"| :x: | blog | Certificate \"expired\" |\n"+
+		"| :warning: | mail | Certificate expires in 5 days |\n"+
+		"| :white_check_mark: | shop | Alert resolved |\n"+
+		"\n[View details](https://certs.lpains.net)", result[0]["text"])
+}
+
+func TestPagerDutyWebHookNotifier(t *testing.T) {
+	items := append(chatTestItems, CertCheckNotification{Hostname: "blog", Name: "blog", IsValid: true, Changed: true})
+
+	result := notifyAll(t, PagerDuty, "", items)
+
+	assert.Len(t, result, 3)
+	assert.Equal(t, "R0UT1NGK3Y", result[0]["routing_key"])
+	assert.Equal(t, "trigger", result[0]["event_action"])
+	assert.Equal(t, "blog", result[0]["dedup_key"])
+	assert.Equal(t, "critical", result[0]["payload"].(map[string]any)["severity"])
+	assert.Equal(t, "blog: Certificate \"expired\"", result[0]["payload"].(map[string]any)["summary"])
+	assert.Equal(t, []any{"public"}, result[0]["payload"].(map[string]any)["custom_details"].(map[string]any)["tags"])
+
+	assert.Equal(t, "trigger", result[1]["event_action"])
+	assert.Equal(t, "warning", result[1]["payload"].(map[string]any)["severity"])
+
+	assert.Equal(t, "resolve", result[2]["event_action"])
+	assert.Equal(t, "shop", result[2]["dedup_key"])
+}
+
+func TestPagerDutyWebHookNotifierResolve(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		body := map[string]any{}
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, "resolve", body["event_action"])
+		assert.Equal(t, "web", body["dedup_key"])
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer ts.Close()
+
+	notifier := &WebHookNotifier{}
+	notifier.Init(PagerDuty, ts.URL, "", "", "", "")
+	notifier.SetRoutingKey("R0UT1NGK3Y")
+
+	err := notifier.Resolve([]CertCheckNotification{{Hostname: "web", Name: "web", IsValid: true, Messages: []string{"Certificate expires in 90 days"}}})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 1, requests)
+}
+
+func TestSlackWebHookNotifierResolve(t *testing.T) {
+	notifier := &WebHookNotifier{}
+	notifier.Init(Slack, "http://localhost:0", "", "", "", "")
+
+	assert.Nil(t, notifier.Resolve([]CertCheckNotification{{Hostname: "web", Name: "web", IsValid: true}}))
+}
+
+func TestPagerDutyWebHookNotifierDefaults(t *testing.T) {
+	notifier := &WebHookNotifier{}
+	notifier.Init(PagerDuty, "", "", "", "", "")
+
+	assert.Equal(t, "https://events.pagerduty.com/v2/enqueue", notifier.WebhookUrl)
+	assert.False(t, notifier.IsReady())
+
+	notifier.SetRoutingKey("R0UT1NGK3Y")
+
+	assert.True(t, notifier.IsReady())
+}
@@ -0,0 +1,196 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/jlucaspains/sharp-cert-manager/internal/models"
+)
+
+// NotifierChannel is a notifier that only receives the items matching its
+// rules. A channel without rules receives every item.
+type NotifierChannel struct {
+	Name     string
+	Notifier Notifier
+	Rules    []models.NotificationRule
+}
+
+// ErrPartialDelivery wraps the errors of the failing channels when other
+// channels were notified
+var ErrPartialDelivery = errors.New("some channels were not notified")
+
+// CompositeNotifier fans notifications out to several channels at the same
+// time. A failing or slow channel does not prevent the others from being
+// notified; their errors are joined.
+type CompositeNotifier struct {
+	Channels []NotifierChannel
+}
+
+func (m *CompositeNotifier) Notify(result []CertCheckNotification) error {
+	errs := make([]error, len(m.Channels))
+	delivered := make([]bool, len(m.Channels))
+	var wg sync.WaitGroup
+
+	for i, channel := range m.Channels {
+		items := channel.filter(result)
+
+		// routed channels are only notified about their own targets
+		if len(channel.Rules) > 0 && len(items) == 0 {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if err := channel.Notifier.Notify(items); err != nil {
+				log.Printf("Error sending notification to channel %s: %s", channel.Name, err)
+				errs[i] = fmt.Errorf("channel %s: %w", channel.Name, err)
+				return
+			}
+
+			delivered[i] = true
+		}()
+	}
+
+	wg.Wait()
+
+	err := errors.Join(errs...)
+	if err != nil && slices.Contains(delivered, true) {
+		return fmt.Errorf("%w: %w", ErrPartialDelivery, err)
+	}
+
+	return err
+}
+
+// Resolve gives the targets to the channels that close incidents. Severity
+// rules are ignored so a channel only routed errors still resolves them.
+func (m *CompositeNotifier) Resolve(result []CertCheckNotification) error {
+	errs := []error{}
+
+	for _, channel := range m.Channels {
+		resolver, ok := channel.Notifier.(Resolver)
+
+		if !ok {
+			continue
+		}
+
+		items := []CertCheckNotification{}
+		for _, item := range result {
+			if len(channel.Rules) == 0 || slices.ContainsFunc(channel.Rules, func(rule models.NotificationRule) bool {
+				rule.Severities = nil
+				return ruleMatches(rule, item)
+			}) {
+				items = append(items, item)
+			}
+		}
+
+		if len(items) == 0 {
+			continue
+		}
+
+		if err := resolver.Resolve(items); err != nil {
+			errs = append(errs, fmt.Errorf("channel %s: %w", channel.Name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (m *CompositeNotifier) IsReady() bool {
+	return len(m.Channels) > 0 && !slices.ContainsFunc(m.Channels, func(channel NotifierChannel) bool {
+		return channel.Notifier == nil || !channel.Notifier.IsReady()
+	})
+}
+
+func (c NotifierChannel) filter(result []CertCheckNotification) []CertCheckNotification {
+	if len(c.Rules) == 0 {
+		return result
+	}
+
+	items := []CertCheckNotification{}
+	for _, item := range result {
+		if slices.ContainsFunc(c.Rules, func(rule models.NotificationRule) bool { return ruleMatches(rule, item) }) {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+func ruleMatches(rule models.NotificationRule, item CertCheckNotification) bool {
+	name := item.Name
+	if name == "" {
+		name = item.Hostname
+	}
+
+	tagMatches := len(rule.Tags) == 0 || slices.ContainsFunc(rule.Tags, func(tag string) bool { return slices.Contains(item.Tags, tag) })
+	nameMatches := len(rule.Names) == 0 || slices.ContainsFunc(rule.Names, func(pattern string) bool {
+		matched, _ := path.Match(pattern, name)
+		return matched
+	})
+	severityMatches := len(rule.Severities) == 0 || slices.Contains(rule.Severities, item.Severity())
+
+	return tagMatches && nameMatches && severityMatches
+}
+
+// NewChannelNotifier builds the notifier of a configured channel and parses
+// its template
+func NewChannelNotifier(config models.NotificationChannelConfig) (Notifier, error) {
+	for _, rule := range config.Rules {
+		for _, pattern := range rule.Names {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("channel %s: invalid name pattern %s", config.Name, pattern)
+			}
+		}
+	}
+
+	if config.Type == "email" {
+		tlsMode := EmailTLSModes[config.SMTP.TLS]
+		result := &EmailNotifier{}
+		result.Init(config.SMTP.Host, config.SMTP.Port, config.SMTP.Username, config.SMTP.Password, config.SMTP.From,
+			strings.Join(config.SMTP.To, ","), tlsMode, config.Title, config.Body, config.NotificationUrl)
+
+		return result, nil
+	}
+
+	result := &WebHookNotifier{}
+	result.Init(Notifiers[config.Type], config.Url, config.Title, config.Body, config.NotificationUrl, strings.Join(config.Mentions, ","))
+	result.SetRequest(config.Method, config.Headers, config.ContentType)
+	result.SetRoutingKey(config.RoutingKey)
+
+	var err error
+	if config.Type == "custom" {
+		err = result.LoadTemplate(config.Template)
+	} else {
+		err = result.ParseTemplate()
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("channel %s: %w", config.Name, err)
+	}
+
+	return result, nil
+}
+
+// NewCompositeNotifier builds a channel for every configured one
+func NewCompositeNotifier(config models.NotificationsConfig) (*CompositeNotifier, error) {
+	result := &CompositeNotifier{}
+
+	for _, channelConfig := range config.Channels {
+		notifier, err := NewChannelNotifier(channelConfig)
+
+		if err != nil {
+			return nil, err
+		}
+
+		result.Channels = append(result.Channels, NotifierChannel{Name: channelConfig.Name, Notifier: notifier, Rules: channelConfig.Rules})
+	}
+
+	return result, nil
+}
@@ -0,0 +1,154 @@
+package jobs
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jlucaspains/sharp-cert-manager/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+type failingNotifier struct{}
+
+func (m *failingNotifier) Notify(result []CertCheckNotification) error {
+	return errors.New("connection refused")
+}
+
+func (m *failingNotifier) IsReady() bool {
+	return true
+}
+
+func TestCompositeNotifierRoutesItems(t *testing.T) {
+	all, public, critical, untouched := &mockNotifier{}, &mockNotifier{}, &mockNotifier{}, &mockNotifier{}
+	notifier := &CompositeNotifier{Channels: []NotifierChannel{
+		{Name: "all", Notifier: all},
+		{Name: "public", Notifier: public, Rules: []models.NotificationRule{{Tags: []string{"public"}}}},
+		{Name: "critical", Notifier: critical, Rules: []models.NotificationRule{
+			{Names: []string{"prod-*"}, Severities: []string{"error"}},
+			{Tags: []string{"payments"}},
+		}},
+		{Name: "untouched", Notifier: untouched, Rules: []models.NotificationRule{{Tags: []string{"internal"}}}},
+	}}
+
+	items := []CertCheckNotification{
+		{Hostname: "blog", Name: "blog", IsValid: true, ExpirationWarning: true, Tags: []string{"public"}},
+		{Hostname: "api", Name: "prod-api", IsValid: false},
+		{Hostname: "pay", Name: "prod-pay", IsValid: true, Tags: []string{"payments"}},
+		{Hostname: "prod-mail", IsValid: true},
+	}
+
+	err := notifier.Notify(items)
+
+	assert.Nil(t, err)
+	assert.Equal(t, items, all.result)
+	assert.Equal(t, []CertCheckNotification{items[0]}, public.result)
+	assert.Equal(t, []CertCheckNotification{items[1], items[2]}, critical.result)
+	assert.False(t, untouched.executed)
+}
+
+func TestCompositeNotifierFailingChannel(t *testing.T) {
+	other := &mockNotifier{}
+	notifier := &CompositeNotifier{Channels: []NotifierChannel{
+		{Name: "teams", Notifier: &failingNotifier{}},
+		{Name: "slack", Notifier: other},
+	}}
+
+	err := notifier.Notify([]CertCheckNotification{{Hostname: "blog", IsValid: true}})
+
+	assert.ErrorIs(t, err, ErrPartialDelivery)
+	assert.Equal(t, "some channels were not notified: channel teams: connection refused", err.Error())
+	assert.True(t, other.executed)
+}
+
+func TestCompositeNotifierAllChannelsFailing(t *testing.T) {
+	notifier := &CompositeNotifier{Channels: []NotifierChannel{
+		{Name: "teams", Notifier: &failingNotifier{}},
+		{Name: "slack", Notifier: &mockNotifier{}, Rules: []models.NotificationRule{{Tags: []string{"internal"}}}},
+	}}
+
+	err := notifier.Notify([]CertCheckNotification{{Hostname: "blog", IsValid: true}})
+
+	assert.NotErrorIs(t, err, ErrPartialDelivery)
+	assert.Equal(t, "channel teams: connection refused", err.Error())
+}
+
+type resolvingNotifier struct {
+	mockNotifier
+	resolved []CertCheckNotification
+}
+
+func (m *resolvingNotifier) Resolve(result []CertCheckNotification) error {
+	m.resolved = result
+	return nil
+}
+
+func TestCompositeNotifierResolve(t *testing.T) {
+	oncall, payments, other := &resolvingNotifier{}, &resolvingNotifier{}, &mockNotifier{}
+	notifier := &CompositeNotifier{Channels: []NotifierChannel{
+		{Name: "oncall", Notifier: oncall, Rules: []models.NotificationRule{{Names: []string{"prod-*"}, Severities: []string{"error"}}}},
+		{Name: "payments", Notifier: payments, Rules: []models.NotificationRule{{Tags: []string{"payments"}}}},
+		{Name: "teams", Notifier: other},
+	}}
+
+	items := []CertCheckNotification{
+		{Hostname: "api", Name: "prod-api", IsValid: true},
+		{Hostname: "blog", Name: "blog", IsValid: true},
+	}
+
+	err := notifier.Resolve(items)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []CertCheckNotification{items[0]}, oncall.resolved)
+	assert.Nil(t, payments.resolved)
+	assert.False(t, other.executed)
+}
+
+func TestCompositeNotifierIsReady(t *testing.T) {
+	assert.False(t, (&CompositeNotifier{}).IsReady())
+	assert.False(t, (&CompositeNotifier{Channels: []NotifierChannel{{Name: "email", Notifier: &EmailNotifier{}}}}).IsReady())
+	assert.True(t, (&CompositeNotifier{Channels: []NotifierChannel{{Name: "mock", Notifier: &mockNotifier{}}}}).IsReady())
+}
+
+func TestNewCompositeNotifier(t *testing.T) {
+	mux := http.NewServeMux()
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	received := 0
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		received++
+	})
+
+	notifier, err := NewCompositeNotifier(models.NotificationsConfig{Channels: []models.NotificationChannelConfig{
+		{Name: "teams", Type: "teams", Url: ts.URL, Mentions: []string{"ops@lpains.net"}},
+		{Name: "email", Type: "email", SMTP: &models.SMTPConfig{Host: "smtp.lpains.net", From: "certs@lpains.net", To: []string{"ops@lpains.net"}, TLS: "tls"}},
+		{Name: "oncall", Type: "pagerduty", RoutingKey: "R0UT1NGK3Y"},
+	}})
+
+	assert.Nil(t, err)
+	assert.True(t, notifier.IsReady())
+	assert.Equal(t, Teams, notifier.Channels[0].Notifier.(*WebHookNotifier).NotifierType)
+	assert.Equal(t, 465, notifier.Channels[1].Notifier.(*EmailNotifier).Port)
+	assert.Equal(t, "R0UT1NGK3Y", notifier.Channels[2].Notifier.(*WebHookNotifier).RoutingKey)
+
+	err = notifier.Channels[0].Notifier.Notify([]CertCheckNotification{{Hostname: "blog", IsValid: true}})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 1, received)
+}
+
+func TestNewCompositeNotifierInvalid(t *testing.T) {
+	_, err := NewCompositeNotifier(models.NotificationsConfig{Channels: []models.NotificationChannelConfig{
+		{Name: "teams", Type: "teams", Url: "http://localhost", Rules: []models.NotificationRule{{Names: []string{"prod-["}}}},
+	}})
+
+	assert.Equal(t, "channel teams: invalid name pattern prod-[", err.Error())
+
+	_, err = NewCompositeNotifier(models.NotificationsConfig{Channels: []models.NotificationChannelConfig{
+		{Name: "incidents", Type: "custom", Url: "http://localhost", Template: "missing.tmpl"},
+	}})
+
+	assert.ErrorContains(t, err, "channel incidents: open missing.tmpl")
+}
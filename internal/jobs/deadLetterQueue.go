@@ -0,0 +1,199 @@
+package jobs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+var ErrDeadLetterReplaying = errors.New("dead letter is already being replayed")
+
+var deadLetterIDPattern = regexp.MustCompile(`^[0-9A-Za-z-]+$`)
+
+// DeadLetter is a webhook delivery that failed after all retries
+type DeadLetter struct {
+	WebhookDelivery
+	ID        string    `json:"id"`
+	Error     string    `json:"error"`
+	Attempts  int       `json:"attempts"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// DeadLetterQueue keeps failed deliveries as JSON files in a directory until
+// they are replayed. Files may contain webhook secrets so they are only
+// readable by the owner.
+type DeadLetterQueue struct {
+	Policy     RetryPolicy
+	dir        string
+	httpClient *http.Client
+	replaying  map[string]bool
+	lock       sync.Mutex
+}
+
+func NewDeadLetterQueue(dir string, policy RetryPolicy) (*DeadLetterQueue, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	return &DeadLetterQueue{dir: dir, Policy: policy, httpClient: &http.Client{}, replaying: map[string]bool{}}, nil
+}
+
+func (q *DeadLetterQueue) Add(delivery WebhookDelivery, attempts int, deliveryErr error) (DeadLetter, error) {
+	id := make([]byte, 4)
+	rand.Read(id)
+
+	now := time.Now().UTC()
+	letter := DeadLetter{
+		WebhookDelivery: delivery,
+		ID:              now.Format("20060102T150405") + "-" + hex.EncodeToString(id),
+		Error:           deliveryErr.Error(),
+		Attempts:        attempts,
+		CreatedAt:       now,
+	}
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return letter, q.write(letter)
+}
+
+// List returns the dead letters from the oldest to the newest
+func (q *DeadLetterQueue) List() ([]DeadLetter, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	files, err := filepath.Glob(filepath.Join(q.dir, "*.json"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := []DeadLetter{}
+	for _, file := range files {
+		letter, err := q.read(strings.TrimSuffix(filepath.Base(file), ".json"))
+
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, letter)
+	}
+
+	slices.SortFunc(result, func(a, b DeadLetter) int { return a.CreatedAt.Compare(b.CreatedAt) })
+
+	return result, nil
+}
+
+// Replay sends a dead letter again and removes it once delivered. A failed
+// replay keeps the letter with the new error. The queue is not locked while
+// the letter is sent so a slow endpoint does not hold up new dead letters.
+func (q *DeadLetterQueue) Replay(id string) error {
+	letter, err := q.claim(id)
+
+	if err != nil {
+		return err
+	}
+
+	attempts, err := q.Policy.send(q.httpClient, letter.WebhookDelivery)
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	delete(q.replaying, id)
+
+	if err != nil {
+		letter.Error = err.Error()
+		letter.Attempts += attempts
+
+		return errors.Join(err, q.write(letter))
+	}
+
+	return os.Remove(q.path(id))
+}
+
+// claim reads a dead letter and marks it as being replayed
+func (q *DeadLetterQueue) claim(id string) (DeadLetter, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.replaying[id] {
+		return DeadLetter{}, ErrDeadLetterReplaying
+	}
+
+	letter, err := q.read(id)
+
+	if err != nil {
+		return letter, err
+	}
+
+	q.replaying[id] = true
+
+	return letter, nil
+}
+
+// ReplayAll replays every dead letter and returns how many were delivered
+func (q *DeadLetterQueue) ReplayAll() (int, error) {
+	letters, err := q.List()
+
+	if err != nil {
+		return 0, err
+	}
+
+	replayed := 0
+	errs := []error{}
+	for _, letter := range letters {
+		if err := q.Replay(letter.ID); err != nil {
+			errs = append(errs, fmt.Errorf("dead letter %s: %w", letter.ID, err))
+			continue
+		}
+
+		replayed++
+	}
+
+	return replayed, errors.Join(errs...)
+}
+
+func (q *DeadLetterQueue) read(id string) (DeadLetter, error) {
+	letter := DeadLetter{}
+
+	if !deadLetterIDPattern.MatchString(id) {
+		return letter, ErrDeadLetterNotFound
+	}
+
+	content, err := os.ReadFile(q.path(id))
+
+	if errors.Is(err, os.ErrNotExist) {
+		return letter, ErrDeadLetterNotFound
+	}
+
+	if err != nil {
+		return letter, err
+	}
+
+	return letter, json.Unmarshal(content, &letter)
+}
+
+func (q *DeadLetterQueue) write(letter DeadLetter) error {
+	content, err := json.MarshalIndent(letter, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(q.path(letter.ID), content, 0600)
+}
+
+func (q *DeadLetterQueue) path(id string) string {
+	return filepath.Join(q.dir, id+".json")
+}
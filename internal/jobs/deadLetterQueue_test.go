@@ -0,0 +1,148 @@
+package jobs
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebHookNotifierDeadLetter(t *testing.T) {
+	noRetrySleep(t)
+	mux := http.NewServeMux()
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	calls := 0
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadGateway)
+	})
+
+	queue, err := NewDeadLetterQueue(t.TempDir(), RetryPolicy{Retries: 2})
+	assert.Nil(t, err)
+
+	notifier := &WebHookNotifier{}
+	notifier.Init(Slack, ts.URL, "Summary", "", "", "")
+	notifier.SetRequest("", map[string]string{"Authorization": "Bearer abc"}, "")
+	notifier.SetDelivery(RetryPolicy{Retries: 2}, queue)
+	err = notifier.Notify([]CertCheckNotification{{Hostname: "blog", IsValid: true}})
+
+	assert.Equal(t, "error sending notification to Slack", err.Error())
+	assert.Equal(t, 3, calls)
+
+	letters, err := queue.List()
+
+	assert.Nil(t, err)
+	assert.Len(t, letters, 1)
+	assert.Equal(t, "Slack", letters[0].Notifier)
+	assert.Equal(t, "POST", letters[0].Method)
+	assert.Equal(t, ts.URL, letters[0].Url)
+	assert.Equal(t, map[string]string{"Authorization": "Bearer abc", "Content-Type": "application/json"}, letters[0].Headers)
+	assert.Contains(t, letters[0].Body, "Summary")
+	assert.Equal(t, 3, letters[0].Attempts)
+	assert.Equal(t, "error sending notification to Slack", letters[0].Error)
+
+	info, err := os.Stat(queue.path(letters[0].ID))
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
+
+func TestDeadLetterQueueReplay(t *testing.T) {
+	noRetrySleep(t)
+	mux := http.NewServeMux()
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	healthy := false
+	var body, token string
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if !healthy {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		buf := new(bytes.Buffer)
+		buf.ReadFrom(r.Body)
+		body, token = buf.String(), r.Header.Get("Authorization")
+	})
+
+	queue, _ := NewDeadLetterQueue(t.TempDir(), RetryPolicy{})
+	delivery := WebhookDelivery{Notifier: "webhook", Method: "PUT", Url: ts.URL, Headers: map[string]string{"Authorization": "Bearer abc"}, Body: `{"ok": true}`}
+	letter, err := queue.Add(delivery, 4, assert.AnError)
+	assert.Nil(t, err)
+
+	err = queue.Replay(letter.ID)
+	assert.Equal(t, "error sending notification to webhook", err.Error())
+
+	letters, _ := queue.List()
+	assert.Equal(t, 5, letters[0].Attempts)
+
+	healthy = true
+	err = queue.Replay(letter.ID)
+
+	assert.Nil(t, err)
+	assert.Equal(t, `{"ok": true}`, body)
+	assert.Equal(t, "Bearer abc", token)
+
+	letters, _ = queue.List()
+	assert.Empty(t, letters)
+	assert.Equal(t, ErrDeadLetterNotFound, queue.Replay(letter.ID))
+	assert.Equal(t, ErrDeadLetterNotFound, queue.Replay("../targets"))
+}
+
+func TestDeadLetterQueueReplayAll(t *testing.T) {
+	mux := http.NewServeMux()
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/fail", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	queue, _ := NewDeadLetterQueue(t.TempDir(), RetryPolicy{})
+	queue.Add(WebhookDelivery{Notifier: "Teams", Method: "POST", Url: ts.URL + "/ok"}, 1, assert.AnError)
+	time.Sleep(time.Millisecond)
+	failed, _ := queue.Add(WebhookDelivery{Notifier: "Slack", Method: "POST", Url: ts.URL + "/fail"}, 1, assert.AnError)
+
+	replayed, err := queue.ReplayAll()
+
+	assert.Equal(t, 1, replayed)
+	assert.Equal(t, "dead letter "+failed.ID+": error sending notification to Slack", err.Error())
+
+	letters, _ := queue.List()
+	assert.Equal(t, []string{failed.ID}, []string{letters[0].ID})
+}
+
+func TestDeadLetterQueueReplayDoesNotBlock(t *testing.T) {
+	received := make(chan struct{})
+	hang := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+		<-hang
+	}))
+	defer ts.Close()
+
+	queue, _ := NewDeadLetterQueue(t.TempDir(), RetryPolicy{})
+	letter, _ := queue.Add(WebhookDelivery{Notifier: "Slack", Method: "POST", Url: ts.URL}, 1, assert.AnError)
+
+	replayed := make(chan error)
+	go func() { replayed <- queue.Replay(letter.ID) }()
+	<-received
+
+	_, err := queue.Add(WebhookDelivery{Notifier: "Teams", Method: "POST", Url: ts.URL}, 1, assert.AnError)
+	assert.Nil(t, err)
+
+	letters, err := queue.List()
+	assert.Nil(t, err)
+	assert.Len(t, letters, 2)
+	assert.Equal(t, ErrDeadLetterReplaying, queue.Replay(letter.ID))
+
+	close(hang)
+	assert.Nil(t, <-replayed)
+}
@@ -0,0 +1,294 @@
+package jobs
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	htmlTemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+type EmailTLSMode int
+
+const (
+	StartTLS EmailTLSMode = iota
+	ImplicitTLS
+	NoTLS
+)
+
+var EmailTLSModes = map[string]EmailTLSMode{
+	"":         StartTLS,
+	"starttls": StartTLS,
+	"tls":      ImplicitTLS,
+	"none":     NoTLS,
+}
+
+// EmailNotifier sends the summary as a multipart HTML and plain text email.
+// Items of targets with their own recipients are sent to them in a separate
+// email instead of the default recipients.
+type EmailNotifier struct {
+	Host              string
+	Port              int
+	Username          string
+	Password          string
+	From              string
+	To                []string
+	TLSMode           EmailTLSMode
+	NotificationTitle string
+	NotificationBody  string
+	NotificationUrl   string
+	tlsConfig         *tls.Config
+	textTemplate      *template.Template
+	htmlTemplate      *htmlTemplate.Template
+}
+
+// maximum time to deliver each email
+var emailTimeout = 30 * time.Second
+
+type emailGroup struct {
+	recipients []string
+	items      []CertCheckNotification
+}
+
+func (m *EmailNotifier) Init(host string, port int, username string, password string, from string, to string, tlsMode EmailTLSMode, notificationTitle string, notificationBody string, notificationUrl string) {
+	if port <= 0 {
+		port = map[EmailTLSMode]int{StartTLS: 587, ImplicitTLS: 465, NoTLS: 25}[tlsMode]
+	}
+
+	if notificationTitle == "" {
+		notificationTitle = "Sharp Cert Manager Summary"
+	}
+
+	if notificationBody == "" {
+		notificationBody = fmt.Sprintf("The following certificates were checked on %s", time.Now().Format("01/02/2006"))
+	}
+
+	m.Host = host
+	m.Port = port
+	m.Username = username
+	m.Password = password
+	m.From = from
+	m.To = parseRecipients(to)
+	m.TLSMode = tlsMode
+	m.NotificationTitle = notificationTitle
+	m.NotificationBody = notificationBody
+	m.NotificationUrl = notificationUrl
+	m.textTemplate = template.Must(template.New("text").Parse(emailTextTemplate))
+	m.htmlTemplate = htmlTemplate.Must(htmlTemplate.New("html").Parse(emailHTMLTemplate))
+}
+
+// SetTLSConfig overrides the configuration used to verify the SMTP server
+func (m *EmailNotifier) SetTLSConfig(config *tls.Config) {
+	m.tlsConfig = config
+}
+
+func parseRecipients(recipients string) []string {
+	result := []string{}
+
+	for _, recipient := range strings.Split(recipients, ",") {
+		if recipient = strings.TrimSpace(recipient); recipient != "" {
+			result = append(result, recipient)
+		}
+	}
+
+	return result
+}
+
+func (m *EmailNotifier) IsReady() bool {
+	return m.Host != "" && m.From != "" && len(m.To) > 0
+}
+
+func (m *EmailNotifier) Notify(result []CertCheckNotification) error {
+	errs := []error{}
+
+	for _, group := range m.getGroups(result) {
+		message, err := m.getMessage(group)
+
+		if err == nil {
+			err = m.send(group.recipients, message)
+		}
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error sending email to %s: %w", strings.Join(group.recipients, ", "), err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// getGroups splits the items by recipients. The default recipients always
+// get the summary, even when every item was sent elsewhere.
+func (m *EmailNotifier) getGroups(result []CertCheckNotification) []emailGroup {
+	groups := []emailGroup{{recipients: m.To, items: []CertCheckNotification{}}}
+
+	for _, item := range result {
+		recipients := m.To
+		if len(item.Recipients) > 0 {
+			recipients = item.Recipients
+		}
+
+		idx := slices.IndexFunc(groups, func(group emailGroup) bool { return slices.Equal(group.recipients, recipients) })
+		if idx < 0 {
+			groups = append(groups, emailGroup{recipients: recipients})
+			idx = len(groups) - 1
+		}
+
+		groups[idx].items = append(groups[idx].items, item)
+	}
+
+	return groups
+}
+
+func (m *EmailNotifier) getMessage(group emailGroup) ([]byte, error) {
+	card := WebHookNotificationCard{
+		Title:           m.NotificationTitle,
+		Description:     m.NotificationBody,
+		NotificationUrl: m.NotificationUrl,
+		Items:           group.items,
+		Mentions:        []string{},
+	}
+
+	var message bytes.Buffer
+	writer := multipart.NewWriter(&message)
+
+	fmt.Fprintf(&message, "From: %s\r\n", m.From)
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(group.recipients, ", "))
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.NotificationTitle))
+	fmt.Fprintf(&message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&message, "Message-ID: <%s@%s>\r\n", getMessageId(), m.Host)
+	fmt.Fprintf(&message, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&message, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", writer.Boundary())
+
+	parts := []struct {
+		contentType string
+		execute     func(*bytes.Buffer) error
+	}{
+		{"text/plain; charset=utf-8", func(body *bytes.Buffer) error { return m.textTemplate.Execute(body, card) }},
+		{"text/html; charset=utf-8", func(body *bytes.Buffer) error { return m.htmlTemplate.Execute(body, card) }},
+	}
+
+	for _, part := range parts {
+		var body bytes.Buffer
+		if err := part.execute(&body); err != nil {
+			return nil, err
+		}
+
+		partWriter, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		encoder := quotedprintable.NewWriter(partWriter)
+		encoder.Write(body.Bytes())
+		encoder.Close()
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return message.Bytes(), nil
+}
+
+func (m *EmailNotifier) send(recipients []string, message []byte) error {
+	address := net.JoinHostPort(m.Host, strconv.Itoa(m.Port))
+	dialer := &net.Dialer{Timeout: emailTimeout}
+
+	var conn net.Conn
+	var err error
+	if m.TLSMode == ImplicitTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, m.getTLSConfig())
+	} else {
+		conn, err = dialer.Dial("tcp", address)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	// a server that never answers must not block the job
+	conn.SetDeadline(time.Now().Add(emailTimeout))
+
+	client, err := smtp.NewClient(conn, m.Host)
+
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	defer client.Close()
+
+	if m.TLSMode == StartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return errors.New("the SMTP server does not support STARTTLS")
+		}
+
+		if err := client.StartTLS(m.getTLSConfig()); err != nil {
+			return err
+		}
+	}
+
+	if m.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", m.Username, m.Password, m.Host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(m.From); err != nil {
+		return err
+	}
+
+	for _, recipient := range recipients {
+		if err := client.Rcpt(recipient); err != nil {
+			return err
+		}
+	}
+
+	writer, err := client.Data()
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := writer.Write(message); err != nil {
+		return err
+	}
+
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+func (m *EmailNotifier) getTLSConfig() *tls.Config {
+	if m.tlsConfig != nil {
+		return m.tlsConfig
+	}
+
+	return &tls.Config{ServerName: m.Host}
+}
+
+func getMessageId() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+
+	return hex.EncodeToString(id)
+}
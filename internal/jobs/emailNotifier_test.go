@@ -0,0 +1,268 @@
+package jobs
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/http/httptest"
+	"net/mail"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeEmail struct {
+	from       string
+	recipients []string
+	data       string
+}
+
+// fakeSMTPServer implements enough of SMTP to receive messages with optional
+// STARTTLS, implicit TLS and AUTH PLAIN
+type fakeSMTPServer struct {
+	listener  net.Listener
+	tlsConfig *tls.Config
+	auth      string
+	emails    []fakeEmail
+	lock      sync.Mutex
+}
+
+func startFakeSMTPServer(t *testing.T, implicitTLS bool) (*fakeSMTPServer, *x509.CertPool) {
+	// reuse the certificate of httptest which is valid for 127.0.0.1
+	tlsServer := httptest.NewTLSServer(nil)
+	tlsServer.Close()
+	pool := x509.NewCertPool()
+	pool.AddCert(tlsServer.Certificate())
+
+	server := &fakeSMTPServer{tlsConfig: &tls.Config{Certificates: tlsServer.TLS.Certificates}}
+
+	var err error
+	if implicitTLS {
+		server.listener, err = tls.Listen("tcp", "127.0.0.1:0", server.tlsConfig)
+	} else {
+		server.listener, err = net.Listen("tcp", "127.0.0.1:0")
+	}
+
+	assert.Nil(t, err)
+	t.Cleanup(func() { server.listener.Close() })
+
+	go func() {
+		for {
+			conn, err := server.listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go server.serve(conn, implicitTLS)
+		}
+	}()
+
+	return server, pool
+}
+
+func (s *fakeSMTPServer) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *fakeSMTPServer) serve(conn net.Conn, secure bool) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	write := func(line string) { fmt.Fprintf(conn, "%s\r\n", line) }
+	email := fakeEmail{}
+
+	write("220 fake ESMTP")
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		command := strings.TrimSpace(line)
+		switch verb := strings.ToUpper(strings.SplitN(command, " ", 2)[0]); verb {
+		case "EHLO":
+			write("250-fake")
+			if !secure {
+				write("250-STARTTLS")
+			}
+			write("250 AUTH PLAIN")
+		case "STARTTLS":
+			write("220 ready")
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if tlsConn.Handshake() != nil {
+				return
+			}
+			conn, reader, secure = tlsConn, bufio.NewReader(tlsConn), true
+		case "AUTH":
+			decoded, _ := base64.StdEncoding.DecodeString(strings.Fields(command)[2])
+			s.lock.Lock()
+			s.auth = string(decoded)
+			s.lock.Unlock()
+			write("235 ok")
+		case "MAIL":
+			email.from = strings.Trim(strings.TrimPrefix(command, "MAIL FROM:"), "<>")
+			write("250 ok")
+		case "RCPT":
+			email.recipients = append(email.recipients, strings.Trim(strings.TrimPrefix(command, "RCPT TO:"), "<>"))
+			write("250 ok")
+		case "DATA":
+			write("354 go ahead")
+			var data strings.Builder
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil || line == ".\r\n" {
+					break
+				}
+				data.WriteString(line)
+			}
+			email.data = data.String()
+			s.lock.Lock()
+			s.emails = append(s.emails, email)
+			s.lock.Unlock()
+			email = fakeEmail{}
+			write("250 ok")
+		case "QUIT":
+			write("221 bye")
+			return
+		default:
+			write("250 ok")
+		}
+	}
+}
+
+func (s *fakeSMTPServer) getEmails() []fakeEmail {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.emails
+}
+
+// getEmailParts returns the decoded body of each part by content type
+func getEmailParts(t *testing.T, data string) (*mail.Message, map[string]string) {
+	message, err := mail.ReadMessage(strings.NewReader(data))
+	assert.Nil(t, err)
+
+	_, params, _ := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	reader := multipart.NewReader(message.Body, params["boundary"])
+	parts := map[string]string{}
+
+	for {
+		part, err := reader.NextRawPart()
+		if err != nil {
+			break
+		}
+
+		body, _ := io.ReadAll(quotedprintable.NewReader(part))
+		mediaType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		parts[mediaType] = strings.ReplaceAll(string(body), "\r\n", "\n")
+	}
+
+	return message, parts
+}
+
+func TestEmailNotifierStartTLS(t *testing.T) {
+	server, pool := startFakeSMTPServer(t, false)
+
+	notifier := &EmailNotifier{}
+	notifier.Init("127.0.0.1", server.port(), "user", "secret", "certs@lpains.net", "ops@lpains.net, sec@lpains.net", StartTLS, "title", "body", "https://certs.lpains.net")
+	notifier.SetTLSConfig(&tls.Config{RootCAs: pool, ServerName: "127.0.0.1"})
+
+	err := notifier.Notify([]CertCheckNotification{
+		{Hostname: "blog", IsValid: false, Messages: []string{"Certificate expired", "<script>"}},
+		{Hostname: "mail", IsValid: true, ExpirationWarning: true, Messages: []string{"Certificate expires in 5 days"}},
+	})
+
+	assert.Nil(t, err)
+	emails := server.getEmails()
+	assert.Len(t, emails, 1)
+	assert.Equal(t, "certs@lpains.net", emails[0].from)
+	assert.Equal(t, []string{"ops@lpains.net", "sec@lpains.net"}, emails[0].recipients)
+	assert.Equal(t, "\x00user\x00secret", server.auth)
+
+	message, parts := getEmailParts(t, emails[0].data)
+	assert.Equal(t, "title", message.Header.Get("Subject"))
+	assert.Equal(t, "ops@lpains.net, sec@lpains.net", message.Header.Get("To"))
+	assert.Contains(t, parts["text/plain"], "[ERROR] blog\n  - Certificate expired\n  - <script>")
+	assert.Contains(t, parts["text/plain"], "[WARNING] mail\n  - Certificate expires in 5 days")
+	assert.Contains(t, parts["text/plain"], "View details: https://certs.lpains.net")
+	assert.Contains(t, parts["text/html"], "<td><strong>blog</strong></td>")
+	assert.Contains(t, parts["text/html"], "Certificate expired<br>&lt;script&gt;")
+	assert.Contains(t, parts["text/html"], "<a href=\"https://certs.lpains.net\">View details</a>")
+}
+
+func TestEmailNotifierImplicitTLS(t *testing.T) {
+	server, pool := startFakeSMTPServer(t, true)
+
+	notifier := &EmailNotifier{}
+	notifier.Init("127.0.0.1", server.port(), "", "", "certs@lpains.net", "ops@lpains.net", ImplicitTLS, "", "", "")
+	notifier.SetTLSConfig(&tls.Config{RootCAs: pool, ServerName: "127.0.0.1"})
+
+	err := notifier.Notify([]CertCheckNotification{{Hostname: "blog", IsValid: true}})
+
+	assert.Nil(t, err)
+	assert.Len(t, server.getEmails(), 1)
+	assert.Equal(t, "", server.auth)
+}
+
+func TestEmailNotifierRecipientOverrides(t *testing.T) {
+	server, _ := startFakeSMTPServer(t, false)
+
+	notifier := &EmailNotifier{}
+	notifier.Init("127.0.0.1", server.port(), "", "", "certs@lpains.net", "ops@lpains.net", NoTLS, "", "", "")
+
+	err := notifier.Notify([]CertCheckNotification{
+		{Hostname: "blog", IsValid: true},
+		{Hostname: "shop", IsValid: false, Recipients: []string{"shop@lpains.net"}},
+		{Hostname: "pay", IsValid: false, Recipients: []string{"shop@lpains.net"}},
+	})
+
+	assert.Nil(t, err)
+	emails := server.getEmails()
+	assert.Len(t, emails, 2)
+	assert.Equal(t, []string{"ops@lpains.net"}, emails[0].recipients)
+	assert.Equal(t, []string{"shop@lpains.net"}, emails[1].recipients)
+
+	_, defaultParts := getEmailParts(t, emails[0].data)
+	_, shopParts := getEmailParts(t, emails[1].data)
+	assert.Contains(t, defaultParts["text/plain"], "[OK] blog")
+	assert.NotContains(t, defaultParts["text/plain"], "shop")
+	assert.Contains(t, shopParts["text/plain"], "[ERROR] shop")
+	assert.Contains(t, shopParts["text/plain"], "[ERROR] pay")
+}
+
+func TestEmailNotifierRequiresStartTLS(t *testing.T) {
+	server, _ := startFakeSMTPServer(t, true)
+
+	notifier := &EmailNotifier{}
+	notifier.Init("127.0.0.1", server.port(), "", "", "certs@lpains.net", "ops@lpains.net", StartTLS, "", "", "")
+
+	emailTimeout = 200 * time.Millisecond
+	defer func() { emailTimeout = 30 * time.Second }()
+
+	err := notifier.Notify([]CertCheckNotification{})
+
+	assert.ErrorContains(t, err, "error sending email to ops@lpains.net")
+}
+
+func TestEmailNotifierIsReady(t *testing.T) {
+	notifier := &EmailNotifier{}
+	notifier.Init("smtp.lpains.net", 0, "", "", "certs@lpains.net", "", StartTLS, "", "", "")
+
+	assert.False(t, notifier.IsReady())
+	assert.Equal(t, 587, notifier.Port)
+
+	notifier.Init("smtp.lpains.net", 0, "", "", "certs@lpains.net", "ops@lpains.net", ImplicitTLS, "", "", "")
+
+	assert.True(t, notifier.IsReady())
+	assert.Equal(t, 465, notifier.Port)
+}
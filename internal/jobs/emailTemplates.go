@@ -0,0 +1,34 @@
+package jobs
+
+const emailTextTemplate = `{{ .Title }}
+
+{{ .Description }}
+{{ range .Items }}
+{{if .Changed}}[CHANGED]{{else if not .IsValid}}[ERROR]{{else if .ExpirationWarning}}[WARNING]{{else}}[OK]{{end}} {{ .Hostname }}
+{{- range .Messages }}
+  - {{ . }}
+{{- end }}
+{{ end }}
+{{- if .NotificationUrl }}
+View details: {{ .NotificationUrl }}
+{{ end }}`
+
+const emailHTMLTemplate = `<!DOCTYPE html>
+<html>
+<body style="font-family: Segoe UI, Helvetica, Arial, sans-serif; color: #1f2937;">
+	<h2>{{ .Title }}</h2>
+	<p>{{ .Description }}</p>
+	<table cellpadding="6" style="border-collapse: collapse;">
+		{{- range .Items }}
+		<tr style="border-top: 1px solid #e5e7eb;">
+			<td>{{if .Changed}}&#128260;{{else if not .IsValid}}&#10060;{{else if .ExpirationWarning}}&#9888;&#65039;{{else}}&#9989;{{end}}</td>
+			<td><strong>{{ .Hostname }}</strong></td>
+			<td>{{ range $index, $element := .Messages }}{{if $index}}<br>{{end}}{{ $element }}{{ end }}</td>
+		</tr>
+		{{- end }}
+	</table>
+	{{- if .NotificationUrl }}
+	<p><a href="{{ .NotificationUrl }}">View details</a></p>
+	{{- end }}
+</body>
+</html>`
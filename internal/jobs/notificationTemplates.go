@@ -19,7 +19,7 @@ const slackMessageTemplate = `{
 			"type": "section",
 			"text": {
 				"type": "mrkdwn",
-				"text": "{{if not $item.IsValid}}:x:{{else if $item.ExpirationWarning}}:warning:{{else}}:white_check_mark:{{end}}\t*{{$item.Hostname}}*\n{{ range $index, $element := $item.Messages}}{{if $index}}, {{end}}{{$element}}{{end}}"
+				"text": "{{if $item.Changed}}:arrows_counterclockwise:{{else if not $item.IsValid}}:x:{{else if $item.ExpirationWarning}}:warning:{{else}}:white_check_mark:{{end}}\t*{{$item.Hostname}}*\n{{ range $index, $element := $item.Messages}}{{if $index}}, {{end}}{{$element}}{{end}}"
 			}
 		},
 		{{- end}}
@@ -95,7 +95,7 @@ const teamsMessageTemplate = `{
 									"items": [
 										{
 										"type": "TextBlock",
-										"text": "{{if not $item.IsValid}}❌{{else if $item.ExpirationWarning}}⚠️{{else}}✔️{{end}}{{$item.Hostname}}"
+										"text": "{{if $item.Changed}}🔄{{else if not $item.IsValid}}❌{{else if $item.ExpirationWarning}}⚠️{{else}}✔️{{end}}{{$item.Hostname}}"
 										}
 									]
 								},
@@ -144,19 +144,140 @@ const teamsMessageTemplate = `{
 	}]
 }`
 
+const discordMessageTemplate = `{
+	"content": "{{escape .Title}}{{range .Mentions}} <@{{escape .}}>{{end}}",
+	"allowed_mentions": {
+		"users": [{{range $i, $element := .Mentions}}{{if $i}}, {{end}}{{json $element}}{{end}}]
+	},
+	"embeds": [{
+		"title": "{{escape .Title}}",
+		"description": "{{escape .Description}}",{{if .NotificationUrl}}
+		"url": "{{escape .NotificationUrl}}",{{end}}
+		"color": {{if .HasErrors}}15158332{{else if .HasWarnings}}15105570{{else}}3066993{{end}},
+		"fields": [
+			{{- range $i, $item := .Items}}{{if lt $i 25}}{{if $i}},{{end}}
+			{
+				"name": "{{if $item.Resolved}}✅{{else if $item.Changed}}🔄{{else if not $item.IsValid}}❌{{else if $item.ExpirationWarning}}⚠️{{else}}✅{{end}} {{escape $item.Hostname}}",
+				"value": "{{if $item.Messages}}{{escape (join $item.Messages ", ")}}{{else}}-{{end}}"
+			}
+			{{- end}}{{end}}
+		]{{if gt (len .Items) 25}},
+		"footer": {
+			"text": "{{len .Items}} certificates, showing the first 25"
+		}{{end}}
+	}]
+}`
+
+const googleChatMessageTemplate = `{
+	"text": "{{escape .Title}}{{range .Mentions}} <users/{{escape .}}>{{end}}",
+	"cardsV2": [{
+		"cardId": "sharp-cert-manager",
+		"card": {
+			"header": {
+				"title": "{{escape .Title}}",
+				"subtitle": "{{escape .Description}}"
+			},
+			"sections": [
+				{
+					"widgets": [
+						{{- range $i, $item := .Items}}{{if $i}},{{end}}
+						{
+							"decoratedText": {
+								"topLabel": "{{if $item.Resolved}}✅{{else if $item.Changed}}🔄{{else if not $item.IsValid}}❌{{else if $item.ExpirationWarning}}⚠️{{else}}✅{{end}} {{escape $item.Hostname}}",
+								"text": "{{escape (join $item.Messages ", ")}}",
+								"wrapText": true
+							}
+						}
+						{{- end}}
+					]
+				}{{if .NotificationUrl}},
+				{
+					"widgets": [
+						{
+							"buttonList": {
+								"buttons": [
+									{
+										"text": "View details",
+										"onClick": {
+											"openLink": {
+												"url": "{{escape .NotificationUrl}}"
+											}
+										}
+									}
+								]
+							}
+						}
+					]
+				}{{end}}
+			]
+		}
+	}]
+}`
+
+const mattermostMessageTemplate = `{
+	"username": "Sharp Cert Manager",
+	"text": "#### {{escape .Title}}\n{{if .Mentions}}{{range $i, $element := .Mentions}}{{if $i}} {{end}}@{{escape $element}}{{end}} {{end}}{{escape .Description}}\n\n| | Certificate | Details |\n|:-:|:--|:--|\n
+	{{- range .Items}}| {{if .Resolved}}:white_check_mark:{{else if .Changed}}:arrows_counterclockwise:{{else if not .IsValid}}:x:{{else if .ExpirationWarning}}:warning:{{else}}:white_check_mark:{{end}} | {{escape .Hostname}} | {{escape (join .Messages ", ")}} |\n{{end}}
+	{{- if .NotificationUrl}}\n[View details]({{escape .NotificationUrl}}){{end}}"
+}`
+
+// pagerDutyEventTemplate renders a single Events v2 event. Incidents are
+// keyed by the target name so the resolve event closes the one triggered.
+const pagerDutyEventTemplate = `{
+	{{- $item := index .Items 0}}
+	"routing_key": {{json .RoutingKey}},
+	"event_action": "{{if or $item.Resolved (eq $item.Severity "info")}}resolve{{else}}trigger{{end}}",
+	"dedup_key": {{json $item.Name}},
+	"payload": {
+		"summary": "{{escape $item.Name}}: {{escape (join $item.Messages ", ")}}",
+		"source": {{json $item.Hostname}},
+		"severity": "{{if not $item.IsValid}}critical{{else if eq $item.Severity "warning"}}warning{{else}}info{{end}}",
+		"component": {{json $item.Url}},
+		"group": "{{escape (join $item.Tags ",")}}",
+		"class": "certificate",
+		"custom_details": {
+			"messages": {{json $item.Messages}},
+			"tags": {{json $item.Tags}}
+		}
+	}{{if .NotificationUrl}},
+	"links": [
+		{
+			"href": {{json .NotificationUrl}},
+			"text": "View details"
+		}
+	]{{end}}
+}`
+
 type NotifierType int
 
 const (
 	Teams NotifierType = iota
 	Slack
+	Custom
+	Discord
+	GoogleChat
+	Mattermost
+	PagerDuty
 )
 
 var Notifiers = map[string]NotifierType{
-	"teams": Teams,
-	"slack": Slack,
+	"teams":      Teams,
+	"slack":      Slack,
+	"custom":     Custom,
+	"discord":    Discord,
+	"googlechat": GoogleChat,
+	"mattermost": Mattermost,
+	"pagerduty":  PagerDuty,
 }
 
 var NotificationTemplates = map[NotifierType]string{
-	Teams: teamsMessageTemplate,
-	Slack: slackMessageTemplate,
+	Teams:      teamsMessageTemplate,
+	Slack:      slackMessageTemplate,
+	Discord:    discordMessageTemplate,
+	GoogleChat: googleChatMessageTemplate,
+	Mattermost: mattermostMessageTemplate,
+	PagerDuty:  pagerDutyEventTemplate,
 }
+
+// default endpoint of the PagerDuty Events v2 API
+const pagerDutyEventsUrl = "https://events.pagerduty.com/v2/enqueue"
@@ -2,9 +2,14 @@ package jobs
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"text/template"
 	"time"
@@ -17,6 +22,12 @@ type WebHookNotifier struct {
 	NotificationBody  string
 	NotificationUrl   string
 	Mentions          []string
+	Method            string
+	Headers           map[string]string
+	ContentType       string
+	RoutingKey        string
+	Retry             RetryPolicy
+	DeadLetters       *DeadLetterQueue
 	parsedTemplate    *template.Template
 	httpClient        *http.Client
 }
@@ -27,6 +38,15 @@ type WebHookNotificationCard struct {
 	NotificationUrl string
 	Items           []CertCheckNotification
 	Mentions        []string
+	RoutingKey      string
+}
+
+func (c WebHookNotificationCard) HasErrors() bool {
+	return slices.ContainsFunc(c.Items, func(item CertCheckNotification) bool { return item.Severity() == "error" })
+}
+
+func (c WebHookNotificationCard) HasWarnings() bool {
+	return slices.ContainsFunc(c.Items, func(item CertCheckNotification) bool { return item.Severity() == "warning" })
 }
 
 func (m *WebHookNotifier) Init(notifierType NotifierType, webhookUrl string, notificationTitle string, notificationBody string, notificationUrl string, messageMentions string) {
@@ -38,6 +58,10 @@ func (m *WebHookNotifier) Init(notifierType NotifierType, webhookUrl string, not
 		notificationBody = fmt.Sprintf("The following certificates were checked on %s", time.Now().Format("01/02/2006"))
 	}
 
+	if notifierType == PagerDuty && webhookUrl == "" {
+		webhookUrl = pagerDutyEventsUrl
+	}
+
 	m.NotifierType = notifierType
 	m.NotificationTitle = notificationTitle
 	m.NotificationBody = notificationBody
@@ -54,52 +78,188 @@ func parseMentions(mentions string) []string {
 	return strings.Split(mentions, ",")
 }
 
+var notifierNames = map[NotifierType]string{
+	Teams:      "Teams",
+	Slack:      "Slack",
+	Custom:     "webhook",
+	Discord:    "Discord",
+	GoogleChat: "Google Chat",
+	Mattermost: "Mattermost",
+	PagerDuty:  "PagerDuty",
+}
+
+// templateFuncs are available to the built-in and custom templates
+var templateFuncs = template.FuncMap{
+	"split": func(s, sep string) []string {
+		return strings.Split(s, sep)
+	},
+	"join": func(elems []string, sep string) string {
+		return strings.Join(elems, sep)
+	},
+	"json": func(value any) (string, error) {
+		result, err := json.Marshal(value)
+		return string(result), err
+	},
+	// escape makes a value safe to place inside a JSON string
+	"escape": func(value string) string {
+		result, _ := json.Marshal(value)
+		return string(result[1 : len(result)-1])
+	},
+}
+
+// SetRequest changes how the notification is sent. Empty values keep the
+// default POST with an application/json body.
+func (m *WebHookNotifier) SetRequest(method string, headers map[string]string, contentType string) {
+	m.Method = method
+	m.Headers = headers
+	m.ContentType = contentType
+}
+
+// SetDelivery retries failed notifications with the policy and keeps the
+// ones that still fail in deadLetters when it is not nil
+func (m *WebHookNotifier) SetDelivery(policy RetryPolicy, deadLetters *DeadLetterQueue) {
+	m.Retry = policy
+	m.DeadLetters = deadLetters
+}
+
+// SetRoutingKey sets the integration key PagerDuty events are sent to
+func (m *WebHookNotifier) SetRoutingKey(routingKey string) {
+	m.RoutingKey = routingKey
+}
+
+// LoadTemplate reads and parses the template file used by custom webhooks.
+// The template receives the WebHookNotificationCard.
+func (m *WebHookNotifier) LoadTemplate(path string) error {
+	content, err := os.ReadFile(path)
+
+	if err != nil {
+		return err
+	}
+
+	parsedTemplate, err := template.New(filepath.Base(path)).Funcs(templateFuncs).Parse(string(content))
+
+	if err != nil {
+		return fmt.Errorf("invalid webhook template %s: %w", path, err)
+	}
+
+	m.parsedTemplate = parsedTemplate
+
+	return nil
+}
+
+// ParseTemplate parses the built-in template of the notifier type so errors
+// are reported at startup. Custom webhooks need LoadTemplate instead.
+func (m *WebHookNotifier) ParseTemplate() error {
+	if m.parsedTemplate != nil {
+		return nil
+	}
+
+	templateText, ok := NotificationTemplates[m.NotifierType]
+
+	if !ok {
+		return errors.New("a template file is required for custom webhooks")
+	}
+
+	parsedTemplate, err := template.New("template").Funcs(templateFuncs).Parse(templateText)
+
+	if err != nil {
+		return err
+	}
+
+	m.parsedTemplate = parsedTemplate
+
+	return nil
+}
+
 func (m *WebHookNotifier) Notify(result []CertCheckNotification) error {
-	client := m.getClient()
-	parsedTemplate := m.getTemplate()
+	if err := m.ParseTemplate(); err != nil {
+		return err
+	}
+
 	card := WebHookNotificationCard{
 		Title:           m.NotificationTitle,
 		Description:     m.NotificationBody,
 		NotificationUrl: m.NotificationUrl,
 		Items:           result,
 		Mentions:        m.Mentions,
+		RoutingKey:      m.RoutingKey,
+	}
+
+	if m.NotifierType != PagerDuty {
+		return m.send(card)
+	}
+
+	// PagerDuty takes one event per incident
+	errs := []error{}
+	for _, item := range result {
+		// a renewed certificate is not an incident, its resolution is
+		if item.Changed {
+			continue
+		}
+
+		card.Items = []CertCheckNotification{item}
+		errs = append(errs, m.send(card))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Resolve sends a resolve event for each target to PagerDuty so incidents
+// close once the certificate is fine. Other webhooks have nothing to resolve.
+func (m *WebHookNotifier) Resolve(result []CertCheckNotification) error {
+	if m.NotifierType != PagerDuty {
+		return nil
 	}
 
+	return m.Notify(result)
+}
+
+func (m *WebHookNotifier) send(card WebHookNotificationCard) error {
 	var templateBody bytes.Buffer
-	err := parsedTemplate.Execute(&templateBody, card)
+	err := m.parsedTemplate.Execute(&templateBody, card)
 
 	if err != nil {
 		return err
 	}
 
 	stringBody := templateBody.String()
-	fmt.Println(stringBody)
 
-	response, err := client.Post(m.WebhookUrl, "application/json", bytes.NewReader(templateBody.Bytes()))
+	method := m.Method
+	if method == "" {
+		method = http.MethodPost
+	}
 
-	if err != nil {
-		return err
+	contentType := m.ContentType
+	if contentType == "" {
+		contentType = "application/json"
 	}
 
-	defer response.Body.Close()
+	headers := map[string]string{"Content-Type": contentType}
+	for name, value := range m.Headers {
+		headers[name] = value
+	}
 
-	if response.StatusCode != 200 {
-		return errors.New("error sending notification to Teams")
+	delivery := WebhookDelivery{
+		Notifier: notifierNames[m.NotifierType],
+		Method:   method,
+		Url:      m.WebhookUrl,
+		Headers:  headers,
+		Body:     stringBody,
 	}
 
-	return nil
-}
+	attempts, err := m.Retry.send(m.getClient(), delivery)
+
+	if err != nil && m.DeadLetters != nil {
+		letter, deadLetterErr := m.DeadLetters.Add(delivery, attempts, err)
+
+		if deadLetterErr != nil {
+			return errors.Join(err, deadLetterErr)
+		}
 
-func (m *WebHookNotifier) getTemplate() *template.Template {
-	if m.parsedTemplate == nil {
-		m.parsedTemplate, _ = template.New("template").Funcs(template.FuncMap{
-			"split": func(s, sep string) []string {
-				return strings.Split(s, sep)
-			},
-		}).Parse(NotificationTemplates[m.NotifierType])
+		log.Printf("Notification to %s saved as dead letter %s", delivery.Notifier, letter.ID)
 	}
 
-	return m.parsedTemplate
+	return err
 }
 
 func (m *WebHookNotifier) getClient() *http.Client {
@@ -111,5 +271,5 @@ func (m *WebHookNotifier) getClient() *http.Client {
 }
 
 func (m *WebHookNotifier) IsReady() bool {
-	return m.WebhookUrl != ""
+	return m.WebhookUrl != "" && (m.NotifierType != PagerDuty || m.RoutingKey != "")
 }
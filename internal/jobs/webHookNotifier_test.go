@@ -4,8 +4,11 @@ import (
 	"bytes"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/jlucaspains/sharp-cert-manager/internal/models"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -138,3 +141,82 @@ func TestWebHookNotifierBadResponseCode(t *testing.T) {
 	err := WebHookNotifier.Notify([]CertCheckNotification{})
 	assert.Equal(t, "error sending notification to Teams", err.Error())
 }
+
+func TestSlackWebHookNotifierChanged(t *testing.T) {
+	mux := http.NewServeMux()
+	ts := httptest.NewUnstartedServer(mux)
+	ts.Start()
+	defer ts.Close()
+
+	var result string
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		defer r.Body.Close()
+		buf := new(bytes.Buffer)
+		buf.ReadFrom(r.Body)
+		result = buf.String()
+	})
+
+	WebHookNotifier := &WebHookNotifier{}
+	WebHookNotifier.Init(Slack, ts.URL, "", "The following certificates were checked on today", "", "")
+	err := WebHookNotifier.Notify([]CertCheckNotification{
+		{Hostname: "host1", IsValid: true, Changed: true, Messages: []string{"Certificate changed, serial 01 replaced by 02"}},
+	})
+	assert.Nil(t, err)
+	assert.Contains(t, result, ":arrows_counterclockwise:\\t*host1*\\nCertificate changed, serial 01 replaced by 02")
+}
+
+func TestCustomWebHookNotifier(t *testing.T) {
+	mux := http.NewServeMux()
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	var result, method, contentType, token string
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		method, contentType, token = r.Method, r.Header.Get("Content-Type"), r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusAccepted)
+		defer r.Body.Close()
+		buf := new(bytes.Buffer)
+		buf.ReadFrom(r.Body)
+		result = buf.String()
+	})
+
+	path := filepath.Join(t.TempDir(), "incident.json.tmpl")
+	os.WriteFile(path, []byte(`{"summary": {{json .Title}}, "alerts": [
+{{- range $i, $item := .Items}}{{if $i}},{{end}}{"name": {{json $item.Name}}, "severity": "{{$item.Severity}}", "tags": "{{join $item.Tags ","}}", "issuer": {{json $item.Result.Issuer}}}{{end}}]}`), 0644)
+
+	notifier := &WebHookNotifier{}
+	notifier.Init(Custom, ts.URL, "Cert \"check\"", "", "", "")
+	notifier.SetRequest("PUT", map[string]string{"Authorization": "Bearer abc"}, "application/vnd.incident+json")
+	err := notifier.LoadTemplate(path)
+	assert.Nil(t, err)
+
+	err = notifier.Notify([]CertCheckNotification{
+		{Hostname: "blog", Name: "blog", IsValid: false, Tags: []string{"public", "blog"}, Result: &models.CertCheckResult{Issuer: "Test CA"}},
+		{Hostname: "mail", Name: "mail", IsValid: true, ExpirationWarning: true, Result: &models.CertCheckResult{}},
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, "PUT", method)
+	assert.Equal(t, "application/vnd.incident+json", contentType)
+	assert.Equal(t, "Bearer abc", token)
+	assert.Equal(t, `{"summary": "Cert \"check\"", "alerts": [{"name": "blog", "severity": "error", "tags": "public,blog", "issuer": "Test CA"},{"name": "mail", "severity": "warning", "tags": "", "issuer": ""}]}`, result)
+}
+
+func TestCustomWebHookNotifierInvalidTemplate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "incident.json.tmpl")
+	os.WriteFile(path, []byte(`{{ .Title `), 0644)
+
+	notifier := &WebHookNotifier{}
+	notifier.Init(Custom, "http://localhost", "", "", "", "")
+
+	assert.ErrorContains(t, notifier.LoadTemplate(path), "invalid webhook template "+path)
+	assert.Equal(t, "a template file is required for custom webhooks", notifier.Notify([]CertCheckNotification{}).Error())
+}
+
+func TestCertCheckNotificationSeverity(t *testing.T) {
+	assert.Equal(t, "error", CertCheckNotification{IsValid: false, Changed: true}.Severity())
+	assert.Equal(t, "warning", CertCheckNotification{IsValid: true, Changed: true}.Severity())
+	assert.Equal(t, "warning", CertCheckNotification{IsValid: true, ExpirationWarning: true}.Severity())
+	assert.Equal(t, "info", CertCheckNotification{IsValid: true}.Severity())
+}
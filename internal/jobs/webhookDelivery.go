@@ -0,0 +1,146 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls how failed webhook deliveries are retried. Delays grow
+// exponentially from BaseDelay up to MaxDelay with random jitter.
+type RetryPolicy struct {
+	Retries   int
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{Retries: 3, BaseDelay: time.Second, MaxDelay: 30 * time.Second}
+
+// maximum time each webhook request may take so a hung endpoint does not
+// block the job
+var webhookTimeout = 30 * time.Second
+
+// retrySleep is replaced in tests to avoid waiting between attempts
+var retrySleep = time.Sleep
+
+// WebhookDelivery is a rendered webhook request. It is kept in the dead
+// letter queue when all attempts fail so it can be replayed as is.
+type WebhookDelivery struct {
+	Notifier string            `json:"notifier"`
+	Method   string            `json:"method"`
+	Url      string            `json:"url"`
+	Headers  map[string]string `json:"headers"`
+	Body     string            `json:"body"`
+}
+
+// send makes the request until it succeeds, fails with an error that
+// retrying will not fix or the policy runs out of retries. It returns the
+// number of attempts made.
+func (p RetryPolicy) send(client *http.Client, delivery WebhookDelivery) (int, error) {
+	attempt := 0
+
+	for {
+		attempt++
+		retryAfter, retry, err := delivery.send(client)
+
+		if err == nil {
+			return attempt, nil
+		}
+
+		if !retry || attempt > p.Retries {
+			return attempt, err
+		}
+
+		delay := p.delay(attempt)
+
+		// the server asked for a longer pause than we are willing to wait
+		if retryAfter > p.MaxDelay {
+			return attempt, err
+		}
+
+		delay = max(delay, retryAfter)
+		log.Printf("Retrying notification to %s in %s: %s", delivery.Notifier, delay, err)
+		retrySleep(delay)
+	}
+}
+
+// delay is the exponential backoff before the given retry with jitter
+// between half and the full delay so clients do not retry in lockstep
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	delay := p.MaxDelay
+	if attempt < 32 {
+		delay = min(p.BaseDelay<<(attempt-1), p.MaxDelay)
+	}
+
+	if delay <= 0 {
+		return 0
+	}
+
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// send makes a single attempt and tells whether it is worth retrying
+func (d WebhookDelivery) send(client *http.Client) (time.Duration, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, d.Method, d.Url, bytes.NewReader([]byte(d.Body)))
+
+	if err != nil {
+		return 0, false, err
+	}
+
+	for name, value := range d.Headers {
+		request.Header.Set(name, value)
+	}
+
+	response, err := client.Do(request)
+
+	// the url may be the webhook secret so it is left out of the error
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = fmt.Errorf("error sending notification to %s: %w", d.Notifier, urlErr.Err)
+	}
+
+	if err != nil {
+		return 0, true, err
+	}
+
+	defer response.Body.Close()
+	io.Copy(io.Discard, response.Body)
+
+	if response.StatusCode >= 200 && response.StatusCode <= 299 {
+		return 0, false, nil
+	}
+
+	err = fmt.Errorf("error sending notification to %s", d.Notifier)
+	retry := response.StatusCode == http.StatusTooManyRequests || response.StatusCode == http.StatusRequestTimeout ||
+		response.StatusCode >= 500
+
+	return getRetryAfter(response.Header.Get("Retry-After")), retry, err
+}
+
+// getRetryAfter reads a Retry-After header in seconds or as an HTTP date
+func getRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0)
+	}
+
+	return 0
+}
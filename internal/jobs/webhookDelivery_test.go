@@ -0,0 +1,140 @@
+package jobs
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func noRetrySleep(t *testing.T) *[]time.Duration {
+	delays := []time.Duration{}
+	retrySleep = func(d time.Duration) { delays = append(delays, d) }
+	t.Cleanup(func() { retrySleep = time.Sleep })
+
+	return &delays
+}
+
+func TestWebHookNotifierRetries(t *testing.T) {
+	delays := noRetrySleep(t)
+	mux := http.NewServeMux()
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	calls := 0
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch calls {
+		case 1:
+			w.Header().Set("Retry-After", "20")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 2:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+
+	notifier := &WebHookNotifier{}
+	notifier.Init(Slack, ts.URL, "", "", "", "")
+	notifier.SetDelivery(RetryPolicy{Retries: 3, BaseDelay: time.Second, MaxDelay: 30 * time.Second}, nil)
+	err := notifier.Notify([]CertCheckNotification{})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, 20*time.Second, (*delays)[0])
+	assert.GreaterOrEqual(t, (*delays)[1], time.Second)
+	assert.LessOrEqual(t, (*delays)[1], 2*time.Second)
+}
+
+func TestWebHookNotifierTimeout(t *testing.T) {
+	noRetrySleep(t)
+	webhookTimeout = 200 * time.Millisecond
+	defer func() { webhookTimeout = 30 * time.Second }()
+
+	hang := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-hang
+	}))
+	defer ts.Close()
+	defer close(hang)
+
+	notifier := &WebHookNotifier{}
+	notifier.Init(Slack, ts.URL, "", "", "", "")
+	notifier.SetDelivery(RetryPolicy{Retries: 1}, nil)
+
+	start := time.Now()
+	err := notifier.Notify([]CertCheckNotification{})
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.NotContains(t, err.Error(), ts.URL)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestWebHookNotifierDoesNotRetryClientErrors(t *testing.T) {
+	noRetrySleep(t)
+	mux := http.NewServeMux()
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	calls := 0
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadRequest)
+	})
+
+	notifier := &WebHookNotifier{}
+	notifier.Init(Slack, ts.URL, "", "", "", "")
+	notifier.SetDelivery(DefaultRetryPolicy, nil)
+	err := notifier.Notify([]CertCheckNotification{})
+
+	assert.Equal(t, "error sending notification to Slack", err.Error())
+	assert.Equal(t, 1, calls)
+}
+
+func TestWebHookNotifierRetryAfterTooLong(t *testing.T) {
+	delays := noRetrySleep(t)
+	mux := http.NewServeMux()
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	calls := 0
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+
+	notifier := &WebHookNotifier{}
+	notifier.Init(Teams, ts.URL, "", "", "", "")
+	notifier.SetDelivery(DefaultRetryPolicy, nil)
+	err := notifier.Notify([]CertCheckNotification{})
+
+	assert.Equal(t, "error sending notification to Teams", err.Error())
+	assert.Equal(t, 1, calls)
+	assert.Empty(t, *delays)
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{Retries: 10, BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+
+	for attempt, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		delay := policy.delay(attempt + 1)
+		assert.GreaterOrEqual(t, delay, expected/2)
+		assert.LessOrEqual(t, delay, expected)
+	}
+
+	assert.LessOrEqual(t, policy.delay(100), 5*time.Second)
+	assert.Equal(t, time.Duration(0), RetryPolicy{}.delay(1))
+}
+
+func TestGetRetryAfter(t *testing.T) {
+	assert.Equal(t, time.Duration(0), getRetryAfter(""))
+	assert.Equal(t, time.Duration(0), getRetryAfter("soon"))
+	assert.Equal(t, 120*time.Second, getRetryAfter("120"))
+	assert.Equal(t, time.Duration(0), getRetryAfter(time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)))
+	assert.InDelta(t, float64(time.Hour), float64(getRetryAfter(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))), float64(2*time.Second))
+}
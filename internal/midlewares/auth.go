@@ -0,0 +1,173 @@
+package midlewares
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/jlucaspains/sharp-cert-manager/internal/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type principalKey struct{}
+
+// anonymous is used for every request when authentication is disabled
+var anonymous = models.Principal{Name: "anonymous", Role: models.RoleAdmin, Source: "none"}
+
+// getDummyPasswordHash is compared against the password of unknown users
+var getDummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("sharp-cert-manager"), bcrypt.DefaultCost)
+	return hash
+})
+
+// paths served without authentication
+var publicPaths = []string{"/health", "/static/", "/auth/"}
+
+// Auth authenticates requests with an API key, HTTP basic authentication or
+// the OIDC session cookie, in that order, and stores the caller in the
+// request context. Role checks are made by RequireRole on each route.
+type Auth struct {
+	handler http.Handler
+	config  models.AuthConfig
+	oidc    *OIDC
+}
+
+func NewAuth(handlerToWrap http.Handler, config models.AuthConfig, oidc *OIDC) *Auth {
+	return &Auth{handler: handlerToWrap, config: config, oidc: oidc}
+}
+
+func (a *Auth) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !a.config.IsEnabled() {
+		a.handler.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), anonymous)))
+		return
+	}
+
+	// CORS preflight requests never carry credentials
+	if isPublicPath(r.URL.Path) || r.Method == http.MethodOptions {
+		a.handler.ServeHTTP(w, r)
+		return
+	}
+
+	principal, ok := a.authenticate(r)
+
+	// a principal without a known role is not signed in
+	if !ok || !principal.Role.Allows(models.RoleViewer) {
+		a.challenge(w, r)
+		return
+	}
+
+	a.handler.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), principal)))
+}
+
+func (a *Auth) authenticate(r *http.Request) (models.Principal, bool) {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return a.authenticateKey(key)
+	}
+
+	if username, password, ok := r.BasicAuth(); ok {
+		return a.authenticateUser(username, password)
+	}
+
+	if a.oidc != nil {
+		return a.oidc.GetSession(r)
+	}
+
+	return models.Principal{}, false
+}
+
+func (a *Auth) authenticateKey(key string) (models.Principal, bool) {
+	hash := sha256.Sum256([]byte(key))
+	keyHash := hex.EncodeToString(hash[:])
+
+	for _, apiKey := range a.config.APIKeys {
+		if subtle.ConstantTimeCompare([]byte(keyHash), []byte(strings.ToLower(apiKey.KeyHash))) == 1 {
+			return models.Principal{Name: apiKey.Name, Role: apiKey.Role, Source: "apiKey"}, true
+		}
+	}
+
+	return models.Principal{}, false
+}
+
+func (a *Auth) authenticateUser(username string, password string) (models.Principal, bool) {
+	for _, user := range a.config.Users {
+		if user.Username != username {
+			continue
+		}
+
+		if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+			return models.Principal{}, false
+		}
+
+		return models.Principal{Name: user.Username, Role: user.Role, Source: "basic"}, true
+	}
+
+	// compare anyway so the response time does not tell which users exist
+	bcrypt.CompareHashAndPassword(getDummyPasswordHash(), []byte(password))
+
+	return models.Principal{}, false
+}
+
+// challenge sends browsers to the OIDC login and everything else a 401
+func (a *Auth) challenge(w http.ResponseWriter, r *http.Request) {
+	if a.oidc != nil && r.Method == http.MethodGet && !strings.HasPrefix(r.URL.Path, "/api/") && r.Header.Get("X-API-Key") == "" {
+		login := "/auth/login?redirect=" + url.QueryEscape(r.URL.RequestURI())
+
+		// htmx requests would swap the login page into the target element
+		if r.Header.Get("HX-Request") == "true" {
+			w.Header().Set("HX-Redirect", "/auth/login")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		http.Redirect(w, r, login, http.StatusFound)
+		return
+	}
+
+	if len(a.config.Users) > 0 {
+		w.Header().Set("WWW-Authenticate", `Basic realm="sharp-cert-manager", charset="UTF-8"`)
+	}
+
+	http.Error(w, "authentication required", http.StatusUnauthorized)
+}
+
+// RequireRole only lets callers with at least role through to handler
+func RequireRole(role models.Role, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !HasRole(r.Context(), role) {
+			http.Error(w, "you are not allowed to perform this action", http.StatusForbidden)
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+func WithPrincipal(ctx context.Context, principal models.Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+func GetPrincipal(ctx context.Context) (models.Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(models.Principal)
+	return principal, ok
+}
+
+// HasRole tells whether the caller of the request has at least role
+func HasRole(ctx context.Context, role models.Role) bool {
+	principal, ok := GetPrincipal(ctx)
+	return ok && principal.Role.Allows(role)
+}
+
+func isPublicPath(path string) bool {
+	for _, public := range publicPaths {
+		if path == public || (strings.HasSuffix(public, "/") && strings.HasPrefix(path, public)) {
+			return true
+		}
+	}
+
+	return false
+}
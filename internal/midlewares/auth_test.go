@@ -0,0 +1,122 @@
+package midlewares
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jlucaspains/sharp-cert-manager/internal/models"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func getKeyHash(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+func newAuthRouter(config models.AuthConfig, oidc *OIDC) http.Handler {
+	router := http.NewServeMux()
+	router.HandleFunc("GET /api/cert-list", RequireRole(models.RoleViewer, func(w http.ResponseWriter, r *http.Request) {
+		principal, _ := GetPrincipal(r.Context())
+		w.Write([]byte(principal.Name))
+	}))
+	router.HandleFunc("POST /api/certs", RequireRole(models.RoleAdmin, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+	router.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {})
+	router.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {})
+
+	return NewAuth(router, config, oidc)
+}
+
+func serve(handler http.Handler, method string, url string, setup func(r *http.Request)) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, url, nil)
+	if setup != nil {
+		setup(req)
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	return rr
+}
+
+func testAuthConfig() models.AuthConfig {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+
+	return models.AuthConfig{
+		APIKeys: []models.APIKeyConfig{
+			{Name: "ci", KeyHash: getKeyHash("admin-key"), Role: models.RoleAdmin},
+			{Name: "dashboard", KeyHash: getKeyHash("viewer-key"), Role: models.RoleViewer},
+		},
+		Users: []models.UserConfig{{Username: "jane", PasswordHash: string(hash), Role: models.RoleViewer}},
+	}
+}
+
+func TestAuthDisabled(t *testing.T) {
+	router := newAuthRouter(models.AuthConfig{}, nil)
+
+	assert.Equal(t, "anonymous", serve(router, "GET", "/api/cert-list", nil).Body.String())
+	assert.Equal(t, http.StatusCreated, serve(router, "POST", "/api/certs", nil).Code)
+}
+
+func TestAuthRequiresCredentials(t *testing.T) {
+	router := newAuthRouter(testAuthConfig(), nil)
+
+	rr := serve(router, "GET", "/api/cert-list", nil)
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Equal(t, `Basic realm="sharp-cert-manager", charset="UTF-8"`, rr.Header().Get("WWW-Authenticate"))
+	assert.Equal(t, http.StatusOK, serve(router, "GET", "/health", nil).Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, serve(router, "OPTIONS", "/api/cert-list", nil).Code)
+}
+
+func TestAuthAPIKey(t *testing.T) {
+	router := newAuthRouter(testAuthConfig(), nil)
+	withKey := func(key string) func(r *http.Request) {
+		return func(r *http.Request) { r.Header.Set("X-API-Key", key) }
+	}
+
+	assert.Equal(t, "ci", serve(router, "GET", "/api/cert-list", withKey("admin-key")).Body.String())
+	assert.Equal(t, http.StatusCreated, serve(router, "POST", "/api/certs", withKey("admin-key")).Code)
+	assert.Equal(t, "dashboard", serve(router, "GET", "/api/cert-list", withKey("viewer-key")).Body.String())
+	assert.Equal(t, http.StatusForbidden, serve(router, "POST", "/api/certs", withKey("viewer-key")).Code)
+	assert.Equal(t, http.StatusUnauthorized, serve(router, "GET", "/api/cert-list", withKey("other-key")).Code)
+}
+
+func TestAuthBasic(t *testing.T) {
+	router := newAuthRouter(testAuthConfig(), nil)
+	withUser := func(username string, password string) func(r *http.Request) {
+		return func(r *http.Request) { r.SetBasicAuth(username, password) }
+	}
+
+	assert.Equal(t, "jane", serve(router, "GET", "/api/cert-list", withUser("jane", "secret")).Body.String())
+	assert.Equal(t, http.StatusForbidden, serve(router, "POST", "/api/certs", withUser("jane", "secret")).Code)
+	assert.Equal(t, http.StatusUnauthorized, serve(router, "GET", "/api/cert-list", withUser("jane", "wrong")).Code)
+	assert.Equal(t, http.StatusUnauthorized, serve(router, "GET", "/api/cert-list", withUser("john", "secret")).Code)
+}
+
+func TestAuthRedirectsToOIDCLogin(t *testing.T) {
+	oidc, _ := NewOIDC(models.OIDCConfig{Issuer: "https://login.example.com", ClientID: "app", RedirectURL: "https://app/auth/callback"})
+	config := models.AuthConfig{OIDC: &models.OIDCConfig{}}
+	router := newAuthRouter(config, oidc)
+
+	rr := serve(router, "GET", "/?tag=public", nil)
+	htmx := serve(router, "GET", "/", func(r *http.Request) { r.Header.Set("HX-Request", "true") })
+
+	assert.Equal(t, http.StatusFound, rr.Code)
+	assert.Equal(t, "/auth/login?redirect=%2F%3Ftag%3Dpublic", rr.Header().Get("Location"))
+	assert.Equal(t, http.StatusUnauthorized, htmx.Code)
+	assert.Equal(t, "/auth/login", htmx.Header().Get("HX-Redirect"))
+	assert.Equal(t, http.StatusUnauthorized, serve(router, "GET", "/api/cert-list", nil).Code)
+}
+
+func TestRoleAllows(t *testing.T) {
+	assert.True(t, models.RoleAdmin.Allows(models.RoleViewer))
+	assert.True(t, models.RoleViewer.Allows(models.RoleViewer))
+	assert.False(t, models.RoleViewer.Allows(models.RoleAdmin))
+	assert.False(t, models.Role("").Allows(models.RoleViewer))
+}
@@ -0,0 +1,473 @@
+package midlewares
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jlucaspains/sharp-cert-manager/internal/models"
+)
+
+const (
+	sessionCookie = "sharp_session"
+	stateCookie   = "sharp_oidc_state"
+)
+
+var errUnknownKey = errors.New("unknown signing key")
+
+type oidcProvider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type oidcState struct {
+	State    string    `json:"state"`
+	Nonce    string    `json:"nonce"`
+	Verifier string    `json:"verifier"`
+	Redirect string    `json:"redirect"`
+	Expires  time.Time `json:"expires"`
+}
+
+type oidcSession struct {
+	Name    string      `json:"name"`
+	Role    models.Role `json:"role"`
+	Expires time.Time   `json:"expires"`
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// OIDC signs users of the web frontend in with the authorization code flow
+// and PKCE. The provider endpoints and keys are discovered from the issuer on
+// first use. The session is kept in a signed cookie so no server state is
+// needed; sessions do not survive a restart unless SessionKey is set.
+type OIDC struct {
+	config     models.OIDCConfig
+	client     *http.Client
+	sessionKey []byte
+	sessionTTL time.Duration
+	secure     bool
+	provider   *oidcProvider
+	keys       map[string]crypto.PublicKey
+	lock       sync.Mutex
+}
+
+func NewOIDC(config models.OIDCConfig) (*OIDC, error) {
+	sessionKey := []byte(config.SessionKey)
+
+	if len(sessionKey) == 0 {
+		sessionKey = make([]byte, 32)
+		if _, err := rand.Read(sessionKey); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "profile", "email"}
+	}
+
+	if config.RoleClaim == "" {
+		config.RoleClaim = "roles"
+	}
+
+	sessionHours := config.SessionHours
+	if sessionHours <= 0 {
+		sessionHours = 8
+	}
+
+	return &OIDC{
+		config:     config,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		sessionKey: sessionKey,
+		sessionTTL: time.Duration(sessionHours) * time.Hour,
+		secure:     strings.HasPrefix(config.RedirectURL, "https://"),
+	}, nil
+}
+
+// Login redirects to the provider authorization endpoint
+func (o *OIDC) Login(w http.ResponseWriter, r *http.Request) {
+	provider, err := o.getProvider()
+
+	if err != nil {
+		log.Printf("Error discovering OIDC provider: %s", err)
+		http.Error(w, "the identity provider is not available", http.StatusBadGateway)
+		return
+	}
+
+	state := oidcState{
+		State:    randomString(),
+		Nonce:    randomString(),
+		Verifier: randomString(),
+		Redirect: getLocalRedirect(r.URL.Query().Get("redirect")),
+		Expires:  time.Now().Add(10 * time.Minute),
+	}
+
+	o.setCookie(w, stateCookie, state, state.Expires)
+
+	challenge := sha256.Sum256([]byte(state.Verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {o.config.ClientID},
+		"redirect_uri":          {o.config.RedirectURL},
+		"scope":                 {strings.Join(o.config.Scopes, " ")},
+		"state":                 {state.State},
+		"nonce":                 {state.Nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	http.Redirect(w, r, provider.AuthorizationEndpoint+"?"+query.Encode(), http.StatusFound)
+}
+
+// Callback completes the login started by Login and creates the session
+func (o *OIDC) Callback(w http.ResponseWriter, r *http.Request) {
+	state := oidcState{}
+	ok := o.readCookie(r, stateCookie, &state)
+	o.clearCookie(w, stateCookie)
+
+	if !ok || time.Now().After(state.Expires) || r.URL.Query().Get("state") != state.State {
+		http.Error(w, "the login request is invalid or expired", http.StatusBadRequest)
+		return
+	}
+
+	if errorCode := r.URL.Query().Get("error"); errorCode != "" {
+		http.Error(w, fmt.Sprintf("the identity provider returned %s", errorCode), http.StatusUnauthorized)
+		return
+	}
+
+	claims, err := o.exchange(r.URL.Query().Get("code"), state)
+
+	if err != nil {
+		log.Printf("Error completing OIDC login: %s", err)
+		http.Error(w, "failed to complete the login", http.StatusUnauthorized)
+		return
+	}
+
+	role, ok := o.getRole(claims)
+
+	if !ok {
+		http.Error(w, "you are not allowed to use this app", http.StatusForbidden)
+		return
+	}
+
+	session := oidcSession{Name: getClaimName(claims), Role: role, Expires: time.Now().Add(o.sessionTTL)}
+	o.setCookie(w, sessionCookie, session, session.Expires)
+
+	http.Redirect(w, r, state.Redirect, http.StatusFound)
+}
+
+func (o *OIDC) Logout(w http.ResponseWriter, r *http.Request) {
+	o.clearCookie(w, sessionCookie)
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// GetSession returns the user signed in through the session cookie
+func (o *OIDC) GetSession(r *http.Request) (models.Principal, bool) {
+	session := oidcSession{}
+
+	if !o.readCookie(r, sessionCookie, &session) || time.Now().After(session.Expires) {
+		return models.Principal{}, false
+	}
+
+	return models.Principal{Name: session.Name, Role: session.Role, Source: "oidc"}, true
+}
+
+func (o *OIDC) exchange(code string, state oidcState) (jwt.MapClaims, error) {
+	provider, err := o.getProvider()
+
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {o.config.RedirectURL},
+		"client_id":     {o.config.ClientID},
+		"code_verifier": {state.Verifier},
+	}
+
+	if o.config.ClientSecret != "" {
+		form.Set("client_secret", o.config.ClientSecret)
+	}
+
+	resp, err := o.client.PostForm(provider.TokenEndpoint, form)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint returned %d", resp.StatusCode)
+	}
+
+	token := struct {
+		IDToken string `json:"id_token"`
+	}{}
+
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return nil, err
+	}
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(token.IDToken, claims, o.getKey,
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(provider.Issuer),
+		jwt.WithAudience(o.config.ClientID),
+		jwt.WithExpirationRequired())
+
+	if err != nil {
+		return nil, err
+	}
+
+	if nonce, _ := claims["nonce"].(string); nonce != state.Nonce {
+		return nil, errors.New("id token nonce does not match")
+	}
+
+	return claims, nil
+}
+
+// getRole maps the role claim to a role. ok is false when the user has none
+// of the configured roles.
+func (o *OIDC) getRole(claims jwt.MapClaims) (models.Role, bool) {
+	values := []string{}
+
+	switch claim := claims[o.config.RoleClaim].(type) {
+	case string:
+		values = append(values, claim)
+	case []any:
+		for _, value := range claim {
+			if value, ok := value.(string); ok {
+				values = append(values, value)
+			}
+		}
+	}
+
+	hasAny := func(roles []string) bool {
+		return slices.ContainsFunc(values, func(value string) bool { return slices.Contains(roles, value) })
+	}
+
+	if hasAny(o.config.AdminRoles) {
+		return models.RoleAdmin, true
+	}
+
+	if len(o.config.ViewerRoles) == 0 || hasAny(o.config.ViewerRoles) {
+		return models.RoleViewer, true
+	}
+
+	return "", false
+}
+
+func (o *OIDC) getProvider() (*oidcProvider, error) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if o.provider != nil {
+		return o.provider, nil
+	}
+
+	provider := &oidcProvider{}
+	if err := o.getJSON(strings.TrimSuffix(o.config.Issuer, "/")+"/.well-known/openid-configuration", provider); err != nil {
+		return nil, err
+	}
+
+	o.provider = provider
+
+	return provider, nil
+}
+
+// getKey finds the key that signed token. The keys are fetched again once
+// when the key id is unknown so provider key rotations are picked up.
+func (o *OIDC) getKey(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	o.lock.Lock()
+	key, ok := o.keys[kid]
+	o.lock.Unlock()
+
+	if ok {
+		return key, nil
+	}
+
+	if err := o.loadKeys(); err != nil {
+		return nil, err
+	}
+
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if key, ok := o.keys[kid]; ok {
+		return key, nil
+	}
+
+	return nil, errUnknownKey
+}
+
+func (o *OIDC) loadKeys() error {
+	provider, err := o.getProvider()
+
+	if err != nil {
+		return err
+	}
+
+	jwks := struct {
+		Keys []jsonWebKey `json:"keys"`
+	}{}
+
+	if err := o.getJSON(provider.JWKSURI, &jwks); err != nil {
+		return err
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, jwk := range jwks.Keys {
+		if key, err := jwk.publicKey(); err == nil {
+			keys[jwk.Kid] = key
+		}
+	}
+
+	o.lock.Lock()
+	o.keys = keys
+	o.lock.Unlock()
+
+	return nil
+}
+
+func (o *OIDC) getJSON(url string, result any) error {
+	resp, err := o.client.Get(url)
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %d", url, resp.StatusCode)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	decode := func(value string) *big.Int {
+		bytes, _ := base64.RawURLEncoding.DecodeString(value)
+		return new(big.Int).SetBytes(bytes)
+	}
+
+	switch k.Kty {
+	case "RSA":
+		return &rsa.PublicKey{N: decode(k.N), E: int(decode(k.E).Int64())}, nil
+	case "EC":
+		curves := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}
+		curve, ok := curves[k.Crv]
+
+		if !ok {
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: decode(k.X), Y: decode(k.Y)}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+}
+
+// setCookie stores value as signed JSON so it cannot be forged by the client.
+// The signature covers the cookie name so a cookie cannot be replayed as
+// another, e.g. the login state as the session.
+func (o *OIDC) setCookie(w http.ResponseWriter, name string, value any, expires time.Time) {
+	payload, _ := json.Marshal(value)
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    encoded + "." + o.sign(name, encoded),
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   o.secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (o *OIDC) readCookie(r *http.Request, name string, value any) bool {
+	cookie, err := r.Cookie(name)
+
+	if err != nil {
+		return false
+	}
+
+	encoded, signature, ok := strings.Cut(cookie.Value, ".")
+
+	if !ok || !hmac.Equal([]byte(signature), []byte(o.sign(name, encoded))) {
+		return false
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+
+	return err == nil && json.Unmarshal(payload, value) == nil
+}
+
+func (o *OIDC) clearCookie(w http.ResponseWriter, name string) {
+	http.SetCookie(w, &http.Cookie{Name: name, Value: "", Path: "/", MaxAge: -1, HttpOnly: true, Secure: o.secure})
+}
+
+func (o *OIDC) sign(name string, value string) string {
+	mac := hmac.New(sha256.New, o.sessionKey)
+	mac.Write([]byte(name + "." + value))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func getClaimName(claims jwt.MapClaims) string {
+	for _, claim := range []string{"preferred_username", "email", "sub"} {
+		if name, ok := claims[claim].(string); ok && name != "" {
+			return name
+		}
+	}
+
+	return ""
+}
+
+// getLocalRedirect prevents the login from redirecting to other sites
+func getLocalRedirect(redirect string) string {
+	if !strings.HasPrefix(redirect, "/") || strings.HasPrefix(redirect, "//") || strings.HasPrefix(redirect, "/\\") {
+		return "/"
+	}
+
+	return redirect
+}
+
+func randomString() string {
+	bytes := make([]byte, 32)
+	rand.Read(bytes)
+
+	return base64.RawURLEncoding.EncodeToString(bytes)
+}
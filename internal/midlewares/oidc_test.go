@@ -0,0 +1,226 @@
+package midlewares
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jlucaspains/sharp-cert-manager/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeProvider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	claims jwt.MapClaims
+	nonce  string
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	provider := &fakeProvider{key: key, claims: jwt.MapClaims{}}
+
+	router := http.NewServeMux()
+	router.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidcProvider{
+			Issuer:                provider.server.URL,
+			AuthorizationEndpoint: provider.server.URL + "/authorize",
+			TokenEndpoint:         provider.server.URL + "/token",
+			JWKSURI:               provider.server.URL + "/keys",
+		})
+	})
+	router.HandleFunc("GET /keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []jsonWebKey{{
+			Kty: "RSA",
+			Kid: "test",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	router.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("code") != "valid-code" || r.PostFormValue("code_verifier") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		claims := jwt.MapClaims{
+			"iss":   provider.server.URL,
+			"aud":   "app",
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"nonce": provider.nonce,
+		}
+		for name, value := range provider.claims {
+			claims[name] = value
+		}
+
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "test"
+		signed, _ := token.SignedString(key)
+
+		json.NewEncoder(w).Encode(map[string]string{"id_token": signed})
+	})
+
+	provider.server = httptest.NewServer(router)
+	t.Cleanup(provider.server.Close)
+
+	return provider
+}
+
+// login runs the flow up to the callback and returns its response
+func (p *fakeProvider) login(t *testing.T, oidc *OIDC, code string) *httptest.ResponseRecorder {
+	rr := serve(http.HandlerFunc(oidc.Login), "GET", "/auth/login?redirect=/item", nil)
+	assert.Equal(t, http.StatusFound, rr.Code)
+
+	location, _ := url.Parse(rr.Header().Get("Location"))
+	assert.Equal(t, p.server.URL+"/authorize", location.Scheme+"://"+location.Host+location.Path)
+	assert.Equal(t, "S256", location.Query().Get("code_challenge_method"))
+	p.nonce = location.Query().Get("nonce")
+
+	return serve(http.HandlerFunc(oidc.Callback), "GET", "/auth/callback?code="+code+"&state="+location.Query().Get("state"), func(r *http.Request) {
+		for _, cookie := range rr.Result().Cookies() {
+			r.AddCookie(cookie)
+		}
+	})
+}
+
+func newTestOIDC(provider *fakeProvider) *OIDC {
+	oidc, _ := NewOIDC(models.OIDCConfig{
+		Issuer:      provider.server.URL,
+		ClientID:    "app",
+		RedirectURL: "http://localhost:8000/auth/callback",
+		RoleClaim:   "groups",
+		AdminRoles:  []string{"cert-admins"},
+		ViewerRoles: []string{"cert-viewers"},
+	})
+
+	return oidc
+}
+
+func TestOIDCLogin(t *testing.T) {
+	provider := newFakeProvider(t)
+	provider.claims = jwt.MapClaims{"preferred_username": "jane", "groups": []string{"cert-admins"}}
+	oidc := newTestOIDC(provider)
+
+	rr := provider.login(t, oidc, "valid-code")
+
+	assert.Equal(t, http.StatusFound, rr.Code)
+	assert.Equal(t, "/item", rr.Header().Get("Location"))
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	for _, cookie := range rr.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+
+	principal, ok := oidc.GetSession(req)
+
+	assert.True(t, ok)
+	assert.Equal(t, models.Principal{Name: "jane", Role: models.RoleAdmin, Source: "oidc"}, principal)
+}
+
+func TestOIDCLoginViewer(t *testing.T) {
+	provider := newFakeProvider(t)
+	provider.claims = jwt.MapClaims{"email": "john@example.com", "groups": "cert-viewers"}
+	oidc := newTestOIDC(provider)
+
+	rr := provider.login(t, oidc, "valid-code")
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	for _, cookie := range rr.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+
+	principal, ok := oidc.GetSession(req)
+
+	assert.True(t, ok)
+	assert.Equal(t, "john@example.com", principal.Name)
+	assert.Equal(t, models.RoleViewer, principal.Role)
+}
+
+func TestOIDCLoginWithoutRole(t *testing.T) {
+	provider := newFakeProvider(t)
+	provider.claims = jwt.MapClaims{"sub": "123", "groups": []string{"other"}}
+
+	rr := provider.login(t, newTestOIDC(provider), "valid-code")
+
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+}
+
+func TestOIDCLoginInvalidCode(t *testing.T) {
+	provider := newFakeProvider(t)
+
+	rr := provider.login(t, newTestOIDC(provider), "invalid-code")
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+func TestOIDCCallbackInvalidState(t *testing.T) {
+	provider := newFakeProvider(t)
+
+	rr := serve(http.HandlerFunc(newTestOIDC(provider).Callback), "GET", "/auth/callback?code=valid-code&state=forged", nil)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestOIDCSessionTampered(t *testing.T) {
+	provider := newFakeProvider(t)
+	oidc := newTestOIDC(provider)
+	other := newTestOIDC(provider)
+
+	rr := httptest.NewRecorder()
+	other.setCookie(rr, sessionCookie, oidcSession{Name: "jane", Role: models.RoleAdmin, Expires: time.Now().Add(time.Hour)}, time.Now().Add(time.Hour))
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.AddCookie(rr.Result().Cookies()[0])
+
+	_, ok := oidc.GetSession(req)
+	_, otherOk := other.GetSession(req)
+
+	assert.False(t, ok)
+	assert.True(t, otherOk)
+}
+
+func TestOIDCStateCookieAsSession(t *testing.T) {
+	provider := newFakeProvider(t)
+	oidc := newTestOIDC(provider)
+	router := newAuthRouter(models.AuthConfig{OIDC: &models.OIDCConfig{}}, oidc)
+
+	login := serve(http.HandlerFunc(oidc.Login), "GET", "/auth/login", nil)
+	state := login.Result().Cookies()[0]
+	assert.Equal(t, stateCookie, state.Name)
+
+	swapped := func(r *http.Request) { r.AddCookie(&http.Cookie{Name: sessionCookie, Value: state.Value}) }
+	req, _ := http.NewRequest("GET", "/", nil)
+	swapped(req)
+
+	_, ok := oidc.GetSession(req)
+
+	assert.False(t, ok)
+	assert.Equal(t, http.StatusUnauthorized, serve(router, "GET", "/api/cert-list", swapped).Code)
+}
+
+func TestOIDCSessionWithoutRole(t *testing.T) {
+	provider := newFakeProvider(t)
+	oidc := newTestOIDC(provider)
+	router := newAuthRouter(models.AuthConfig{OIDC: &models.OIDCConfig{}}, oidc)
+
+	rr := httptest.NewRecorder()
+	oidc.setCookie(rr, sessionCookie, oidcSession{Name: "jane", Expires: time.Now().Add(time.Hour)}, time.Now().Add(time.Hour))
+	cookie := rr.Result().Cookies()[0]
+
+	assert.Equal(t, http.StatusUnauthorized, serve(router, "GET", "/api/cert-list", func(r *http.Request) { r.AddCookie(cookie) }).Code)
+}
+
+func TestGetLocalRedirect(t *testing.T) {
+	assert.Equal(t, "/item?name=a", getLocalRedirect("/item?name=a"))
+	assert.Equal(t, "/", getLocalRedirect("https://evil.example.com"))
+	assert.Equal(t, "/", getLocalRedirect("//evil.example.com"))
+	assert.Equal(t, "/", getLocalRedirect(""))
+}
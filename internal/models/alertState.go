@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+const (
+	AlertOK      = "ok"
+	AlertWarning = "warning"
+	AlertError   = "error"
+)
+
+// AlertState is the last alert sent for a target. The job only notifies
+// again when it changes, escalates or a reminder is due.
+type AlertState struct {
+	Name         string     `json:"name"`
+	Status       string     `json:"status"`
+	Threshold    int        `json:"threshold,omitempty"`
+	NotifiedAt   time.Time  `json:"notifiedAt"`
+	SnoozedUntil *time.Time `json:"snoozedUntil,omitempty"`
+	SnoozedBy    string     `json:"snoozedBy,omitempty"`
+	Comment      string     `json:"comment,omitempty"`
+}
+
+// IsSnoozed tells whether notifications about the target are suppressed
+func (s AlertState) IsSnoozed(now time.Time) bool {
+	return s.SnoozedUntil != nil && now.Before(*s.SnoozedUntil)
+}
+
+// IsAlerting tells whether the last alert was a warning or an error
+func (s AlertState) IsAlerting() bool {
+	return s.Status == AlertWarning || s.Status == AlertError
+}
+
+// SnoozeParams acknowledges the alerts of a target until the given time
+type SnoozeParams struct {
+	Until   time.Time `json:"until"`
+	Comment string    `json:"comment"`
+}
@@ -0,0 +1,68 @@
+package models
+
+type Role string
+
+const (
+	RoleViewer Role = "viewer"
+	RoleAdmin  Role = "admin"
+)
+
+var roleRanks = map[Role]int{
+	RoleViewer: 1,
+	RoleAdmin:  2,
+}
+
+// Allows tells whether r grants at least the permissions of required
+func (r Role) Allows(required Role) bool {
+	return roleRanks[r] > 0 && roleRanks[r] >= roleRanks[required]
+}
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	Name   string
+	Role   Role
+	Source string
+}
+
+// AuthConfig lists the accepted credentials as written in AUTH_CONFIG_FILE.
+// Authentication is disabled when nothing is configured.
+type AuthConfig struct {
+	APIKeys []APIKeyConfig `json:"apiKeys" yaml:"apiKeys" validate:"unique=Name,dive"`
+	Users   []UserConfig   `json:"users" yaml:"users" validate:"unique=Username,dive"`
+	OIDC    *OIDCConfig    `json:"oidc" yaml:"oidc" validate:"omitempty"`
+}
+
+// APIKeyConfig is a static key sent in the X-API-Key header. Only the hex
+// encoded sha256 of the key is kept in the configuration.
+type APIKeyConfig struct {
+	Name    string `json:"name" yaml:"name" validate:"required"`
+	KeyHash string `json:"keyHash" yaml:"keyHash" validate:"required,sha256"`
+	Role    Role   `json:"role" yaml:"role" validate:"required,oneof=viewer admin"`
+}
+
+// UserConfig is a user accepted through HTTP basic authentication
+type UserConfig struct {
+	Username     string `json:"username" yaml:"username" validate:"required"`
+	PasswordHash string `json:"passwordHash" yaml:"passwordHash" validate:"required,bcrypt"`
+	Role         Role   `json:"role" yaml:"role" validate:"required,oneof=viewer admin"`
+}
+
+// OIDCConfig enables the OpenID Connect login for the web frontend. The role
+// is read from RoleClaim: users with one of AdminRoles are admins and, when
+// ViewerRoles is set, only users with one of them are allowed in as viewers.
+type OIDCConfig struct {
+	Issuer       string   `json:"issuer" yaml:"issuer" validate:"required,url"`
+	ClientID     string   `json:"clientId" yaml:"clientId" validate:"required"`
+	ClientSecret string   `json:"clientSecret" yaml:"clientSecret"`
+	RedirectURL  string   `json:"redirectUrl" yaml:"redirectUrl" validate:"required,url"`
+	Scopes       []string `json:"scopes" yaml:"scopes"`
+	RoleClaim    string   `json:"roleClaim" yaml:"roleClaim"`
+	AdminRoles   []string `json:"adminRoles" yaml:"adminRoles"`
+	ViewerRoles  []string `json:"viewerRoles" yaml:"viewerRoles"`
+	SessionKey   string   `json:"sessionKey" yaml:"sessionKey" validate:"omitempty,min=32"`
+	SessionHours int      `json:"sessionHours" yaml:"sessionHours" validate:"gte=0"`
+}
+
+func (c AuthConfig) IsEnabled() bool {
+	return len(c.APIKeys) > 0 || len(c.Users) > 0 || c.OIDC != nil
+}
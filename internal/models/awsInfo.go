@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// AWSInfo is the AWS metadata of an ACM or IAM server certificate
+type AWSInfo struct {
+	Service            string    `json:"service"`
+	Arn                string    `json:"arn"`
+	Region             string    `json:"region"`
+	Status             string    `json:"status"`
+	Type               string    `json:"type"`
+	InUse              bool      `json:"inUse"`
+	InUseBy            []string  `json:"inUseBy"`
+	RenewalEligibility string    `json:"renewalEligibility"`
+	RenewalStatus      string    `json:"renewalStatus"`
+	AutoRenew          bool      `json:"autoRenew"`
+	NotAfter           time.Time `json:"notAfter"`
+}
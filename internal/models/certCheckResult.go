@@ -9,20 +9,31 @@ type OtherCert struct {
 }
 
 type CertCheckResult struct {
-	Hostname          string      `json:"hostname"`
-	Issuer            string      `json:"issuer"`
-	Signature         string      `json:"signature"`
-	CertStartDate     time.Time   `json:"certStartDate"`
-	CertEndDate       time.Time   `json:"certEndDate"`
-	CertDnsNames      []string    `json:"certDnsNames"`
-	IsValid           bool        `json:"isValid"`
-	TLSVersion        uint16      `json:"tlsVersion"`
-	IsCA              bool        `json:"isCA"`
-	CommonName        string      `json:"commonName"`
-	OtherCerts        []OtherCert `json:"otherCerts"`
-	ValidationIssues  []string    `json:"validationIssues"`
-	ExpirationWarning bool        `json:"expirationWarning"`
-	ValidityInDays    int         `json:"validityInDays"`
+	Hostname             string        `json:"hostname"`
+	Issuer               string        `json:"issuer"`
+	Signature            string        `json:"signature"`
+	CertStartDate        time.Time     `json:"certStartDate"`
+	CertEndDate          time.Time     `json:"certEndDate"`
+	CertDnsNames         []string      `json:"certDnsNames"`
+	IsValid              bool          `json:"isValid"`
+	TLSVersion           string        `json:"tlsVersion"`
+	CipherSuite          string        `json:"cipherSuite"`
+	SupportedTLSVersions []string      `json:"supportedTlsVersions"`
+	IsCA                 bool          `json:"isCA"`
+	CommonName           string        `json:"commonName"`
+	SerialNumber         string        `json:"serialNumber"`
+	Fingerprint          string        `json:"fingerprint"`
+	KeyType              string        `json:"keyType"`
+	OtherCerts           []OtherCert   `json:"otherCerts"`
+	ValidationIssues     []string      `json:"validationIssues"`
+	ExpirationWarning    bool          `json:"expirationWarning"`
+	ValidityInDays       int           `json:"validityInDays"`
+	RevocationStatus     string        `json:"revocationStatus"`
+	RevocationSource     string        `json:"revocationSource"`
+	RevokedAt            time.Time     `json:"revokedAt"`
+	CheckedAt            time.Time     `json:"checkedAt"`
+	KeyVault             *KeyVaultInfo `json:"keyVault,omitempty"`
+	AWS                  *AWSInfo      `json:"aws,omitempty"`
 }
 
 type CertCheckType int
@@ -30,10 +41,31 @@ type CertCheckType int
 const (
 	CertCheckURL   CertCheckType = iota
 	CertCheckAzure CertCheckType = iota
+	// CertCheckAzureVault is expanded into one CertCheckAzure item for each
+	// enabled certificate version in the vault
+	CertCheckAzureVault CertCheckType = iota
+	// CertCheckAWS is an ACM or IAM server certificate identified by its ARN
+	CertCheckAWS CertCheckType = iota
+	// CertCheckAWSSource is expanded into one CertCheckAWS item for each ACM
+	// certificate in a region or each IAM server certificate
+	CertCheckAWSSource CertCheckType = iota
+	// CertCheckVault is a HashiCorp Vault PKI certificate identified by its
+	// serial or a PEM bundle stored in a KV v2 secret
+	CertCheckVault CertCheckType = iota
+	// CertCheckVaultPKI is expanded into one CertCheckVault item for each
+	// certificate issued by a HashiCorp Vault PKI mount
+	CertCheckVaultPKI CertCheckType = iota
 )
 
 type CheckCertItem struct {
-	Name string        `json:"name"`
-	Url  string        `json:"url"`
-	Type CertCheckType `json:"type"`
+	Name        string        `json:"name"`
+	Url         string        `json:"url"`
+	Type        CertCheckType `json:"type"`
+	WarningDays int           `json:"warningDays,omitempty"`
+	Tags        []string      `json:"tags,omitempty"`
+	SNI         string        `json:"sni,omitempty"`
+	IP          string        `json:"ip,omitempty"`
+	Recipients  []string      `json:"recipients,omitempty"`
+	Include     []string      `json:"include,omitempty"`
+	Exclude     []string      `json:"exclude,omitempty"`
 }
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+type CertHistoryEntry struct {
+	Name      string          `json:"name"`
+	CheckedAt time.Time       `json:"checkedAt"`
+	Result    CertCheckResult `json:"result"`
+	Error     string          `json:"error,omitempty"`
+	Rotated   bool            `json:"rotated"`
+}
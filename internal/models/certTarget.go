@@ -0,0 +1,16 @@
+package models
+
+// CertTargetParams describes a monitored target as written in the config
+// file or sent to the target management API.
+type CertTargetParams struct {
+	Name        string   `json:"name" yaml:"name" validate:"required"`
+	Type        string   `json:"type" yaml:"type" validate:"omitempty,oneof=url azure aws vault"`
+	Url         string   `json:"url" yaml:"url" validate:"required,url"`
+	WarningDays int      `json:"warningDays" yaml:"warningDays" validate:"gte=0"`
+	Tags        []string `json:"tags" yaml:"tags" validate:"dive,required"`
+	SNI         string   `json:"sni" yaml:"sni" validate:"omitempty,hostname"`
+	IP          string   `json:"ip" yaml:"ip" validate:"omitempty,ip"`
+	Recipients  []string `json:"recipients" yaml:"recipients" validate:"dive,email"`
+	Include     []string `json:"include" yaml:"include" validate:"dive,required"`
+	Exclude     []string `json:"exclude" yaml:"exclude" validate:"dive,required"`
+}
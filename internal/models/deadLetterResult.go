@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// DeadLetterResult is a failed notification without the webhook URL path,
+// headers and body, which may hold secrets such as tokens or routing keys
+type DeadLetterResult struct {
+	ID        string    `json:"id"`
+	Notifier  string    `json:"notifier"`
+	Host      string    `json:"host"`
+	Error     string    `json:"error"`
+	Attempts  int       `json:"attempts"`
+	CreatedAt time.Time `json:"createdAt"`
+}
@@ -0,0 +1,22 @@
+package models
+
+// KeyVaultInfo is the Azure Key Vault metadata of a certificate, including
+// whether its policy renews it automatically.
+type KeyVaultInfo struct {
+	Enabled          bool              `json:"enabled"`
+	Expired          bool              `json:"expired"`
+	IssuerName       string            `json:"issuerName"`
+	CertificateType  string            `json:"certificateType"`
+	ValidityInMonths int               `json:"validityInMonths"`
+	AutoRenew        bool              `json:"autoRenew"`
+	LifetimeActions  []LifetimeAction  `json:"lifetimeActions"`
+	Tags             map[string]string `json:"tags"`
+}
+
+// LifetimeAction is an action of the certificate policy triggered some days
+// before the certificate expires or at a percentage of its lifetime
+type LifetimeAction struct {
+	Action             string `json:"action"`
+	DaysBeforeExpiry   int    `json:"daysBeforeExpiry,omitempty"`
+	LifetimePercentage int    `json:"lifetimePercentage,omitempty"`
+}
@@ -0,0 +1,44 @@
+package models
+
+// NotificationsConfig lists the channels notified by the job as written in
+// NOTIFICATIONS_CONFIG_FILE
+type NotificationsConfig struct {
+	Channels []NotificationChannelConfig `json:"channels" yaml:"channels" validate:"required,min=1,unique=Name,dive"`
+}
+
+// NotificationChannelConfig is a single destination of notifications. Items
+// are sent when any of the rules match or always when there are no rules.
+type NotificationChannelConfig struct {
+	Name            string             `json:"name" yaml:"name" validate:"required"`
+	Type            string             `json:"type" yaml:"type" validate:"required,oneof=teams slack custom discord googlechat mattermost pagerduty email"`
+	Url             string             `json:"url" yaml:"url" validate:"required_if=Type teams,required_if=Type slack,required_if=Type custom,required_if=Type discord,required_if=Type googlechat,required_if=Type mattermost,omitempty,url"`
+	RoutingKey      string             `json:"routingKey" yaml:"routingKey" validate:"required_if=Type pagerduty"`
+	Title           string             `json:"title" yaml:"title"`
+	Body            string             `json:"body" yaml:"body"`
+	NotificationUrl string             `json:"notificationUrl" yaml:"notificationUrl"`
+	Mentions        []string           `json:"mentions" yaml:"mentions"`
+	Template        string             `json:"template" yaml:"template" validate:"required_if=Type custom"`
+	Method          string             `json:"method" yaml:"method"`
+	ContentType     string             `json:"contentType" yaml:"contentType"`
+	Headers         map[string]string  `json:"headers" yaml:"headers"`
+	SMTP            *SMTPConfig        `json:"smtp" yaml:"smtp" validate:"required_if=Type email"`
+	Rules           []NotificationRule `json:"rules" yaml:"rules" validate:"dive"`
+}
+
+type SMTPConfig struct {
+	Host     string   `json:"host" yaml:"host" validate:"required"`
+	Port     int      `json:"port" yaml:"port" validate:"gte=0"`
+	Username string   `json:"username" yaml:"username"`
+	Password string   `json:"password" yaml:"password"`
+	From     string   `json:"from" yaml:"from" validate:"required"`
+	To       []string `json:"to" yaml:"to" validate:"required,min=1,dive,email"`
+	TLS      string   `json:"tls" yaml:"tls" validate:"omitempty,oneof=starttls tls none"`
+}
+
+// NotificationRule matches items that have one of the tags, a name matching
+// one of the glob patterns and one of the severities. Empty lists match all.
+type NotificationRule struct {
+	Tags       []string `json:"tags" yaml:"tags"`
+	Names      []string `json:"names" yaml:"names"`
+	Severities []string `json:"severities" yaml:"severities" validate:"dive,oneof=error warning info"`
+}
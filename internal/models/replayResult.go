@@ -0,0 +1,7 @@
+package models
+
+// ReplayResult reports a replay of the notification dead letters
+type ReplayResult struct {
+	Replayed int      `json:"replayed"`
+	Errors   []string `json:"errors"`
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jlucaspains/sharp-cert-manager/internal/models"
+)
+
+// AlertStore keeps the alert state and snoozes of every target in a JSON file
+// so alerts are not sent again after a restart.
+type AlertStore struct {
+	path   string
+	states map[string]models.AlertState
+	lock   sync.RWMutex
+}
+
+func NewAlertStore(path string) (*AlertStore, error) {
+	store := &AlertStore{path: path, states: map[string]models.AlertState{}}
+	content, err := os.ReadFile(path)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	states := []models.AlertState{}
+	if err := json.Unmarshal(content, &states); err != nil {
+		return nil, err
+	}
+
+	for _, state := range states {
+		store.states[state.Name] = state
+	}
+
+	return store, nil
+}
+
+func (s *AlertStore) Get(name string) models.AlertState {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	state, ok := s.states[name]
+	if !ok {
+		state.Name = name
+	}
+
+	return state
+}
+
+// List returns the state of every target ordered by name
+func (s *AlertStore) List() []models.AlertState {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return slices.SortedFunc(maps.Values(s.states), func(a, b models.AlertState) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+}
+
+// Record saves the alert state of the targets and drops the states of the
+// ones no longer in certList. Snoozes are kept as they are so one set while
+// the job runs is not lost.
+func (s *AlertStore) Record(certList []models.CheckCertItem, states ...models.AlertState) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for name := range s.states {
+		if !slices.ContainsFunc(certList, func(c models.CheckCertItem) bool { return c.Name == name }) {
+			delete(s.states, name)
+		}
+	}
+
+	for _, state := range states {
+		current := s.states[state.Name]
+		state.SnoozedUntil, state.SnoozedBy, state.Comment = current.SnoozedUntil, current.SnoozedBy, current.Comment
+		s.states[state.Name] = state
+	}
+
+	return s.save()
+}
+
+// Snooze suppresses the notifications about a target until the given time
+func (s *AlertStore) Snooze(name string, until time.Time, by string, comment string) (models.AlertState, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	state := s.states[name]
+	state.Name = name
+	state.SnoozedUntil = &until
+	state.SnoozedBy = by
+	state.Comment = comment
+	s.states[name] = state
+
+	return state, s.save()
+}
+
+func (s *AlertStore) Unsnooze(name string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	state, ok := s.states[name]
+	if !ok {
+		return nil
+	}
+
+	state.SnoozedUntil, state.SnoozedBy, state.Comment = nil, "", ""
+	s.states[name] = state
+
+	return s.save()
+}
+
+// save must be called with the lock held
+func (s *AlertStore) save() error {
+	states := slices.SortedFunc(maps.Values(s.states), func(a, b models.AlertState) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	content, err := json.MarshalIndent(states, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(s.path, content)
+}
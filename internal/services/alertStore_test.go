@@ -0,0 +1,86 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jlucaspains/sharp-cert-manager/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAlertStoreMissingFile(t *testing.T) {
+	store, err := NewAlertStore(filepath.Join(t.TempDir(), "alerts.json"))
+
+	assert.Nil(t, err)
+	assert.Empty(t, store.List())
+	assert.Equal(t, models.AlertState{Name: "blog"}, store.Get("blog"))
+}
+
+func TestAlertStoreRecordAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "alerts.json")
+	store, _ := NewAlertStore(path)
+	notifiedAt := time.Date(2026, 10, 1, 8, 0, 0, 0, time.UTC)
+
+	err := store.Record(
+		[]models.CheckCertItem{{Name: "blog"}, {Name: "mail"}},
+		models.AlertState{Name: "mail", Status: models.AlertError, NotifiedAt: notifiedAt},
+		models.AlertState{Name: "blog", Status: models.AlertWarning, Threshold: 14, NotifiedAt: notifiedAt},
+	)
+	assert.Nil(t, err)
+
+	loaded, err := NewAlertStore(path)
+
+	assert.Nil(t, err)
+	assert.Equal(t, store.List(), loaded.List())
+	assert.Equal(t, "blog", loaded.List()[0].Name)
+	assert.Equal(t, 14, loaded.Get("blog").Threshold)
+}
+
+func TestAlertStoreSnooze(t *testing.T) {
+	store, _ := NewAlertStore(filepath.Join(t.TempDir(), "alerts.json"))
+	until := time.Now().Add(time.Hour)
+
+	state, err := store.Snooze("blog", until, "jane", "renewal scheduled")
+
+	assert.Nil(t, err)
+	assert.True(t, state.IsSnoozed(time.Now()))
+	assert.False(t, state.IsSnoozed(until.Add(time.Second)))
+
+	// the job does not overwrite a snooze set while it runs
+	store.Record([]models.CheckCertItem{{Name: "blog"}}, models.AlertState{Name: "blog", Status: models.AlertWarning})
+
+	assert.Equal(t, "jane", store.Get("blog").SnoozedBy)
+	assert.Equal(t, models.AlertWarning, store.Get("blog").Status)
+
+	assert.Nil(t, store.Unsnooze("blog"))
+	assert.Nil(t, store.Unsnooze("mail"))
+	assert.False(t, store.Get("blog").IsSnoozed(time.Now()))
+	assert.Equal(t, models.AlertWarning, store.Get("blog").Status)
+}
+
+func TestAlertStoreRecordDropsRemovedTargets(t *testing.T) {
+	store, _ := NewAlertStore(filepath.Join(t.TempDir(), "alerts.json"))
+	store.Record([]models.CheckCertItem{{Name: "blog"}, {Name: "mail"}},
+		models.AlertState{Name: "blog", Status: models.AlertWarning},
+		models.AlertState{Name: "mail", Status: models.AlertError})
+	store.Snooze("blog", time.Now().Add(time.Hour), "jane", "renewal scheduled")
+
+	// blog is snoozed so the job has no new state for it
+	err := store.Record([]models.CheckCertItem{{Name: "blog"}})
+
+	assert.Nil(t, err)
+	assert.Len(t, store.List(), 1)
+	assert.Equal(t, "jane", store.Get("blog").SnoozedBy)
+	assert.Equal(t, models.AlertWarning, store.Get("blog").Status)
+}
+
+func TestAlertStoreInvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "alerts.json")
+	os.WriteFile(path, []byte("not json"), 0644)
+
+	_, err := NewAlertStore(path)
+
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,24 @@
+package services
+
+import (
+	"os"
+
+	"github.com/jlucaspains/sharp-cert-manager/internal/models"
+)
+
+// LoadAuthConfig reads the accepted credentials from a YAML or JSON file. The
+// OIDC client secret may be set through OIDC_CLIENT_SECRET instead so it does
+// not need to be written to the file.
+func LoadAuthConfig(path string) (models.AuthConfig, error) {
+	config := models.AuthConfig{}
+
+	if err := readConfigFile(path, &config); err != nil {
+		return models.AuthConfig{}, err
+	}
+
+	if secret, ok := os.LookupEnv("OIDC_CLIENT_SECRET"); ok && config.OIDC != nil {
+		config.OIDC.ClientSecret = secret
+	}
+
+	return config, nil
+}
@@ -0,0 +1,51 @@
+package services
+
+import (
+	"os"
+	"testing"
+
+	"github.com/jlucaspains/sharp-cert-manager/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadAuthConfig(t *testing.T) {
+	path := writeConfigFile(t, "auth.yaml", `
+apiKeys:
+  - name: ci
+    keyHash: 2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b
+    role: admin
+users:
+  - username: jane
+    passwordHash: $2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy
+    role: viewer
+oidc:
+  issuer: https://login.example.com
+  clientId: app
+  clientSecret: from-file
+  redirectUrl: https://certs.example.com/auth/callback
+  adminRoles: [cert-admins]
+`)
+	os.Setenv("OIDC_CLIENT_SECRET", "from-env")
+	defer os.Unsetenv("OIDC_CLIENT_SECRET")
+
+	config, err := LoadAuthConfig(path)
+
+	assert.Nil(t, err)
+	assert.True(t, config.IsEnabled())
+	assert.Equal(t, models.RoleAdmin, config.APIKeys[0].Role)
+	assert.Equal(t, "jane", config.Users[0].Username)
+	assert.Equal(t, "from-env", config.OIDC.ClientSecret)
+	assert.Equal(t, []string{"cert-admins"}, config.OIDC.AdminRoles)
+}
+
+func TestLoadAuthConfigInvalid(t *testing.T) {
+	path := writeConfigFile(t, "auth.json", `{
+	"apiKeys": [{"name": "ci", "keyHash": "secret", "role": "owner"}],
+	"users": [{"username": "jane", "passwordHash": "secret", "role": "viewer"}]
+}`)
+
+	_, err := LoadAuthConfig(path)
+
+	assert.Equal(t, "invalid config file "+path+": apiKeys[0].keyHash should be a hex encoded sha256 hash; "+
+		"apiKeys[0].role should be one of: viewer admin; users[0].passwordHash should be a bcrypt hash", err.Error())
+}
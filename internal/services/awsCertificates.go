@@ -0,0 +1,427 @@
+package services
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/acm"
+	acmtypes "github.com/aws/aws-sdk-go-v2/service/acm/types"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/jlucaspains/sharp-cert-manager/internal/models"
+)
+
+// region used to sign IAM requests, IAM is a global service
+const iamRegion = "us-east-1"
+
+// awsCertificate is a certificate listed from ACM or IAM. FilterName is the
+// domain name of ACM certificates and the name of IAM server certificates.
+type awsCertificate struct {
+	Name       string
+	FilterName string
+	Arn        string
+}
+
+// awsClients shares the AWS configuration, loaded from the environment on
+// first use unless set, and one ACM client per region across all AWS checks
+type awsClients struct {
+	config *aws.Config
+	acm    map[string]*acm.Client
+	iam    *iam.Client
+	lock   sync.Mutex
+}
+
+var awsCertClients = &awsClients{}
+
+// SetAWSConfig sets the configuration of the ACM and IAM clients instead of
+// loading it from the environment e.g. to use a local endpoint.
+func SetAWSConfig(config aws.Config) {
+	awsCertClients.lock.Lock()
+	defer awsCertClients.lock.Unlock()
+
+	awsCertClients.config = &config
+	awsCertClients.acm = nil
+	awsCertClients.iam = nil
+}
+
+// getConfig returns the shared configuration, the lock must be held
+func (c *awsClients) getConfig(ctx context.Context) (aws.Config, error) {
+	if c.config != nil {
+		return *c.config, nil
+	}
+
+	loaded, err := config.LoadDefaultConfig(ctx)
+
+	if err != nil {
+		return aws.Config{}, err
+	}
+
+	c.config = &loaded
+
+	return loaded, nil
+}
+
+func (c *awsClients) getACM(ctx context.Context, region string) (*acm.Client, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if client, ok := c.acm[region]; ok {
+		return client, nil
+	}
+
+	cfg, err := c.getConfig(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	client := acm.NewFromConfig(cfg, func(options *acm.Options) { options.Region = region })
+
+	if c.acm == nil {
+		c.acm = map[string]*acm.Client{}
+	}
+
+	c.acm[region] = client
+
+	return client, nil
+}
+
+func (c *awsClients) getIAM(ctx context.Context) (*iam.Client, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.iam != nil {
+		return c.iam, nil
+	}
+
+	cfg, err := c.getConfig(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	c.iam = iam.NewFromConfig(cfg, func(options *iam.Options) { options.Region = iamRegion })
+
+	return c.iam, nil
+}
+
+// getAWSSource returns the service and region of an AWS source url in the
+// format acm://{region} or iam://global
+func getAWSSource(rawUrl string) (string, string, bool) {
+	parsedUrl, err := url.Parse(rawUrl)
+
+	if err != nil || parsedUrl.Host == "" || (parsedUrl.Path != "" && parsedUrl.Path != "/") {
+		return "", "", false
+	}
+
+	switch {
+	case parsedUrl.Scheme == "acm":
+		return "acm", parsedUrl.Host, true
+	case parsedUrl.Scheme == "iam" && parsedUrl.Host == "global":
+		return "iam", "", true
+	}
+
+	return "", "", false
+}
+
+func isAWSSourceUrl(rawUrl string) bool {
+	_, _, ok := getAWSSource(rawUrl)
+	return ok
+}
+
+// isAWSCertArn tells whether rawArn is the ARN of an ACM certificate or of an
+// IAM server certificate
+func isAWSCertArn(rawArn string) bool {
+	parsed, err := arn.Parse(rawArn)
+
+	if err != nil {
+		return false
+	}
+
+	return (parsed.Service == "acm" && parsed.Region != "" && strings.HasPrefix(parsed.Resource, "certificate/")) ||
+		(parsed.Service == "iam" && strings.HasPrefix(parsed.Resource, "server-certificate/"))
+}
+
+// ExpandAWSSource lists the ACM certificates of a region or the IAM server
+// certificates of a source target and returns one item for each of them. The
+// items are named after the source target and the certificate and inherit
+// its settings.
+func ExpandAWSSource(ctx context.Context, source models.CheckCertItem) ([]models.CheckCertItem, error) {
+	service, region, ok := getAWSSource(source.Url)
+
+	if !ok {
+		return nil, fmt.Errorf("invalid AWS source url: %s", source.Url)
+	}
+
+	var certificates []awsCertificate
+	var err error
+	if service == "acm" {
+		certificates, err = listACMCertificates(ctx, region)
+	} else {
+		certificates, err = listIAMServerCertificates(ctx)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := []models.CheckCertItem{}
+	for _, certificate := range certificates {
+		if !matchesNameFilters(certificate.FilterName, source.Include, source.Exclude) {
+			continue
+		}
+
+		result = append(result, models.CheckCertItem{
+			Name:        source.Name + "/" + certificate.Name,
+			Url:         certificate.Arn,
+			Type:        models.CertCheckAWS,
+			WarningDays: source.WarningDays,
+			Tags:        source.Tags,
+			Recipients:  source.Recipients,
+		})
+	}
+
+	slices.SortFunc(result, func(a, b models.CheckCertItem) int { return strings.Compare(a.Name, b.Name) })
+
+	return result, nil
+}
+
+func listACMCertificates(ctx context.Context, region string) ([]awsCertificate, error) {
+	client, err := awsCertClients.getACM(ctx, region)
+
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Listing certificates from AWS Certificate Manager: %s", region)
+
+	// without filters only RSA 2048 certificates are listed
+	input := &acm.ListCertificatesInput{
+		CertificateStatuses: []acmtypes.CertificateStatus{acmtypes.CertificateStatusIssued, acmtypes.CertificateStatusExpired, acmtypes.CertificateStatusRevoked},
+		Includes:            &acmtypes.Filters{KeyTypes: acmtypes.KeyAlgorithm("").Values()},
+	}
+
+	result := []awsCertificate{}
+	paginator := acm.NewListCertificatesPaginator(client, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, summary := range page.CertificateSummaryList {
+			certificateArn, err := arn.Parse(getValue(summary.CertificateArn))
+
+			if err != nil {
+				continue
+			}
+
+			domainName := getValue(summary.DomainName)
+			result = append(result, awsCertificate{
+				Name:       domainName + "/" + strings.TrimPrefix(certificateArn.Resource, "certificate/"),
+				FilterName: domainName,
+				Arn:        certificateArn.String(),
+			})
+		}
+	}
+
+	return result, nil
+}
+
+func listIAMServerCertificates(ctx context.Context) ([]awsCertificate, error) {
+	client, err := awsCertClients.getIAM(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Listing server certificates from AWS IAM")
+
+	result := []awsCertificate{}
+	paginator := iam.NewListServerCertificatesPaginator(client, &iam.ListServerCertificatesInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, metadata := range page.ServerCertificateMetadataList {
+			name := getValue(metadata.ServerCertificateName)
+			result = append(result, awsCertificate{Name: name, FilterName: name, Arn: getValue(metadata.Arn)})
+		}
+	}
+
+	return result, nil
+}
+
+func checkAWSCertStatus(ctx context.Context, name string, rawArn string, expirationWarningDays int) (*models.CertCheckResult, error) {
+	certificateArn, err := arn.Parse(rawArn)
+
+	if err != nil || !isAWSCertArn(rawArn) {
+		return nil, fmt.Errorf("invalid AWS certificate ARN: %s", rawArn)
+	}
+
+	if certificateArn.Service == "acm" {
+		return checkACMCertStatus(ctx, name, certificateArn, expirationWarningDays)
+	}
+
+	return checkIAMCertStatus(ctx, name, certificateArn, expirationWarningDays)
+}
+
+func checkACMCertStatus(ctx context.Context, name string, certificateArn arn.ARN, expirationWarningDays int) (*models.CertCheckResult, error) {
+	client, err := awsCertClients.getACM(ctx, certificateArn.Region)
+
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Getting certificate from AWS Certificate Manager: %s", certificateArn)
+
+	described, err := client.DescribeCertificate(ctx, &acm.DescribeCertificateInput{CertificateArn: aws.String(certificateArn.String())})
+
+	if err != nil {
+		return nil, err
+	}
+
+	detail := described.Certificate
+	if detail == nil {
+		return nil, fmt.Errorf("certificate %s not found", certificateArn)
+	}
+
+	info := &models.AWSInfo{
+		Service:            "acm",
+		Arn:                certificateArn.String(),
+		Region:             certificateArn.Region,
+		Status:             string(detail.Status),
+		Type:               string(detail.Type),
+		InUse:              len(detail.InUseBy) > 0,
+		InUseBy:            detail.InUseBy,
+		RenewalEligibility: string(detail.RenewalEligibility),
+		AutoRenew:          detail.RenewalEligibility == acmtypes.RenewalEligibilityEligible,
+		NotAfter:           getValue(detail.NotAfter),
+	}
+
+	if detail.RenewalSummary != nil {
+		info.RenewalStatus = string(detail.RenewalSummary.RenewalStatus)
+	}
+
+	// only issued certificates can be exported
+	if detail.Status != acmtypes.CertificateStatusIssued {
+		result := getEmptyResult(name)
+		result.CertEndDate = info.NotAfter
+		result.ValidationIssues = []string{fmt.Sprintf("Certificate status is %s", detail.Status)}
+		result.AWS = info
+
+		return result, nil
+	}
+
+	exported, err := client.GetCertificate(ctx, &acm.GetCertificateInput{CertificateArn: aws.String(certificateArn.String())})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return getAWSResult(name, getValue(exported.Certificate), getValue(exported.CertificateChain), info, "ACM", expirationWarningDays)
+}
+
+func checkIAMCertStatus(ctx context.Context, name string, certificateArn arn.ARN, expirationWarningDays int) (*models.CertCheckResult, error) {
+	client, err := awsCertClients.getIAM(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// the resource is server-certificate/{path}/{name}
+	segments := strings.Split(certificateArn.Resource, "/")
+	certName := segments[len(segments)-1]
+
+	log.Printf("Getting server certificate from AWS IAM: %s", certName)
+
+	response, err := client.GetServerCertificate(ctx, &iam.GetServerCertificateInput{ServerCertificateName: aws.String(certName)})
+
+	if err != nil {
+		return nil, err
+	}
+
+	serverCertificate := response.ServerCertificate
+	if serverCertificate == nil {
+		return nil, fmt.Errorf("server certificate %s not found", certName)
+	}
+
+	info := &models.AWSInfo{Service: "iam", Arn: certificateArn.String()}
+	if metadata := serverCertificate.ServerCertificateMetadata; metadata != nil {
+		info.NotAfter = getValue(metadata.Expiration)
+	}
+
+	return getAWSResult(name, getValue(serverCertificate.CertificateBody), getValue(serverCertificate.CertificateChain), info, "IAM", expirationWarningDays)
+}
+
+// getAWSResult checks the PEM encoded certificate and chain and adds the AWS
+// metadata to the result
+func getAWSResult(name string, body string, chain string, info *models.AWSInfo, service string, expirationWarningDays int) (*models.CertCheckResult, error) {
+	certs, err := parsePEMCertificates(body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(certs) == 0 {
+		return nil, errors.New("no certificate found in the AWS response")
+	}
+
+	intermediates, err := parsePEMCertificates(chain)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if info.InUseBy == nil {
+		info.InUseBy = []string{}
+	}
+
+	result := prepareResult(certs[0], intermediates, name, "", expirationWarningDays, true, true)
+	result.AWS = info
+	applyAutoRenew(result, info.AutoRenew, service)
+
+	return result, nil
+}
+
+// parsePEMCertificates returns the certificates of a PEM bundle
+func parsePEMCertificates(content string) ([]*x509.Certificate, error) {
+	result := []*x509.Certificate{}
+	rest := []byte(content)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+
+		if block == nil {
+			break
+		}
+
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, cert)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,225 @@
+package services
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/jlucaspains/sharp-cert-manager/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+const testACMArn = "arn:aws:acm:us-east-1:123456789012:certificate/1111"
+const testIAMArn = "arn:aws:iam::123456789012:server-certificate/web/legacy"
+
+// startAWSStub serves the ACM JSON and IAM query APIs from the given
+// responses, keyed by ACM target or IAM action, and points the AWS clients
+// to it
+func startAWSStub(t *testing.T, responses map[string]string) *[]string {
+	requests := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		operation := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "CertificateManager.")
+		contentType := "application/x-amz-json-1.1"
+
+		if operation == "" {
+			r.ParseForm()
+			operation = r.Form.Get("Action")
+			contentType = "text/xml"
+		}
+
+		requests = append(requests, operation)
+		response, ok := responses[operation]
+
+		if !ok {
+			w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"__type":"ResourceNotFoundException","message":"not found"}`))
+			return
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		w.Write([]byte(response))
+	}))
+	t.Cleanup(server.Close)
+
+	SetAWSConfig(aws.Config{
+		Region:           "us-east-1",
+		Credentials:      credentials.NewStaticCredentialsProvider("test", "test", ""),
+		BaseEndpoint:     aws.String(server.URL),
+		RetryMaxAttempts: 1,
+	})
+	t.Cleanup(func() { SetAWSConfig(aws.Config{}) })
+
+	return &requests
+}
+
+func getTestPEM(notAfter time.Time) string {
+	cert, _ := createTestCert(&x509.Certificate{Subject: pkix.Name{CommonName: "aws.example.com"}, NotAfter: notAfter}, nil, nil)
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+}
+
+func getACMResponses(status string, eligibility string, notAfter time.Time) map[string]string {
+	body, _ := json.Marshal(map[string]string{"Certificate": getTestPEM(notAfter)})
+
+	return map[string]string{
+		"DescribeCertificate": fmt.Sprintf(`{"Certificate":{"CertificateArn":"%s","Status":"%s","Type":"AMAZON_ISSUED","InUseBy":["arn:aws:elasticloadbalancing:us-east-1:123456789012:loadbalancer/app/web/1"],"RenewalEligibility":"%s","RenewalSummary":{"RenewalStatus":"PENDING_AUTO_RENEWAL"},"NotAfter":%d}}`,
+			testACMArn, status, eligibility, notAfter.Unix()),
+		"GetCertificate": string(body),
+	}
+}
+
+func TestExpandAWSSourceACM(t *testing.T) {
+	requests := startAWSStub(t, map[string]string{
+		"ListCertificates": `{"CertificateSummaryList":[
+			{"CertificateArn":"arn:aws:acm:us-east-1:123456789012:certificate/2222","DomainName":"www.example.com"},
+			{"CertificateArn":"arn:aws:acm:us-east-1:123456789012:certificate/1111","DomainName":"api.example.com"},
+			{"CertificateArn":"arn:aws:acm:us-east-1:123456789012:certificate/3333","DomainName":"old.example.com"}]}`,
+	})
+
+	items, err := ExpandAWSSource(context.Background(), models.CheckCertItem{
+		Name:        "acm",
+		Url:         "acm://us-east-1",
+		Type:        models.CertCheckAWSSource,
+		WarningDays: 20,
+		Tags:        []string{"aws"},
+		Exclude:     []string{"old.*"},
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"ListCertificates"}, *requests)
+	assert.Equal(t, []models.CheckCertItem{
+		{Name: "acm/api.example.com/1111", Url: "arn:aws:acm:us-east-1:123456789012:certificate/1111", Type: models.CertCheckAWS, WarningDays: 20, Tags: []string{"aws"}},
+		{Name: "acm/www.example.com/2222", Url: "arn:aws:acm:us-east-1:123456789012:certificate/2222", Type: models.CertCheckAWS, WarningDays: 20, Tags: []string{"aws"}},
+	}, items)
+}
+
+func TestExpandAWSSourceIAM(t *testing.T) {
+	startAWSStub(t, map[string]string{
+		"ListServerCertificates": `<ListServerCertificatesResponse xmlns="https://iam.amazonaws.com/doc/2010-05-08/">
+			<ListServerCertificatesResult><IsTruncated>false</IsTruncated><ServerCertificateMetadataList>
+			<member><ServerCertificateName>legacy</ServerCertificateName><Path>/web/</Path><Arn>` + testIAMArn + `</Arn><ServerCertificateId>ID</ServerCertificateId></member>
+			</ServerCertificateMetadataList></ListServerCertificatesResult></ListServerCertificatesResponse>`,
+	})
+
+	items, err := ExpandAWSSource(context.Background(), models.CheckCertItem{Name: "iam", Url: "iam://global", Type: models.CertCheckAWSSource})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []models.CheckCertItem{{Name: "iam/legacy", Url: testIAMArn, Type: models.CertCheckAWS}}, items)
+}
+
+func TestExpandAWSSourceError(t *testing.T) {
+	startAWSStub(t, map[string]string{})
+
+	_, err := ExpandAWSSource(context.Background(), models.CheckCertItem{Name: "acm", Url: "acm://us-east-1", Type: models.CertCheckAWSSource})
+
+	assert.ErrorContains(t, err, "not found")
+}
+
+func TestGetCheckStatusACMAutoRenew(t *testing.T) {
+	requests := startAWSStub(t, getACMResponses("ISSUED", "ELIGIBLE", time.Now().Add(time.Hour*24*10)))
+
+	result, err := CheckCertStatus(context.Background(), models.CheckCertItem{Name: "acm", Url: testACMArn, Type: models.CertCheckAWS}, 30)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"DescribeCertificate", "GetCertificate"}, *requests)
+	assert.True(t, result.IsValid)
+	assert.False(t, result.ExpirationWarning)
+	assert.Equal(t, "aws.example.com", result.CommonName)
+	assert.Equal(t, "acm", result.AWS.Service)
+	assert.Equal(t, "us-east-1", result.AWS.Region)
+	assert.Equal(t, "ISSUED", result.AWS.Status)
+	assert.Equal(t, "AMAZON_ISSUED", result.AWS.Type)
+	assert.True(t, result.AWS.InUse)
+	assert.Equal(t, "ELIGIBLE", result.AWS.RenewalEligibility)
+	assert.Equal(t, "PENDING_AUTO_RENEWAL", result.AWS.RenewalStatus)
+	assert.True(t, result.AWS.AutoRenew)
+	assert.False(t, result.AWS.NotAfter.IsZero())
+}
+
+func TestGetCheckStatusACMNoAutoRenew(t *testing.T) {
+	startAWSStub(t, getACMResponses("ISSUED", "INELIGIBLE", time.Now().Add(time.Hour*24*10)))
+
+	result, err := CheckCertStatus(context.Background(), models.CheckCertItem{Name: "acm", Url: testACMArn, Type: models.CertCheckAWS}, 30)
+
+	assert.Nil(t, err)
+	assert.True(t, result.ExpirationWarning)
+	assert.False(t, result.AWS.AutoRenew)
+	assert.Contains(t, result.ValidationIssues, "Certificate is expiring and is not renewed automatically by ACM")
+}
+
+func TestGetCheckStatusACMExpired(t *testing.T) {
+	requests := startAWSStub(t, getACMResponses("EXPIRED", "INELIGIBLE", time.Now().Add(-time.Hour*24)))
+
+	result, err := CheckCertStatus(context.Background(), models.CheckCertItem{Name: "acm", Url: testACMArn, Type: models.CertCheckAWS}, 30)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"DescribeCertificate"}, *requests)
+	assert.False(t, result.IsValid)
+	assert.Equal(t, []string{"Certificate status is EXPIRED"}, result.ValidationIssues)
+	assert.Equal(t, "EXPIRED", result.AWS.Status)
+}
+
+func TestGetCheckStatusIAM(t *testing.T) {
+	body := strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(getTestPEM(time.Now().Add(time.Hour * 24 * 10)))
+	startAWSStub(t, map[string]string{
+		"GetServerCertificate": `<GetServerCertificateResponse xmlns="https://iam.amazonaws.com/doc/2010-05-08/">
+			<GetServerCertificateResult><ServerCertificate>
+			<ServerCertificateMetadata><ServerCertificateName>legacy</ServerCertificateName><Path>/web/</Path><Arn>` + testIAMArn + `</Arn><ServerCertificateId>ID</ServerCertificateId><Expiration>2030-01-01T00:00:00Z</Expiration></ServerCertificateMetadata>
+			<CertificateBody>` + body + `</CertificateBody>
+			</ServerCertificate></GetServerCertificateResult></GetServerCertificateResponse>`,
+	})
+
+	result, err := CheckCertStatus(context.Background(), models.CheckCertItem{Name: "iam", Url: testIAMArn, Type: models.CertCheckAWS}, 30)
+
+	assert.Nil(t, err)
+	assert.True(t, result.ExpirationWarning)
+	assert.Equal(t, "iam", result.AWS.Service)
+	assert.Equal(t, time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC), result.AWS.NotAfter)
+	assert.Contains(t, result.ValidationIssues, "Certificate is expiring and is not renewed automatically by IAM")
+}
+
+func TestGetCheckStatusAWSInvalidArn(t *testing.T) {
+	_, err := CheckCertStatus(context.Background(), models.CheckCertItem{Name: "aws", Url: "arn:aws:s3:::bucket", Type: models.CertCheckAWS}, 30)
+
+	assert.Equal(t, "invalid AWS certificate ARN: arn:aws:s3:::bucket", err.Error())
+}
+
+func TestIsAWSSourceUrl(t *testing.T) {
+	assert.True(t, isAWSSourceUrl("acm://us-east-1"))
+	assert.True(t, isAWSSourceUrl("iam://global"))
+	assert.False(t, isAWSSourceUrl("iam://us-east-1"))
+	assert.False(t, isAWSSourceUrl("acm://us-east-1/certificate"))
+	assert.False(t, isAWSSourceUrl(testACMArn))
+}
+
+func TestGetConfigCertsAWS(t *testing.T) {
+	t.Setenv("AWSCERTIFICATES_1", "acm://eu-west-1")
+	t.Setenv("AWSCERTIFICATES_1_EXCLUDE", "old.*")
+	t.Setenv("AWSCERTIFICATES_2", "iam://global")
+	t.Setenv("AWSCERTIFICATES_3", testIAMArn)
+	t.Setenv("AWSCERTIFICATES_4", "iam://eu-west-1")
+
+	sites := []models.CheckCertItem{}
+	for _, site := range GetConfigCerts() {
+		if site.Type == models.CertCheckAWS || site.Type == models.CertCheckAWSSource {
+			sites = append(sites, site)
+		}
+	}
+
+	assert.Equal(t, []models.CheckCertItem{
+		{Name: "acm/eu-west-1", Url: "acm://eu-west-1", Type: models.CertCheckAWSSource, Include: []string{}, Exclude: []string{"old.*"}},
+		{Name: "iam", Url: "iam://global", Type: models.CertCheckAWSSource, Include: []string{}, Exclude: []string{}},
+		{Name: "iam/legacy", Url: testIAMArn, Type: models.CertCheckAWS},
+	}, sites)
+}
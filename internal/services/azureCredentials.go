@@ -0,0 +1,227 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/security/keyvault/azcertificates"
+	"github.com/jlucaspains/sharp-cert-manager/internal/models"
+)
+
+// AzureCredentialConfig selects how Key Vault is authenticated. The type is
+// one of default, managedidentity, workloadidentity, clientsecret or
+// clientcertificate.
+type AzureCredentialConfig struct {
+	Type                string
+	TenantID            string
+	ClientID            string
+	ClientSecret        string
+	CertificatePath     string
+	CertificatePassword string
+	TokenFilePath       string
+}
+
+// azureClients shares a single credential, and so its tokens, and one client
+// per vault across all Key Vault checks. It also keeps the last
+// authentication failure of the credential and of each vault for the health
+// check.
+type azureClients struct {
+	credential azcore.TokenCredential
+	clients    map[string]*azcertificates.Client
+	authErrors map[string]error
+	lock       sync.Mutex
+}
+
+var keyVaultClients = &azureClients{}
+
+// key of the credential failures in azureClients.authErrors
+const credentialAuthKey = ""
+
+// SetAzureCredential creates the credential used by the Key Vault checks.
+// Without it the default Azure credential chain is used.
+func SetAzureCredential(config AzureCredentialConfig) error {
+	credential, err := newAzureCredential(config)
+
+	if err != nil {
+		return err
+	}
+
+	keyVaultClients.lock.Lock()
+	defer keyVaultClients.lock.Unlock()
+
+	keyVaultClients.credential = credential
+	keyVaultClients.clients = nil
+	keyVaultClients.authErrors = nil
+
+	return nil
+}
+
+// GetAzureHealth reports whether Key Vault could be authenticated against
+// the last time it was used. It returns false until Key Vault is used.
+func GetAzureHealth() (models.HealthResultItem, bool) {
+	return keyVaultClients.health()
+}
+
+func newAzureCredential(config AzureCredentialConfig) (azcore.TokenCredential, error) {
+	switch config.Type {
+	case "", "default":
+		return azidentity.NewDefaultAzureCredential(&azidentity.DefaultAzureCredentialOptions{TenantID: config.TenantID})
+	case "managedidentity":
+		options := &azidentity.ManagedIdentityCredentialOptions{}
+		if config.ClientID != "" {
+			options.ID = azidentity.ClientID(config.ClientID)
+		}
+
+		return azidentity.NewManagedIdentityCredential(options)
+	case "workloadidentity":
+		return azidentity.NewWorkloadIdentityCredential(&azidentity.WorkloadIdentityCredentialOptions{
+			TenantID:      config.TenantID,
+			ClientID:      config.ClientID,
+			TokenFilePath: config.TokenFilePath,
+		})
+	case "clientsecret":
+		if config.TenantID == "" || config.ClientID == "" || config.ClientSecret == "" {
+			return nil, errors.New("the clientsecret Azure credential requires a tenant ID, client ID and client secret")
+		}
+
+		return azidentity.NewClientSecretCredential(config.TenantID, config.ClientID, config.ClientSecret, nil)
+	case "clientcertificate":
+		if config.TenantID == "" || config.ClientID == "" || config.CertificatePath == "" {
+			return nil, errors.New("the clientcertificate Azure credential requires a tenant ID, client ID and certificate path")
+		}
+
+		content, err := os.ReadFile(config.CertificatePath)
+
+		if err != nil {
+			return nil, err
+		}
+
+		certs, key, err := azidentity.ParseCertificates(content, []byte(config.CertificatePassword))
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid Azure client certificate %s: %w", config.CertificatePath, err)
+		}
+
+		return azidentity.NewClientCertificateCredential(config.TenantID, config.ClientID, certs, key, nil)
+	}
+
+	return nil, fmt.Errorf("invalid Azure credential type %s", config.Type)
+}
+
+// get returns the client of the vault, creating the default credential on
+// first use when none was set
+func (c *azureClients) get(keyVaultUrl string) (*azcertificates.Client, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.authErrors == nil {
+		c.authErrors = map[string]error{}
+	}
+
+	if c.credential == nil {
+		credential, err := newAzureCredential(AzureCredentialConfig{})
+
+		if err != nil {
+			c.authErrors[credentialAuthKey] = err
+			return nil, err
+		}
+
+		c.credential = credential
+	}
+
+	if client, ok := c.clients[keyVaultUrl]; ok {
+		return client, nil
+	}
+
+	client, err := azcertificates.NewClient(keyVaultUrl, recordingCredential{c.credential, c}, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if c.clients == nil {
+		c.clients = map[string]*azcertificates.Client{}
+	}
+
+	c.clients[keyVaultUrl] = client
+
+	return client, nil
+}
+
+// record keeps err as the authentication failure of key or clears it on
+// success. Only errors denying access are recorded for vaults, other
+// failures say nothing about the credential.
+func (c *azureClients) record(key string, err error) {
+	var responseErr *azcore.ResponseError
+	if key != credentialAuthKey && err != nil && (!errors.As(err, &responseErr) ||
+		(responseErr.StatusCode != http.StatusUnauthorized && responseErr.StatusCode != http.StatusForbidden)) {
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.authErrors == nil {
+		c.authErrors = map[string]error{}
+	}
+
+	if err == nil {
+		delete(c.authErrors, key)
+		return
+	}
+
+	c.authErrors[key] = err
+}
+
+func (c *azureClients) health() (models.HealthResultItem, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.authErrors == nil {
+		return models.HealthResultItem{}, false
+	}
+
+	// the endpoint is public so the SDK errors, which are logged by the
+	// checks, are summarized
+	messages := []string{}
+	if _, ok := c.authErrors[credentialAuthKey]; ok {
+		messages = append(messages, "token could not be acquired")
+	}
+
+	if denied := len(c.authErrors) - len(messages); denied == 1 {
+		messages = append(messages, "access denied to 1 vault")
+	} else if denied > 1 {
+		messages = append(messages, fmt.Sprintf("access denied to %d vaults", denied))
+	}
+
+	return models.HealthResultItem{
+		Name:    "Azure Key Vault",
+		Healthy: len(messages) == 0,
+		Error:   strings.Join(messages, "; "),
+	}, true
+}
+
+// recordingCredential records the token failures of the shared credential
+type recordingCredential struct {
+	azcore.TokenCredential
+	clients *azureClients
+}
+
+func (c recordingCredential) GetToken(ctx context.Context, options policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	token, err := c.TokenCredential.GetToken(ctx, options)
+
+	// a canceled check is not an authentication failure
+	if ctx.Err() == nil {
+		c.clients.record(credentialAuthKey, err)
+	}
+
+	return token, err
+}
@@ -0,0 +1,138 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeCredential struct {
+	err error
+}
+
+func (c fakeCredential) GetToken(ctx context.Context, options policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	return azcore.AccessToken{Token: "token"}, c.err
+}
+
+func TestNewAzureCredential(t *testing.T) {
+	tenant := "00000000-0000-0000-0000-000000000000"
+	client := "11111111-1111-1111-1111-111111111111"
+
+	credential, err := newAzureCredential(AzureCredentialConfig{Type: "clientsecret", TenantID: tenant, ClientID: client, ClientSecret: "secret"})
+
+	assert.Nil(t, err)
+	assert.NotNil(t, credential)
+
+	credential, err = newAzureCredential(AzureCredentialConfig{Type: "managedidentity", ClientID: client})
+
+	assert.Nil(t, err)
+	assert.NotNil(t, credential)
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	os.WriteFile(tokenFile, []byte("token"), 0600)
+
+	credential, err = newAzureCredential(AzureCredentialConfig{Type: "workloadidentity", TenantID: tenant, ClientID: client, TokenFilePath: tokenFile})
+
+	assert.Nil(t, err)
+	assert.NotNil(t, credential)
+
+	_, err = newAzureCredential(AzureCredentialConfig{Type: "password"})
+
+	assert.Equal(t, "invalid Azure credential type password", err.Error())
+
+	_, err = newAzureCredential(AzureCredentialConfig{Type: "clientsecret", TenantID: tenant})
+
+	assert.Equal(t, "the clientsecret Azure credential requires a tenant ID, client ID and client secret", err.Error())
+}
+
+func TestNewAzureCredentialCertificate(t *testing.T) {
+	tenant := "00000000-0000-0000-0000-000000000000"
+	client := "11111111-1111-1111-1111-111111111111"
+	// Entra ID only accepts RSA client certificates
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "client"}, NotAfter: time.Now().Add(time.Hour)}
+	cert, _ := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	keyBytes, _ := x509.MarshalPKCS8PrivateKey(key)
+	path := filepath.Join(t.TempDir(), "client.pem")
+	content := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert})
+	content = append(content, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyBytes})...)
+	os.WriteFile(path, content, 0600)
+
+	credential, err := newAzureCredential(AzureCredentialConfig{Type: "clientcertificate", TenantID: tenant, ClientID: client, CertificatePath: path})
+
+	assert.Nil(t, err)
+	assert.NotNil(t, credential)
+
+	_, err = newAzureCredential(AzureCredentialConfig{Type: "clientcertificate", TenantID: tenant, ClientID: client, CertificatePath: filepath.Join(t.TempDir(), "missing.pem")})
+
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+}
+
+func TestAzureClientsReuse(t *testing.T) {
+	clients := &azureClients{credential: fakeCredential{}}
+
+	first, err := clients.get("https://a.vault.azure.net")
+	assert.Nil(t, err)
+
+	second, _ := clients.get("https://a.vault.azure.net")
+	other, _ := clients.get("https://b.vault.azure.net")
+
+	assert.Same(t, first, second)
+	assert.NotSame(t, first, other)
+}
+
+func TestAzureClientsHealth(t *testing.T) {
+	clients := &azureClients{}
+
+	_, ok := clients.health()
+
+	assert.False(t, ok)
+
+	credential := recordingCredential{fakeCredential{err: errors.New("invalid client secret")}, clients}
+	credential.GetToken(context.Background(), policy.TokenRequestOptions{})
+	clients.record("https://a.vault.azure.net", &azcore.ResponseError{StatusCode: http.StatusForbidden, ErrorCode: "Forbidden"})
+	clients.record("https://b.vault.azure.net", &azcore.ResponseError{StatusCode: http.StatusNotFound, ErrorCode: "CertificateNotFound"})
+
+	health, ok := clients.health()
+
+	assert.True(t, ok)
+	assert.False(t, health.Healthy)
+	assert.Equal(t, "Azure Key Vault", health.Name)
+	assert.Equal(t, "token could not be acquired; access denied to 1 vault", health.Error)
+
+	// successful calls clear the failures
+	credential.TokenCredential = fakeCredential{}
+	credential.GetToken(context.Background(), policy.TokenRequestOptions{})
+	clients.record("https://a.vault.azure.net", nil)
+
+	health, _ = clients.health()
+
+	assert.True(t, health.Healthy)
+	assert.Empty(t, health.Error)
+}
+
+func TestAzureClientsIgnoresCanceledToken(t *testing.T) {
+	clients := &azureClients{}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	recordingCredential{fakeCredential{err: context.Canceled}, clients}.GetToken(ctx, policy.TokenRequestOptions{})
+
+	_, ok := clients.health()
+
+	assert.False(t, ok)
+}
@@ -0,0 +1,228 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/security/keyvault/azcertificates"
+	"github.com/jlucaspains/sharp-cert-manager/internal/models"
+)
+
+// vaultCertificate is an enabled version of a certificate in a vault
+type vaultCertificate struct {
+	Name    string
+	Version string
+}
+
+// listVaultCertificates is replaced in tests to avoid calling Azure
+var listVaultCertificates = listKeyVaultCertificates
+
+// isAzureVaultUrl tells whether rawUrl points to a whole Key Vault e.g.
+// https://{vault}.vault.azure.net/ instead of a single certificate
+func isAzureVaultUrl(rawUrl string) bool {
+	parsedUrl, err := url.Parse(rawUrl)
+
+	if err != nil || parsedUrl.Host == "" {
+		return false
+	}
+
+	return parsedUrl.Path == "" || parsedUrl.Path == "/"
+}
+
+// validateNameFilters checks the include or exclude glob patterns of field
+func validateNameFilters(field string, patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("%s has an invalid name pattern %s", field, pattern)
+		}
+	}
+
+	return nil
+}
+
+// matchesNameFilters tells whether a certificate name matches any include
+// pattern, or there are none, and no exclude pattern
+func matchesNameFilters(name string, include []string, exclude []string) bool {
+	matches := func(pattern string) bool {
+		ok, _ := path.Match(pattern, name)
+		return ok
+	}
+
+	if len(include) > 0 && !slices.ContainsFunc(include, matches) {
+		return false
+	}
+
+	return !slices.ContainsFunc(exclude, matches)
+}
+
+// ExpandAzureVault lists the enabled certificate versions of a vault target
+// and returns one item for each of them. The items are named after the
+// vault target, the certificate and the version and inherit its settings.
+func ExpandAzureVault(ctx context.Context, vault models.CheckCertItem) ([]models.CheckCertItem, error) {
+	parsedUrl, err := url.Parse(vault.Url)
+
+	if err != nil {
+		return nil, err
+	}
+
+	keyVaultUrl := parsedUrl.Scheme + "://" + parsedUrl.Host
+	certificates, err := listVaultCertificates(ctx, keyVaultUrl)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := []models.CheckCertItem{}
+	for _, certificate := range certificates {
+		if !matchesNameFilters(certificate.Name, vault.Include, vault.Exclude) {
+			continue
+		}
+
+		result = append(result, models.CheckCertItem{
+			Name:        vault.Name + "/" + certificate.Name + "/" + certificate.Version,
+			Url:         keyVaultUrl + "/certificates/" + certificate.Name + "/" + certificate.Version,
+			Type:        models.CertCheckAzure,
+			WarningDays: vault.WarningDays,
+			Tags:        vault.Tags,
+			Recipients:  vault.Recipients,
+		})
+	}
+
+	slices.SortFunc(result, func(a, b models.CheckCertItem) int { return strings.Compare(a.Name, b.Name) })
+
+	return result, nil
+}
+
+func listKeyVaultCertificates(ctx context.Context, keyVaultUrl string) ([]vaultCertificate, error) {
+	client, err := keyVaultClients.get(keyVaultUrl)
+
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Listing certificates from Azure Key Vault: %s", keyVaultUrl)
+
+	result := []vaultCertificate{}
+	pager := client.NewListCertificatePropertiesPager(nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		keyVaultClients.record(keyVaultUrl, err)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, certificate := range page.Value {
+			if certificate.ID == nil {
+				continue
+			}
+
+			versions, err := listKeyVaultCertificateVersions(ctx, client, certificate.ID.Name())
+
+			if err != nil {
+				return nil, err
+			}
+
+			result = append(result, versions...)
+		}
+	}
+
+	return result, nil
+}
+
+func listKeyVaultCertificateVersions(ctx context.Context, client *azcertificates.Client, name string) ([]vaultCertificate, error) {
+	result := []vaultCertificate{}
+	pager := client.NewListCertificatePropertiesVersionsPager(name, nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, version := range page.Value {
+			if version.ID == nil || !isEnabled(version.Attributes) {
+				continue
+			}
+
+			result = append(result, vaultCertificate{Name: name, Version: version.ID.Version()})
+		}
+	}
+
+	return result, nil
+}
+
+func isEnabled(attributes *azcertificates.CertificateAttributes) bool {
+	return attributes == nil || attributes.Enabled == nil || *attributes.Enabled
+}
+
+// applyKeyVaultInfo adds the Key Vault metadata to the result. An expiring
+// certificate that Key Vault renews automatically is not reported as
+// expiring, otherwise the missing renewal is flagged.
+func applyKeyVaultInfo(result *models.CertCheckResult, certificate azcertificates.Certificate) {
+	result.KeyVault = getKeyVaultInfo(certificate)
+	applyAutoRenew(result, result.KeyVault.AutoRenew, "Key Vault")
+}
+
+func getKeyVaultInfo(certificate azcertificates.Certificate) *models.KeyVaultInfo {
+	result := &models.KeyVaultInfo{
+		Enabled:         isEnabled(certificate.Attributes),
+		LifetimeActions: []models.LifetimeAction{},
+		Tags:            map[string]string{},
+	}
+
+	if attributes := certificate.Attributes; attributes != nil && attributes.Expires != nil {
+		result.Expired = attributes.Expires.Before(time.Now())
+	}
+
+	for name, value := range certificate.Tags {
+		result.Tags[name] = getValue(value)
+	}
+
+	policy := certificate.Policy
+	if policy == nil {
+		return result
+	}
+
+	if policy.IssuerParameters != nil {
+		result.IssuerName = getValue(policy.IssuerParameters.Name)
+		result.CertificateType = getValue(policy.IssuerParameters.CertificateType)
+	}
+
+	if policy.X509CertificateProperties != nil {
+		result.ValidityInMonths = int(getValue(policy.X509CertificateProperties.ValidityInMonths))
+	}
+
+	for _, action := range policy.LifetimeActions {
+		if action == nil || action.Action == nil || action.Action.ActionType == nil {
+			continue
+		}
+
+		lifetimeAction := models.LifetimeAction{Action: string(*action.Action.ActionType)}
+		if action.Trigger != nil {
+			lifetimeAction.DaysBeforeExpiry = int(getValue(action.Trigger.DaysBeforeExpiry))
+			lifetimeAction.LifetimePercentage = int(getValue(action.Trigger.LifetimePercentage))
+		}
+
+		result.AutoRenew = result.AutoRenew || *action.Action.ActionType == azcertificates.CertificatePolicyActionAutoRenew
+		result.LifetimeActions = append(result.LifetimeActions, lifetimeAction)
+	}
+
+	return result
+}
+
+// getValue dereferences an optional value from the Azure SDK
+func getValue[T any](value *T) T {
+	var result T
+	if value != nil {
+		result = *value
+	}
+
+	return result
+}
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/security/keyvault/azcertificates"
+	"github.com/jlucaspains/sharp-cert-manager/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func mockVaultCertificates(t *testing.T, certificates []vaultCertificate, err error) *[]string {
+	listed := []string{}
+	listVaultCertificates = func(ctx context.Context, keyVaultUrl string) ([]vaultCertificate, error) {
+		listed = append(listed, keyVaultUrl)
+		return certificates, err
+	}
+	t.Cleanup(func() { listVaultCertificates = listKeyVaultCertificates })
+
+	return &listed
+}
+
+func TestExpandAzureVault(t *testing.T) {
+	listed := mockVaultCertificates(t, []vaultCertificate{
+		{Name: "web-api", Version: "v2"},
+		{Name: "web-api", Version: "v1"},
+		{Name: "web-old", Version: "v1"},
+		{Name: "internal", Version: "v1"},
+	}, nil)
+
+	items, err := ExpandAzureVault(context.Background(), models.CheckCertItem{
+		Name:        "vault",
+		Url:         "https://testfake.vault.azure.net/",
+		Type:        models.CertCheckAzureVault,
+		WarningDays: 20,
+		Tags:        []string{"azure"},
+		Include:     []string{"web-*"},
+		Exclude:     []string{"*-old"},
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"https://testfake.vault.azure.net"}, *listed)
+	assert.Equal(t, []models.CheckCertItem{
+		{Name: "vault/web-api/v1", Url: "https://testfake.vault.azure.net/certificates/web-api/v1", Type: models.CertCheckAzure, WarningDays: 20, Tags: []string{"azure"}},
+		{Name: "vault/web-api/v2", Url: "https://testfake.vault.azure.net/certificates/web-api/v2", Type: models.CertCheckAzure, WarningDays: 20, Tags: []string{"azure"}},
+	}, items)
+}
+
+func TestMatchesNameFilters(t *testing.T) {
+	assert.True(t, matchesNameFilters("web", nil, nil))
+	assert.True(t, matchesNameFilters("web", []string{"api", "w*"}, nil))
+	assert.False(t, matchesNameFilters("web", []string{"api"}, nil))
+	assert.False(t, matchesNameFilters("web", nil, []string{"web"}))
+	assert.False(t, matchesNameFilters("web", []string{"w*"}, []string{"*b"}))
+}
+
+func TestIsAzureVaultUrl(t *testing.T) {
+	assert.True(t, isAzureVaultUrl("https://testfake.vault.azure.net"))
+	assert.True(t, isAzureVaultUrl("https://testfake.vault.azure.net/"))
+	assert.False(t, isAzureVaultUrl("https://testfake.vault.azure.net/certificates/test-fake"))
+	assert.False(t, isAzureVaultUrl("testfake.vault.azure.net"))
+}
+
+func TestGetAzureCertVersion(t *testing.T) {
+	assert.Equal(t, "v1", getAzureCertVersion("https://testfake.vault.azure.net/certificates/test-fake/v1"))
+	assert.Equal(t, "", getAzureCertVersion("https://testfake.vault.azure.net/certificates/test-fake"))
+	assert.Equal(t, "", getAzureCertVersion("https://testfake.vault.azure.net/keys/test-fake/v1"))
+}
+
+func TestCertRegistryRefreshVaults(t *testing.T) {
+	mockVaultCertificates(t, []vaultCertificate{{Name: "web", Version: "v1"}}, nil)
+	registry := NewCertRegistry([]models.CheckCertItem{
+		{Name: "blog", Url: "https://blog.lpains.net"},
+		{Name: "vault", Url: "https://testfake.vault.azure.net/", Type: models.CertCheckAzureVault},
+	})
+
+	assert.Len(t, registry.List(), 1)
+
+	err := registry.Refresh(context.Background())
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"blog", "vault/web/v1"}, getNames(registry.List()))
+	assert.Len(t, registry.SourceItems("vault"), 1)
+	assert.True(t, registry.contains("vault"))
+
+	// a vault that cannot be listed keeps the last certificates
+	mockVaultCertificates(t, nil, errors.New("forbidden"))
+
+	err = registry.Refresh(context.Background())
+
+	assert.Equal(t, "source vault: forbidden", err.Error())
+	assert.Equal(t, []string{"blog", "vault/web/v1"}, getNames(registry.List()))
+}
+
+func TestGetConfigCertsAzureVault(t *testing.T) {
+	os.Setenv("AZUREKEYVAULT_1", "https://testfake.vault.azure.net/")
+	os.Setenv("AZUREKEYVAULT_1_INCLUDE", "web-*, api")
+	defer os.Unsetenv("AZUREKEYVAULT_1")
+	defer os.Unsetenv("AZUREKEYVAULT_1_INCLUDE")
+
+	sites := GetConfigCerts()
+
+	assert.Contains(t, sites, models.CheckCertItem{
+		Name:    "testfake.vault.azure.net",
+		Url:     "https://testfake.vault.azure.net/",
+		Type:    models.CertCheckAzureVault,
+		Include: []string{"web-*", "api"},
+		Exclude: []string{},
+	})
+}
+
+func mockKeyVaultCertificate(t *testing.T, policy *azcertificates.CertificatePolicy) {
+	mockAzureResult = &azcertificates.Certificate{
+		CER:        createCertificate(),
+		Attributes: &azcertificates.CertificateAttributes{Enabled: to.Ptr(true), Expires: to.Ptr(time.Now().Add(-time.Hour))},
+		Tags:       map[string]*string{"team": to.Ptr("web")},
+		Policy:     policy,
+	}
+	t.Cleanup(func() { mockAzureResult = nil })
+}
+
+func TestGetCheckStatusAzureAutoRenew(t *testing.T) {
+	mockKeyVaultCertificate(t, &azcertificates.CertificatePolicy{
+		IssuerParameters:          &azcertificates.IssuerParameters{Name: to.Ptr("DigiCert"), CertificateType: to.Ptr("OV-SSL")},
+		X509CertificateProperties: &azcertificates.X509CertificateProperties{ValidityInMonths: to.Ptr[int32](12)},
+		LifetimeActions: []*azcertificates.LifetimeAction{
+			{
+				Action:  &azcertificates.LifetimeActionType{ActionType: to.Ptr(azcertificates.CertificatePolicyActionEmailContacts)},
+				Trigger: &azcertificates.LifetimeActionTrigger{DaysBeforeExpiry: to.Ptr[int32](30)},
+			},
+			{
+				Action:  &azcertificates.LifetimeActionType{ActionType: to.Ptr(azcertificates.CertificatePolicyActionAutoRenew)},
+				Trigger: &azcertificates.LifetimeActionTrigger{LifetimePercentage: to.Ptr[int32](80)},
+			},
+		},
+	})
+
+	body, err := CheckCertStatus(context.Background(), models.CheckCertItem{
+		Name: "vault/web", Url: "https://testfake.vault.azure.net/certificates/web", Type: models.CertCheckAzure,
+	}, 10000)
+
+	assert.Nil(t, err)
+	assert.True(t, body.IsValid)
+	assert.False(t, body.ExpirationWarning)
+	assert.Empty(t, body.ValidationIssues)
+	assert.Equal(t, &models.KeyVaultInfo{
+		Enabled:          true,
+		Expired:          true,
+		IssuerName:       "DigiCert",
+		CertificateType:  "OV-SSL",
+		ValidityInMonths: 12,
+		AutoRenew:        true,
+		LifetimeActions: []models.LifetimeAction{
+			{Action: "EmailContacts", DaysBeforeExpiry: 30},
+			{Action: "AutoRenew", LifetimePercentage: 80},
+		},
+		Tags: map[string]string{"team": "web"},
+	}, body.KeyVault)
+}
+
+func TestGetCheckStatusAzureNoAutoRenew(t *testing.T) {
+	mockKeyVaultCertificate(t, nil)
+
+	body, err := CheckCertStatus(context.Background(), models.CheckCertItem{
+		Name: "vault/web", Url: "https://testfake.vault.azure.net/certificates/web", Type: models.CertCheckAzure,
+	}, 10000)
+
+	assert.Nil(t, err)
+	assert.True(t, body.ExpirationWarning)
+	assert.False(t, body.KeyVault.AutoRenew)
+	assert.Equal(t, []string{"Certificate is expiring and is not renewed automatically by Key Vault"}, body.ValidationIssues)
+
+	// certificates that are not expiring are not flagged
+	body, err = CheckCertStatus(context.Background(), models.CheckCertItem{
+		Name: "vault/web", Url: "https://testfake.vault.azure.net/certificates/web", Type: models.CertCheckAzure,
+	}, 30)
+
+	assert.Nil(t, err)
+	assert.False(t, body.ExpirationWarning)
+	assert.Empty(t, body.ValidationIssues)
+}
+
+func getNames(items []models.CheckCertItem) []string {
+	result := []string{}
+	for _, item := range items {
+		result = append(result, item.Name)
+	}
+
+	return result
+}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jlucaspains/sharp-cert-manager/internal/models"
+)
+
+type CertMetric struct {
+	Item      models.CheckCertItem
+	Result    models.CertCheckResult
+	Success   bool
+	Duration  time.Duration
+	CheckedAt time.Time
+}
+
+// CertMetrics keeps the outcome of the last check of each target so it can
+// be exposed to monitoring systems without probing the targets again.
+type CertMetrics struct {
+	metrics map[string]CertMetric
+	lock    sync.RWMutex
+}
+
+func NewCertMetrics() *CertMetrics {
+	return &CertMetrics{metrics: map[string]CertMetric{}}
+}
+
+func (m *CertMetrics) Record(item models.CheckCertItem, result *models.CertCheckResult, err error, duration time.Duration) {
+	metric := CertMetric{Item: item, Success: err == nil && result != nil, Duration: duration, CheckedAt: time.Now().UTC()}
+
+	if result != nil {
+		metric.Result = *result
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.metrics[item.Name] = metric
+}
+
+// Retain drops the metrics of targets that are no longer monitored
+func (m *CertMetrics) Retain(certList []models.CheckCertItem) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for name := range m.metrics {
+		if !slices.ContainsFunc(certList, func(c models.CheckCertItem) bool { return c.Name == name }) {
+			delete(m.metrics, name)
+		}
+	}
+}
+
+// List returns the metrics sorted by target name
+func (m *CertMetrics) List() []CertMetric {
+	if m == nil {
+		return []CertMetric{}
+	}
+
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	result := []CertMetric{}
+	for _, metric := range m.metrics {
+		result = append(result, metric)
+	}
+
+	slices.SortFunc(result, func(a, b CertMetric) int { return strings.Compare(a.Item.Name, b.Item.Name) })
+
+	return result
+}
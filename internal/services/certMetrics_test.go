@@ -0,0 +1,45 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jlucaspains/sharp-cert-manager/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCertMetricsRecord(t *testing.T) {
+	metrics := NewCertMetrics()
+
+	metrics.Record(models.CheckCertItem{Name: "mail"}, nil, errors.New("timeout"), time.Second)
+	metrics.Record(models.CheckCertItem{Name: "blog"}, &models.CertCheckResult{Issuer: "Test CA", IsValid: true}, nil, time.Second)
+
+	result := metrics.List()
+
+	assert.Len(t, result, 2)
+	assert.Equal(t, "blog", result[0].Item.Name)
+	assert.True(t, result[0].Success)
+	assert.Equal(t, "Test CA", result[0].Result.Issuer)
+	assert.Equal(t, "mail", result[1].Item.Name)
+	assert.False(t, result[1].Success)
+}
+
+func TestCertMetricsRetain(t *testing.T) {
+	metrics := NewCertMetrics()
+	metrics.Record(models.CheckCertItem{Name: "blog"}, &models.CertCheckResult{}, nil, time.Second)
+	metrics.Record(models.CheckCertItem{Name: "mail"}, &models.CertCheckResult{}, nil, time.Second)
+
+	metrics.Retain([]models.CheckCertItem{{Name: "mail"}})
+
+	result := metrics.List()
+
+	assert.Len(t, result, 1)
+	assert.Equal(t, "mail", result[0].Item.Name)
+}
+
+func TestCertMetricsNil(t *testing.T) {
+	var metrics *CertMetrics
+
+	assert.Empty(t, metrics.List())
+}
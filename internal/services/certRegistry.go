@@ -0,0 +1,277 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/jlucaspains/sharp-cert-manager/internal/models"
+)
+
+var (
+	ErrTargetExists   = errors.New("a target with the same name already exists")
+	ErrTargetNotFound = errors.New("the provided cert name is not configured")
+	ErrTargetReadOnly = errors.New("the target is defined in the configuration and cannot be changed")
+	ErrNoTargetStore  = errors.New("target management is not enabled")
+)
+
+// CertRegistry holds the monitored targets. The list is replaced atomically
+// so readers always work on a consistent snapshot while it is reloaded.
+// Targets from the configuration are merged with the ones managed at runtime
+// through the target store. Certificate sources, such as Azure Key Vaults,
+// are replaced by the certificates found in them the last time they were
+// refreshed.
+type CertRegistry struct {
+	certs      atomic.Pointer[[]models.CheckCertItem]
+	configured []models.CheckCertItem
+	store      *TargetStore
+	sources    map[string][]models.CheckCertItem
+	lock       sync.Mutex
+}
+
+func NewCertRegistry(certs []models.CheckCertItem) *CertRegistry {
+	registry := &CertRegistry{}
+	registry.Replace(certs)
+
+	return registry
+}
+
+// List returns the current snapshot. It must not be modified by callers.
+func (r *CertRegistry) List() []models.CheckCertItem {
+	if r == nil || r.certs.Load() == nil {
+		return []models.CheckCertItem{}
+	}
+
+	return *r.certs.Load()
+}
+
+func (r *CertRegistry) Find(name string) (models.CheckCertItem, bool) {
+	certs := r.List()
+	idx := slices.IndexFunc(certs, func(c models.CheckCertItem) bool { return c.Name == name })
+
+	if idx < 0 {
+		return models.CheckCertItem{}, false
+	}
+
+	return certs[idx], true
+}
+
+// Replace sets the targets from the configuration
+func (r *CertRegistry) Replace(certs []models.CheckCertItem) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.configured = certs
+	r.publish()
+}
+
+// Refresh lists the certificates of every source target. A source that
+// cannot be listed keeps the certificates found the last time.
+func (r *CertRegistry) Refresh(ctx context.Context) error {
+	if r == nil {
+		return nil
+	}
+
+	r.lock.Lock()
+	targets := r.targets()
+	previous := r.sources
+	r.lock.Unlock()
+
+	sources := map[string][]models.CheckCertItem{}
+	errs := []error{}
+	for _, target := range targets {
+		if !IsCertSource(target) {
+			continue
+		}
+
+		items, err := expandCertSource(ctx, target)
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("source %s: %w", target.Name, err))
+			items = previous[target.Name]
+		}
+
+		sources[target.Name] = items
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.sources = sources
+	r.publish()
+
+	return errors.Join(errs...)
+}
+
+// SourceItems returns the certificates found in the source target name
+func (r *CertRegistry) SourceItems(name string) []models.CheckCertItem {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return slices.Clone(r.sources[name])
+}
+
+// SetTargetStore enables Add, Update and Delete and merges the stored targets
+func (r *CertRegistry) SetTargetStore(store *TargetStore) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.store = store
+	r.publish()
+}
+
+// CanManage tells whether targets can be added at runtime
+func (r *CertRegistry) CanManage() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.store != nil
+}
+
+// IsManaged tells whether name was added at runtime and can be changed
+func (r *CertRegistry) IsManaged(name string) bool {
+	return r.store.Contains(name)
+}
+
+func (r *CertRegistry) Add(item models.CheckCertItem) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.store == nil {
+		return ErrNoTargetStore
+	}
+
+	if r.contains(item.Name) {
+		return ErrTargetExists
+	}
+
+	return r.save(append(r.store.List(), item))
+}
+
+func (r *CertRegistry) Update(name string, item models.CheckCertItem) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	targets, idx, err := r.findManaged(name)
+
+	if err != nil {
+		return err
+	}
+
+	if item.Name != name && r.contains(item.Name) {
+		return ErrTargetExists
+	}
+
+	targets[idx] = item
+
+	return r.save(targets)
+}
+
+func (r *CertRegistry) Delete(name string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	targets, idx, err := r.findManaged(name)
+
+	if err != nil {
+		return err
+	}
+
+	return r.save(slices.Delete(targets, idx, idx+1))
+}
+
+func (r *CertRegistry) findManaged(name string) ([]models.CheckCertItem, int, error) {
+	if r.store == nil {
+		return nil, -1, ErrNoTargetStore
+	}
+
+	targets := r.store.List()
+	idx := slices.IndexFunc(targets, func(c models.CheckCertItem) bool { return c.Name == name })
+
+	if idx >= 0 {
+		return targets, idx, nil
+	}
+
+	if r.contains(name) {
+		return nil, -1, ErrTargetReadOnly
+	}
+
+	return nil, -1, ErrTargetNotFound
+}
+
+// IsCertSource tells whether the target lists many certificates that are
+// monitored as targets of their own
+func IsCertSource(item models.CheckCertItem) bool {
+	return item.Type == models.CertCheckAzureVault || item.Type == models.CertCheckAWSSource || item.Type == models.CertCheckVaultPKI
+}
+
+// expandCertSource lists the certificates of a source target
+func expandCertSource(ctx context.Context, source models.CheckCertItem) ([]models.CheckCertItem, error) {
+	switch source.Type {
+	case models.CertCheckAWSSource:
+		return ExpandAWSSource(ctx, source)
+	case models.CertCheckVaultPKI:
+		return ExpandVaultPKI(ctx, source)
+	}
+
+	return ExpandAzureVault(ctx, source)
+}
+
+// contains also checks the source targets, which are not part of the snapshot
+func (r *CertRegistry) contains(name string) bool {
+	_, ok := r.Find(name)
+	return ok || slices.ContainsFunc(r.targets(), func(c models.CheckCertItem) bool { return c.Name == name })
+}
+
+func (r *CertRegistry) save(targets []models.CheckCertItem) error {
+	if err := r.store.Save(targets); err != nil {
+		return err
+	}
+
+	r.publish()
+
+	return nil
+}
+
+// targets merges the configured and stored targets. The configuration wins
+// when both define the same name.
+func (r *CertRegistry) targets() []models.CheckCertItem {
+	result := slices.Clone(r.configured)
+	if result == nil {
+		result = []models.CheckCertItem{}
+	}
+
+	for _, item := range r.store.List() {
+		if !slices.ContainsFunc(result, func(c models.CheckCertItem) bool { return c.Name == item.Name }) {
+			result = append(result, item)
+		}
+	}
+
+	return result
+}
+
+// publish replaces the snapshot with the targets, expanding the sources into
+// their certificates
+func (r *CertRegistry) publish() {
+	for _, item := range r.store.List() {
+		if slices.ContainsFunc(r.configured, func(c models.CheckCertItem) bool { return c.Name == item.Name }) {
+			log.Printf("Ignoring stored target %s, the name is already configured", item.Name)
+		}
+	}
+
+	certs := []models.CheckCertItem{}
+	for _, item := range r.targets() {
+		if IsCertSource(item) {
+			certs = append(certs, r.sources[item.Name]...)
+			continue
+		}
+
+		certs = append(certs, item)
+	}
+
+	r.certs.Store(&certs)
+}
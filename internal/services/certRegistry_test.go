@@ -0,0 +1,141 @@
+package services
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/jlucaspains/sharp-cert-manager/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCertRegistryFind(t *testing.T) {
+	registry := NewCertRegistry([]models.CheckCertItem{{Name: "a", Url: "https://a"}, {Name: "b", Url: "https://b"}})
+
+	item, ok := registry.Find("b")
+	_, missing := registry.Find("c")
+
+	assert.True(t, ok)
+	assert.Equal(t, "https://b", item.Url)
+	assert.False(t, missing)
+}
+
+func TestCertRegistryReplaceKeepsSnapshots(t *testing.T) {
+	registry := NewCertRegistry([]models.CheckCertItem{{Name: "a", Url: "https://a"}})
+	snapshot := registry.List()
+
+	registry.Replace([]models.CheckCertItem{{Name: "b", Url: "https://b"}, {Name: "c", Url: "https://c"}})
+
+	assert.Equal(t, "a", snapshot[0].Name)
+	assert.Len(t, registry.List(), 2)
+}
+
+func TestCertRegistryNil(t *testing.T) {
+	var registry *CertRegistry
+
+	assert.Empty(t, registry.List())
+	assert.Empty(t, NewCertRegistry(nil).List())
+}
+
+func TestCertRegistryConcurrentReplace(t *testing.T) {
+	registry := NewCertRegistry([]models.CheckCertItem{})
+	wg := sync.WaitGroup{}
+
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			registry.Replace([]models.CheckCertItem{{Name: "a"}})
+		}()
+		go func() {
+			defer wg.Done()
+			registry.Find("a")
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, registry.List(), 1)
+}
+
+func newManagedRegistry(t *testing.T, configured ...models.CheckCertItem) (*CertRegistry, string) {
+	path := filepath.Join(t.TempDir(), "targets.json")
+	store, _ := NewTargetStore(path)
+	registry := NewCertRegistry(configured)
+	registry.SetTargetStore(store)
+
+	return registry, path
+}
+
+func TestCertRegistryAdd(t *testing.T) {
+	registry, path := newManagedRegistry(t, models.CheckCertItem{Name: "a", Url: "https://a"})
+
+	err := registry.Add(models.CheckCertItem{Name: "b", Url: "https://b"})
+
+	assert.Nil(t, err)
+	assert.Len(t, registry.List(), 2)
+	assert.True(t, registry.IsManaged("b"))
+	assert.False(t, registry.IsManaged("a"))
+
+	store, _ := NewTargetStore(path)
+	assert.Equal(t, []models.CheckCertItem{{Name: "b", Url: "https://b"}}, store.List())
+}
+
+func TestCertRegistryAddExisting(t *testing.T) {
+	registry, _ := newManagedRegistry(t, models.CheckCertItem{Name: "a", Url: "https://a"})
+
+	assert.ErrorIs(t, registry.Add(models.CheckCertItem{Name: "a", Url: "https://b"}), ErrTargetExists)
+}
+
+func TestCertRegistryWithoutStore(t *testing.T) {
+	registry := NewCertRegistry([]models.CheckCertItem{{Name: "a", Url: "https://a"}})
+
+	assert.ErrorIs(t, registry.Add(models.CheckCertItem{Name: "b"}), ErrNoTargetStore)
+	assert.ErrorIs(t, registry.Update("a", models.CheckCertItem{Name: "a"}), ErrNoTargetStore)
+	assert.ErrorIs(t, registry.Delete("a"), ErrNoTargetStore)
+}
+
+func TestCertRegistryUpdate(t *testing.T) {
+	registry, _ := newManagedRegistry(t)
+	registry.Add(models.CheckCertItem{Name: "b", Url: "https://b"})
+
+	err := registry.Update("b", models.CheckCertItem{Name: "c", Url: "https://c"})
+
+	_, old := registry.Find("b")
+	item, ok := registry.Find("c")
+
+	assert.Nil(t, err)
+	assert.False(t, old)
+	assert.True(t, ok)
+	assert.Equal(t, "https://c", item.Url)
+}
+
+func TestCertRegistryUpdateErrors(t *testing.T) {
+	registry, _ := newManagedRegistry(t, models.CheckCertItem{Name: "a", Url: "https://a"})
+	registry.Add(models.CheckCertItem{Name: "b", Url: "https://b"})
+
+	assert.ErrorIs(t, registry.Update("a", models.CheckCertItem{Name: "a"}), ErrTargetReadOnly)
+	assert.ErrorIs(t, registry.Update("x", models.CheckCertItem{Name: "x"}), ErrTargetNotFound)
+	assert.ErrorIs(t, registry.Update("b", models.CheckCertItem{Name: "a"}), ErrTargetExists)
+}
+
+func TestCertRegistryDelete(t *testing.T) {
+	registry, _ := newManagedRegistry(t, models.CheckCertItem{Name: "a", Url: "https://a"})
+	registry.Add(models.CheckCertItem{Name: "b", Url: "https://b"})
+
+	assert.ErrorIs(t, registry.Delete("a"), ErrTargetReadOnly)
+	assert.Nil(t, registry.Delete("b"))
+	assert.ErrorIs(t, registry.Delete("b"), ErrTargetNotFound)
+	assert.Len(t, registry.List(), 1)
+}
+
+func TestCertRegistryReplaceKeepsManagedTargets(t *testing.T) {
+	registry, _ := newManagedRegistry(t, models.CheckCertItem{Name: "a", Url: "https://a"})
+	registry.Add(models.CheckCertItem{Name: "b", Url: "https://b"})
+
+	registry.Replace([]models.CheckCertItem{{Name: "b", Url: "https://config-b"}, {Name: "c", Url: "https://c"}})
+
+	item, _ := registry.Find("b")
+
+	assert.Len(t, registry.List(), 2)
+	assert.Equal(t, "https://config-b", item.Url)
+}
@@ -2,37 +2,68 @@ package services
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"log"
-	"net/http"
+	"net"
 	"net/url"
 	"os"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/jlucaspains/sharp-cert-manager/internal/models"
 
-	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
 	"github.com/Azure/azure-sdk-for-go/sdk/security/keyvault/azcertificates"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
 )
 
-// http.client singleton
-var client = &http.Client{
-	CheckRedirect: func(req *http.Request, via []*http.Request) error {
-		return http.ErrUseLastResponse
-	},
-	// disabling security here is fine
-	// the purpose of the client is to pull certs
-	// no data exchange is happening
-	Transport: &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-	},
+// disabling security here is fine
+// the purpose of the probe is to pull certs
+// no data exchange is happening and the chain
+// is verified separately in validate. Legacy
+// protocols and ciphers are offered so they
+// can be detected and reported
+var tlsConfig = &tls.Config{
+	InsecureSkipVerify: true,
+	MinVersion:         tls.VersionTLS10,
+	CipherSuites:       getAllCipherSuites(),
 }
 
-var mockAzureResult []byte = nil
+// net.Dialer singleton used by all TLS probes
+var dialer = &net.Dialer{}
+
+// default time a single target check may take, including the dial, the
+// STARTTLS exchange, the handshake and the revocation lookups
+const defaultCheckTimeout = 10 * time.Second
+
+var checkTimeout atomic.Int64
+
+// SetCheckTimeout sets how long a single target check may take. A zero or
+// negative timeout restores the default.
+func SetCheckTimeout(timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = defaultCheckTimeout
+	}
+
+	checkTimeout.Store(int64(timeout))
+}
+
+func getCheckTimeout() time.Duration {
+	if timeout := checkTimeout.Load(); timeout > 0 {
+		return time.Duration(timeout)
+	}
+
+	return defaultCheckTimeout
+}
+
+var mockAzureResult *azcertificates.Certificate = nil
 
 func GetConfigCerts() []models.CheckCertItem {
 	result := []models.CheckCertItem{}
@@ -44,6 +75,7 @@ func GetConfigCerts() []models.CheckCertItem {
 		site, err := url.Parse(rawUrl)
 
 		if err != nil {
+			log.Printf("Ignoring SITE_%d, invalid url: %s", i, err)
 			continue
 		}
 
@@ -56,72 +88,315 @@ func GetConfigCerts() []models.CheckCertItem {
 			break
 		}
 		akvUrl, err := url.Parse(rawUrl)
+		certName := getAzureCertName(rawUrl)
+
+		if err == nil && isAzureVaultUrl(rawUrl) {
+			result = append(result, models.CheckCertItem{
+				Name:    akvUrl.Hostname(),
+				Url:     rawUrl,
+				Type:    models.CertCheckAzureVault,
+				Include: getEnvList(fmt.Sprintf("AZUREKEYVAULT_%d_INCLUDE", i)),
+				Exclude: getEnvList(fmt.Sprintf("AZUREKEYVAULT_%d_EXCLUDE", i)),
+			})
+			continue
+		}
 
-		if err != nil {
+		if err != nil || certName == "" {
+			log.Printf("Ignoring AZUREKEYVAULT_%d, invalid certificate url: %s", i, rawUrl)
 			continue
 		}
 
-		name := akvUrl.Hostname() + "/" + strings.Split(akvUrl.Path, "/")[2]
+		name := akvUrl.Hostname() + "/" + certName
 
 		result = append(result, models.CheckCertItem{Name: name, Url: rawUrl, Type: models.CertCheckAzure})
 	}
 
+	for i := 1; true; i++ {
+		rawUrl, ok := os.LookupEnv(fmt.Sprintf("AWSCERTIFICATES_%d", i))
+		if !ok {
+			break
+		}
+
+		if service, region, ok := getAWSSource(rawUrl); ok {
+			result = append(result, models.CheckCertItem{
+				Name:    strings.TrimSuffix(service+"/"+region, "/"),
+				Url:     rawUrl,
+				Type:    models.CertCheckAWSSource,
+				Include: getEnvList(fmt.Sprintf("AWSCERTIFICATES_%d_INCLUDE", i)),
+				Exclude: getEnvList(fmt.Sprintf("AWSCERTIFICATES_%d_EXCLUDE", i)),
+			})
+			continue
+		}
+
+		certificateArn, err := arn.Parse(rawUrl)
+
+		if err != nil || !isAWSCertArn(rawUrl) {
+			log.Printf("Ignoring AWSCERTIFICATES_%d, invalid source url or certificate ARN: %s", i, rawUrl)
+			continue
+		}
+
+		segments := strings.Split(certificateArn.Resource, "/")
+		name := certificateArn.Service + "/" + segments[len(segments)-1]
+
+		result = append(result, models.CheckCertItem{Name: name, Url: rawUrl, Type: models.CertCheckAWS})
+	}
+
+	for i := 1; true; i++ {
+		rawUrl, ok := os.LookupEnv(fmt.Sprintf("HASHICORPVAULT_%d", i))
+		if !ok {
+			break
+		}
+
+		path, ok := parseVaultUrl(rawUrl)
+
+		if !ok {
+			log.Printf("Ignoring HASHICORPVAULT_%d, invalid PKI or KV url: %s", i, rawUrl)
+			continue
+		}
+
+		name := strings.TrimSuffix(strings.TrimPrefix(path.Address, "https://")+"/"+path.Mount+"/"+path.Path, "/")
+
+		if path.Kind == vaultPKIList {
+			result = append(result, models.CheckCertItem{
+				Name:    name,
+				Url:     rawUrl,
+				Type:    models.CertCheckVaultPKI,
+				Include: getEnvList(fmt.Sprintf("HASHICORPVAULT_%d_INCLUDE", i)),
+				Exclude: getEnvList(fmt.Sprintf("HASHICORPVAULT_%d_EXCLUDE", i)),
+			})
+			continue
+		}
+
+		result = append(result, models.CheckCertItem{Name: name, Url: rawUrl, Type: models.CertCheckVault})
+	}
+
+	return result
+}
+
+// getEnvList splits a comma separated environment variable
+func getEnvList(key string) []string {
+	result := []string{}
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			result = append(result, value)
+		}
+	}
+
 	return result
 }
 
-func CheckCertStatus(cert models.CheckCertItem, expirationWarningDays int) (*models.CertCheckResult, error) {
+func CheckCertStatus(ctx context.Context, cert models.CheckCertItem, expirationWarningDays int) (*models.CertCheckResult, error) {
 	if cert.Name == "" || cert.Url == "" {
 		err := errors.New("name, url, and type are required")
 		return nil, err
 	}
 
+	if cert.WarningDays > 0 {
+		expirationWarningDays = cert.WarningDays
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, getCheckTimeout())
+	defer cancel()
+
+	var result *models.CertCheckResult
+	var err error
+
 	switch cert.Type {
 	case models.CertCheckURL:
-		return checkCertByUrlStatus(cert.Name, cert.Url, expirationWarningDays)
+		result, err = checkCertByUrlStatus(ctx, cert, expirationWarningDays)
 	case models.CertCheckAzure:
-		return checkAzureCertStatus(cert.Name, cert.Url, expirationWarningDays)
+		result, err = checkAzureCertStatus(ctx, cert.Name, cert.Url, expirationWarningDays)
+	case models.CertCheckAWS:
+		result, err = checkAWSCertStatus(ctx, cert.Name, cert.Url, expirationWarningDays)
+	case models.CertCheckVault:
+		result, err = checkVaultCertStatus(ctx, cert.Name, cert.Url, expirationWarningDays)
+	default:
+		return nil, errors.New("invalid type")
 	}
 
-	return nil, errors.New("invalid type")
+	if result != nil {
+		result.CheckedAt = time.Now().UTC()
+	}
+
+	recordHistory(cert.Name, result, err)
+
+	return result, err
 }
 
-func checkCertByUrlStatus(name string, url string, expirationWarningDays int) (*models.CertCheckResult, error) {
-	resp, err := client.Get(url)
+func checkCertByUrlStatus(ctx context.Context, cert models.CheckCertItem, expirationWarningDays int) (*models.CertCheckResult, error) {
+	name := cert.Name
+	parsedUrl, err := url.Parse(cert.Url)
+
+	if err != nil {
+		return getEmptyResult(name), err
+	}
+
+	// the SNI override is also the name the certificate must be valid for
+	serverName := parsedUrl.Hostname()
+	if cert.SNI != "" {
+		serverName = cert.SNI
+	}
+
+	// the IP override only changes where the probe connects to
+	host := parsedUrl.Hostname()
+	if cert.IP != "" {
+		host = cert.IP
+	}
+
+	var address string
+	var upgrade upgradeFunc
+	if protocol, ok := starttlsProtocols[parsedUrl.Scheme]; ok {
+		address = getHostPort(host, parsedUrl.Port(), protocol.defaultPort)
+		upgrade = protocol.upgrade
+	} else if parsedUrl.Scheme == "https" {
+		address = getHostPort(host, parsedUrl.Port(), "443")
+	} else {
+		return getEmptyResult(name), nil
+	}
+
+	state, err := probeTLS(ctx, address, serverName, upgrade, 0)
 
-	if err != nil || resp.TLS == nil {
-		result := &models.CertCheckResult{Hostname: name, CertStartDate: time.Time{}, CertEndDate: time.Time{}, CertDnsNames: []string{}, IsValid: false, ValidityInDays: 0}
-		return result, err
+	if err != nil || len(state.PeerCertificates) == 0 {
+		return getEmptyResult(name), err
 	}
 
-	result := prepareResult(resp.TLS.PeerCertificates[0], resp.TLS.PeerCertificates[1:], name, expirationWarningDays, false)
+	result := prepareResult(state.PeerCertificates[0], state.PeerCertificates[1:], name, serverName, expirationWarningDays, false, false)
+
+	supportedVersions := []string{}
+	if tlsVersionSweep.Load() {
+		supportedVersions = sweepTLSVersions(ctx, address, serverName, upgrade)
+	}
+
+	applyConnectionState(result, state, supportedVersions)
+	applyRevocationStatus(ctx, result, state.PeerCertificates[0], state.PeerCertificates[1:], state.OCSPResponse)
 
 	return result, nil
 }
 
-func checkAzureCertStatus(name string, rawUrl string, expirationWarningDays int) (*models.CertCheckResult, error) {
+// probeTLS only performs the TLS handshake against address and returns the
+// negotiated connection state. No application data is ever sent so it works
+// for hosts that are not HTTP or that misbehave after the handshake. When
+// upgrade is provided, it runs the protocol's STARTTLS exchange first. A
+// non zero version restricts the handshake to that TLS protocol version.
+// The whole exchange is abandoned once ctx is done.
+func probeTLS(ctx context.Context, address string, serverName string, upgrade upgradeFunc, version uint16) (*tls.ConnectionState, error) {
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	// the STARTTLS exchanges use plain reads and writes so unblock them
+	// through the connection deadline
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	if upgrade != nil {
+		if err := upgrade(conn); err != nil {
+			return nil, err
+		}
+	}
+
+	config := tlsConfig.Clone()
+	config.ServerName = serverName
+	if version != 0 {
+		config.MinVersion = version
+		config.MaxVersion = version
+	}
+
+	tlsConn := tls.Client(conn, config)
+
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return nil, err
+	}
+
+	state := tlsConn.ConnectionState()
+
+	return &state, nil
+}
+
+func getHostPort(host string, port string, defaultPort string) string {
+	if port == "" {
+		port = defaultPort
+	}
+
+	return net.JoinHostPort(host, port)
+}
+
+func getEmptyResult(name string) *models.CertCheckResult {
+	return &models.CertCheckResult{Hostname: name, CertStartDate: time.Time{}, CertEndDate: time.Time{}, CertDnsNames: []string{}, IsValid: false, ValidityInDays: 0}
+}
+
+func checkAzureCertStatus(ctx context.Context, name string, rawUrl string, expirationWarningDays int) (*models.CertCheckResult, error) {
 	parsedUrl, _ := url.Parse(rawUrl)
 	keyVaultUrl := parsedUrl.Scheme + "://" + parsedUrl.Host
-	certName := strings.Split(parsedUrl.Path, "/")[2]
+	certName := getAzureCertName(rawUrl)
 
-	cer, err := getCertFromKeyVault(keyVaultUrl, certName, name, expirationWarningDays)
+	if certName == "" {
+		return nil, fmt.Errorf("invalid Azure Key Vault certificate url: %s", rawUrl)
+	}
+
+	certificate, err := getCertFromKeyVault(ctx, keyVaultUrl, certName, getAzureCertVersion(rawUrl))
 
 	if err != nil {
 		return nil, err
 	}
 
-	cert, err := x509.ParseCertificate(cer)
+	cert, err := x509.ParseCertificate(certificate.CER)
 
 	if err != nil {
 		return nil, err
 	}
 
-	result := prepareResult(cert, []*x509.Certificate{}, name, expirationWarningDays, true)
+	result := prepareResult(cert, []*x509.Certificate{}, name, "", expirationWarningDays, true, true)
+	applyKeyVaultInfo(result, certificate)
 
 	return result, nil
 }
 
-func prepareResult(certificate *x509.Certificate, peerCertificates []*x509.Certificate, name string, expirationWarningDays int, skipHostNameValidation bool) *models.CertCheckResult {
-	isValid, errors := validate(certificate, name, skipHostNameValidation)
+// getAzureCertName returns the certificate name from a Key Vault url in the
+// format https://{vault}.vault.azure.net/certificates/{name}
+func getAzureCertName(rawUrl string) string {
+	parsedUrl, err := url.Parse(rawUrl)
+
+	if err != nil {
+		return ""
+	}
+
+	segments := strings.Split(parsedUrl.Path, "/")
+	if len(segments) < 3 || segments[1] != "certificates" {
+		return ""
+	}
+
+	return segments[2]
+}
+
+// getAzureCertVersion returns the version from a Key Vault url in the format
+// https://{vault}.vault.azure.net/certificates/{name}/{version} or an empty
+// string for the current version
+func getAzureCertVersion(rawUrl string) string {
+	parsedUrl, err := url.Parse(rawUrl)
+
+	if err != nil {
+		return ""
+	}
+
+	segments := strings.Split(parsedUrl.Path, "/")
+	if len(segments) < 4 || segments[1] != "certificates" {
+		return ""
+	}
+
+	return segments[3]
+}
+
+func prepareResult(certificate *x509.Certificate, peerCertificates []*x509.Certificate, name string, hostName string, expirationWarningDays int, skipHostNameValidation bool, skipChainValidation bool) *models.CertCheckResult {
+	isValid, errors := validate(certificate, peerCertificates, hostName, skipHostNameValidation, skipChainValidation)
 	certNotAfter := certificate.NotAfter.UTC()
 	now := time.Now().UTC()
 	return &models.CertCheckResult{
@@ -131,9 +406,11 @@ func prepareResult(certificate *x509.Certificate, peerCertificates []*x509.Certi
 		CertStartDate:     certificate.NotBefore,
 		CertEndDate:       certificate.NotAfter,
 		CertDnsNames:      certificate.DNSNames,
-		TLSVersion:        uint16(certificate.Version),
 		IsCA:              certificate.IsCA,
 		CommonName:        certificate.Subject.CommonName,
+		SerialNumber:      certificate.SerialNumber.Text(16),
+		Fingerprint:       getFingerprint(certificate),
+		KeyType:           getKeyType(certificate),
 		IsValid:           isValid,
 		OtherCerts:        getOtherCerts(peerCertificates),
 		ValidationIssues:  errors,
@@ -142,6 +419,39 @@ func prepareResult(certificate *x509.Certificate, peerCertificates []*x509.Certi
 	}
 }
 
+// applyAutoRenew clears the expiration warning of a certificate the service
+// renews automatically and otherwise flags the missing renewal
+func applyAutoRenew(result *models.CertCheckResult, autoRenew bool, service string) {
+	if !result.ExpirationWarning {
+		return
+	}
+
+	if autoRenew {
+		result.ExpirationWarning = false
+		return
+	}
+
+	result.ValidationIssues = append(result.ValidationIssues, fmt.Sprintf("Certificate is expiring and is not renewed automatically by %s", service))
+}
+
+// getFingerprint returns the SHA-256 fingerprint of the DER encoded certificate
+func getFingerprint(certificate *x509.Certificate) string {
+	hash := sha256.Sum256(certificate.Raw)
+	return hex.EncodeToString(hash[:])
+}
+
+// getKeyType describes the public key algorithm and size e.g. RSA 2048
+func getKeyType(certificate *x509.Certificate) string {
+	switch key := certificate.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA %d", key.N.BitLen())
+	case *ecdsa.PublicKey:
+		return fmt.Sprintf("ECDSA %s", key.Curve.Params().Name)
+	}
+
+	return certificate.PublicKeyAlgorithm.String()
+}
+
 func getValidityInDays(startDate time.Time, endDate time.Time) int {
 	if startDate.IsZero() || endDate.IsZero() {
 		return 0
@@ -155,39 +465,40 @@ func getValidityInDays(startDate time.Time, endDate time.Time) int {
 	return int(validity.Hours() / 24)
 }
 
-func getCertFromKeyVault(keyVaultUrl string, certName string, hostName string, expirationWarningDays int) ([]byte, error) {
+// getCertFromKeyVault returns the certificate with its attributes, tags and
+// policy
+func getCertFromKeyVault(ctx context.Context, keyVaultUrl string, certName string, version string) (azcertificates.Certificate, error) {
 	if mockAzureResult != nil {
-		return mockAzureResult, nil
+		return *mockAzureResult, nil
 	}
 
-	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	client, err := keyVaultClients.get(keyVaultUrl)
 
 	if err != nil {
-		return nil, err
-	}
-
-	client, err := azcertificates.NewClient(keyVaultUrl, cred, nil)
-
-	if err != nil {
-		return nil, err
+		return azcertificates.Certificate{}, err
 	}
 
 	log.Printf("Getting certificate from Azure Key Vault: %s", certName)
 
-	response, err := client.GetCertificate(context.Background(), certName, "", nil)
+	response, err := client.GetCertificate(ctx, certName, version, nil)
+	keyVaultClients.record(keyVaultUrl, err)
 
 	if err != nil {
-		return nil, err
+		return azcertificates.Certificate{}, err
 	}
 
-	return response.CER, nil
+	return response.Certificate, nil
 }
 
-func validate(cert *x509.Certificate, hostName string, skipHostNameValidation bool) (bool, []string) {
+func validate(cert *x509.Certificate, intermediates []*x509.Certificate, hostName string, skipHostNameValidation bool, skipChainValidation bool) (bool, []string) {
 	isHostNameValid := skipHostNameValidation || cert.VerifyHostname(hostName) == nil
 	areDatesValid := cert.NotBefore.Before(time.Now().UTC()) && cert.NotAfter.After(time.Now().UTC())
 	isSignatureValid := cert.SignatureAlgorithm.String() != "SHA1-RSA"
-	isValid := isHostNameValid && areDatesValid && isSignatureValid
+	chainIssues := []string{}
+	if !skipChainValidation {
+		chainIssues = verifyChain(cert, intermediates)
+	}
+	isValid := isHostNameValid && areDatesValid && isSignatureValid && len(chainIssues) == 0
 
 	errors := []string{}
 	if !isHostNameValid {
@@ -199,6 +510,7 @@ func validate(cert *x509.Certificate, hostName string, skipHostNameValidation bo
 	if !isSignatureValid {
 		errors = append(errors, "SHA1 is not a secure signature algorithm")
 	}
+	errors = append(errors, chainIssues...)
 
 	return isValid, errors
 }
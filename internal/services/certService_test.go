@@ -1,18 +1,22 @@
 package services
 
 import (
+	"context"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"math/big"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/security/keyvault/azcertificates"
 	"github.com/jlucaspains/sharp-cert-manager/internal/models"
 	"github.com/joho/godotenv"
 	"github.com/stretchr/testify/assert"
@@ -20,7 +24,7 @@ import (
 
 func TestGetCheckStatusUrl(t *testing.T) {
 	url := "https://blog.lpains.net"
-	body, err := CheckCertStatus(models.CheckCertItem{Name: "blog.lpains.net", Url: url, Type: models.CertCheckURL}, 30)
+	body, err := CheckCertStatus(context.Background(), models.CheckCertItem{Name: "blog.lpains.net", Url: url, Type: models.CertCheckURL}, 30)
 
 	assert.Nil(t, err)
 	assert.True(t, body.IsValid)
@@ -33,11 +37,12 @@ func TestGetCheckStatusUrl(t *testing.T) {
 func TestGetCheckStatusAzure(t *testing.T) {
 	url := "https://testfake.vault.azure.net/certificates/test-fake"
 	name := "testfake.vault.azure.net/test-fake"
-	mockAzureResult = createCertificate()
+	mockAzureResult = &azcertificates.Certificate{CER: createCertificate()}
 
-	err := os.WriteFile("D:\\cert.cer", mockAzureResult, os.FileMode(0644))
+	err := os.WriteFile(filepath.Join(t.TempDir(), "cert.cer"), mockAzureResult.CER, os.FileMode(0644))
+	assert.Nil(t, err)
 
-	body, err := CheckCertStatus(models.CheckCertItem{Name: name, Url: url, Type: models.CertCheckAzure}, 30)
+	body, err := CheckCertStatus(context.Background(), models.CheckCertItem{Name: name, Url: url, Type: models.CertCheckAzure}, 30)
 
 	assert.Nil(t, err)
 	assert.True(t, body.IsValid)
@@ -87,7 +92,7 @@ func TestGetCheckStatusAzureInvalidAkv(t *testing.T) {
 	name := "testfake.vault.azure.net/test-fake"
 	mockAzureResult = nil
 
-	_, err := CheckCertStatus(models.CheckCertItem{Name: name, Url: url, Type: models.CertCheckAzure}, 30)
+	_, err := CheckCertStatus(context.Background(), models.CheckCertItem{Name: name, Url: url, Type: models.CertCheckAzure}, 30)
 
 	assert.NotNil(t, err)
 	assert.Contains(t, err.Error(), "no such host")
@@ -95,7 +100,7 @@ func TestGetCheckStatusAzureInvalidAkv(t *testing.T) {
 
 func TestGetCheckWarning(t *testing.T) {
 	url := "https://blog.lpains.net"
-	body, err := CheckCertStatus(models.CheckCertItem{Name: "blog.lpains.net", Url: url, Type: models.CertCheckURL}, 10000)
+	body, err := CheckCertStatus(context.Background(), models.CheckCertItem{Name: "blog.lpains.net", Url: url, Type: models.CertCheckURL}, 10000)
 
 	assert.Nil(t, err)
 	assert.True(t, body.IsValid)
@@ -108,7 +113,7 @@ func TestGetCheckWarning(t *testing.T) {
 
 func TestGetCheckStatusNoUrl(t *testing.T) {
 	url := ""
-	_, err := CheckCertStatus(models.CheckCertItem{Name: "", Url: url, Type: models.CertCheckURL}, 30)
+	_, err := CheckCertStatus(context.Background(), models.CheckCertItem{Name: "", Url: url, Type: models.CertCheckURL}, 30)
 
 	assert.NotNil(t, err)
 	assert.Equal(t, "name, url, and type are required", err.Error())
@@ -116,7 +121,7 @@ func TestGetCheckStatusNoUrl(t *testing.T) {
 
 func TestGetCheckStatusHttp(t *testing.T) {
 	url := "http://blog.lpains.net"
-	body, err := CheckCertStatus(models.CheckCertItem{Name: "blog.lpains.net", Url: url, Type: models.CertCheckURL}, 30)
+	body, err := CheckCertStatus(context.Background(), models.CheckCertItem{Name: "blog.lpains.net", Url: url, Type: models.CertCheckURL}, 30)
 
 	assert.Nil(t, err)
 	assert.False(t, body.IsValid)
@@ -186,11 +191,11 @@ yjbTOuy8KoxNb15g3Ysesbw=
 	defer ts.Close()
 
 	url := ts.URL
-	body, err := CheckCertStatus(models.CheckCertItem{Name: "test", Url: url, Type: models.CertCheckURL}, 30)
+	body, err := CheckCertStatus(context.Background(), models.CheckCertItem{Name: "test", Url: url, Type: models.CertCheckURL}, 30)
 
 	assert.Nil(t, err)
 	assert.False(t, body.IsValid)
-	assert.Equal(t, []string{"Hostname is not valid", "Certificate is not valid yet or expired", "SHA1 is not a secure signature algorithm"}, body.ValidationIssues)
+	assert.Equal(t, []string{"Hostname is not valid", "Certificate is not valid yet or expired", "SHA1 is not a secure signature algorithm", "Certificate is self-signed"}, body.ValidationIssues)
 }
 
 func TestGetConfigCerts(t *testing.T) {
@@ -206,3 +211,57 @@ func TestGetConfigCerts(t *testing.T) {
 	assert.Equal(t, "https://testfake.vault.azure.net/certificates/test-fake", sites[1].Url)
 	assert.Equal(t, models.CertCheckAzure, sites[1].Type)
 }
+
+func TestGetCheckStatusRawTLS(t *testing.T) {
+	trustTestRoot(t)
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{createTLSCertificate("localhost")}})
+	assert.Nil(t, err)
+	defer listener.Close()
+
+	received := make(chan int, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		// complete the handshake but never answer as an HTTP server
+		conn.(*tls.Conn).Handshake()
+		buf := make([]byte, 1)
+		n, _ := conn.Read(buf)
+		received <- n
+	}()
+
+	url := "https://" + listener.Addr().String()
+	body, err := CheckCertStatus(context.Background(), models.CheckCertItem{Name: "localhost", Url: url, Type: models.CertCheckURL}, 30)
+
+	assert.Nil(t, err)
+	assert.True(t, body.IsValid)
+	assert.Contains(t, body.CertDnsNames, "localhost")
+	assert.Equal(t, 0, <-received)
+}
+
+func TestGetCheckStatusRawTLSConnectionRefused(t *testing.T) {
+	listener, _ := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{createTLSCertificate("localhost")}})
+	url := "https://" + listener.Addr().String()
+	listener.Close()
+
+	body, err := CheckCertStatus(context.Background(), models.CheckCertItem{Name: "localhost", Url: url, Type: models.CertCheckURL}, 30)
+
+	assert.NotNil(t, err)
+	assert.False(t, body.IsValid)
+}
+
+func createTLSCertificate(dnsName string) tls.Certificate {
+	root, rootKey := getTestRoot()
+	leaf, leafKey := createTestCert(&x509.Certificate{Subject: pkix.Name{CommonName: dnsName}, DNSNames: []string{dnsName}, IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)}}, root, rootKey)
+
+	return tls.Certificate{Certificate: [][]byte{leaf.Raw}, PrivateKey: leafKey}
+}
+
+func TestGetKeyType(t *testing.T) {
+	cert, _ := x509.ParseCertificate(createTLSCertificate("localhost").Certificate[0])
+
+	assert.Equal(t, "ECDSA P-256", getKeyType(cert))
+}
@@ -0,0 +1,233 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/jlucaspains/sharp-cert-manager/internal/models"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+)
+
+type targetsConfig struct {
+	Targets []models.CertTargetParams `json:"targets" yaml:"targets" validate:"required,min=1,unique=Name,dive"`
+}
+
+var certCheckTypes = map[string]models.CertCheckType{
+	"":      models.CertCheckURL,
+	"url":   models.CertCheckURL,
+	"azure": models.CertCheckAzure,
+	"aws":   models.CertCheckAWS,
+	"vault": models.CertCheckVault,
+}
+
+// LoadConfigCerts reads the monitored targets from a YAML or JSON file. The
+// format is picked from the file extension and the content is validated so
+// mistakes are reported at startup instead of silently skipped.
+func LoadConfigCerts(path string) ([]models.CheckCertItem, error) {
+	config := targetsConfig{}
+
+	if err := readConfigFile(path, &config); err != nil {
+		return nil, err
+	}
+
+	result := []models.CheckCertItem{}
+	for i, target := range config.Targets {
+		item, err := GetCheckCertItem(target)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid config file %s: targets[%d].%w", path, i, err)
+		}
+
+		result = append(result, item)
+	}
+
+	return result, nil
+}
+
+// readConfigFile decodes and validates a YAML or JSON file into config. The
+// format is picked from the file extension and unknown fields are rejected.
+func readConfigFile(path string, config any) error {
+	content, err := os.ReadFile(path)
+
+	if err != nil {
+		return err
+	}
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		decoder := json.NewDecoder(bytes.NewReader(content))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(config)
+	} else {
+		decoder := yaml.NewDecoder(bytes.NewReader(content))
+		decoder.KnownFields(true)
+		err = decoder.Decode(config)
+	}
+
+	if err != nil {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	if err := validateConfig(config); err != nil {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// GetCheckCertItem converts an already validated target to the item checked
+// by CheckCertStatus.
+// Azure targets pointing to a whole vault, AWS targets pointing to an ACM
+// region or to IAM and Vault targets pointing to a PKI mount are monitored
+// through all of their certificates.
+func GetCheckCertItem(target models.CertTargetParams) (models.CheckCertItem, error) {
+	checkType := certCheckTypes[target.Type]
+
+	if checkType == models.CertCheckAzure && isAzureVaultUrl(target.Url) {
+		checkType = models.CertCheckAzureVault
+	}
+
+	if checkType == models.CertCheckAzure && getAzureCertName(target.Url) == "" {
+		return models.CheckCertItem{}, errors.New("url should be an Azure Key Vault or certificate URL")
+	}
+
+	if checkType == models.CertCheckAWS && isAWSSourceUrl(target.Url) {
+		checkType = models.CertCheckAWSSource
+	}
+
+	if checkType == models.CertCheckAWS && !isAWSCertArn(target.Url) {
+		return models.CheckCertItem{}, errors.New("url should be an acm://{region} or iam://global URL or an ACM or IAM certificate ARN")
+	}
+
+	if checkType == models.CertCheckVault && isVaultPKIListUrl(target.Url) {
+		checkType = models.CertCheckVaultPKI
+	}
+
+	if checkType == models.CertCheckVault && !isVaultCertUrl(target.Url) {
+		return models.CheckCertItem{}, errors.New("url should be a Vault PKI certs, PKI cert or KV v2 data URL")
+	}
+
+	item := models.CheckCertItem{Type: checkType}
+	if !IsCertSource(item) && (len(target.Include) > 0 || len(target.Exclude) > 0) {
+		return models.CheckCertItem{}, errors.New("include and exclude are only supported for Azure Key Vault, AWS and Vault PKI source URLs")
+	}
+
+	if err := validateNameFilters("include", target.Include); err != nil {
+		return models.CheckCertItem{}, err
+	}
+
+	if err := validateNameFilters("exclude", target.Exclude); err != nil {
+		return models.CheckCertItem{}, err
+	}
+
+	return models.CheckCertItem{
+		Name:        target.Name,
+		Url:         target.Url,
+		Type:        checkType,
+		WarningDays: target.WarningDays,
+		Tags:        target.Tags,
+		SNI:         target.SNI,
+		IP:          target.IP,
+		Recipients:  target.Recipients,
+		Include:     target.Include,
+		Exclude:     target.Exclude,
+	}, nil
+}
+
+// NewValidator returns a validator that reports fields by the name in the
+// given struct tag, e.g. json or yaml, so errors match what users wrote. It
+// adds the bcrypt tag for password hashes.
+func NewValidator(tagName string) *validator.Validate {
+	result := validator.New()
+	result.RegisterTagNameFunc(func(field reflect.StructField) string {
+		return strings.Split(field.Tag.Get(tagName), ",")[0]
+	})
+	result.RegisterValidation("bcrypt", isBcryptHash)
+
+	return result
+}
+
+// isBcryptHash tells whether the field holds a well formed bcrypt hash
+func isBcryptHash(fl validator.FieldLevel) bool {
+	_, err := bcrypt.Cost([]byte(fl.Field().String()))
+
+	return err == nil
+}
+
+var configValidator = NewValidator("yaml")
+
+func validateConfig(config any) error {
+	err := configValidator.Struct(config)
+
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return err
+	}
+
+	messages := []string{}
+	for _, fieldError := range validationErrors {
+		messages = append(messages, GetValidationErrorMsg(fieldError))
+	}
+
+	return errors.New(strings.Join(messages, "; "))
+}
+
+// GetValidationErrorMsg describes a failed validation of a config file or
+// API payload field
+func GetValidationErrorMsg(fe validator.FieldError) string {
+	// drop the root struct name from the namespace e.g. targetsConfig.targets[0].url
+	field := fe.Namespace()
+	if idx := strings.Index(field, "."); idx >= 0 {
+		field = field[idx+1:]
+	}
+
+	switch fe.Tag() {
+	case "required", "required_if", "required_unless":
+		return fmt.Sprintf("%s is required", field)
+	case "lte":
+		return fmt.Sprintf("%s should be less than or equal to %s", field, fe.Param())
+	case "lt":
+		return fmt.Sprintf("%s should be less than %s", field, fe.Param())
+	case "gte":
+		return fmt.Sprintf("%s should be greater than or equal to %s", field, fe.Param())
+	case "gt":
+		return fmt.Sprintf("%s should be greater than %s", field, fe.Param())
+	case "min":
+		if kind := fe.Kind(); kind == reflect.Slice || kind == reflect.Array || kind == reflect.Map {
+			return fmt.Sprintf("%s should have at least %s item", field, fe.Param())
+		}
+
+		return fmt.Sprintf("%s should have minimum length of %s", field, fe.Param())
+	case "max":
+		return fmt.Sprintf("%s should have maximum length of %s", field, fe.Param())
+	case "alpha":
+		return fmt.Sprintf("%s should contain alpha characters only", field)
+	case "unique":
+		return fmt.Sprintf("%s should have unique names", field)
+	case "oneof":
+		return fmt.Sprintf("%s should be one of: %s", field, fe.Param())
+	case "url":
+		return fmt.Sprintf("%s should be a valid URL", field)
+	case "hostname":
+		return fmt.Sprintf("%s should be a valid hostname", field)
+	case "ip":
+		return fmt.Sprintf("%s should be a valid IP address", field)
+	case "email":
+		return fmt.Sprintf("%s should be a valid email address", field)
+	case "sha256":
+		return fmt.Sprintf("%s should be a hex encoded sha256 hash", field)
+	case "startswith":
+		return fmt.Sprintf("%s should start with %s", field, fe.Param())
+	case "bcrypt":
+		return fmt.Sprintf("%s should be a bcrypt hash", field)
+	}
+
+	return fmt.Sprintf("%s is not valid", field)
+}
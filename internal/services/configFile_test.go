@@ -0,0 +1,290 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jlucaspains/sharp-cert-manager/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeConfigFile(t *testing.T, name string, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	os.WriteFile(path, []byte(content), 0644)
+
+	return path
+}
+
+func TestLoadConfigCertsYaml(t *testing.T) {
+	path := writeConfigFile(t, "targets.yaml", `
+targets:
+  - name: blog
+    url: https://blog.lpains.net
+    warningDays: 60
+    tags: [blog, public]
+    sni: blog.lpains.net
+    ip: 10.0.0.1
+  - name: vault cert
+    type: azure
+    url: https://testfake.vault.azure.net/certificates/test-fake
+`)
+
+	certs, err := LoadConfigCerts(path)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []models.CheckCertItem{
+		{Name: "blog", Url: "https://blog.lpains.net", Type: models.CertCheckURL, WarningDays: 60, Tags: []string{"blog", "public"}, SNI: "blog.lpains.net", IP: "10.0.0.1"},
+		{Name: "vault cert", Url: "https://testfake.vault.azure.net/certificates/test-fake", Type: models.CertCheckAzure},
+	}, certs)
+}
+
+func TestLoadConfigCertsJson(t *testing.T) {
+	path := writeConfigFile(t, "targets.json", `{"targets": [{"name": "mail", "type": "url", "url": "smtp://mail.lpains.net:587", "tags": ["mail"]}]}`)
+
+	certs, err := LoadConfigCerts(path)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []models.CheckCertItem{
+		{Name: "mail", Url: "smtp://mail.lpains.net:587", Type: models.CertCheckURL, Tags: []string{"mail"}},
+	}, certs)
+}
+
+func TestLoadConfigCertsMissingFile(t *testing.T) {
+	_, err := LoadConfigCerts(filepath.Join(t.TempDir(), "missing.yaml"))
+
+	assert.NotNil(t, err)
+}
+
+func TestLoadConfigCertsUnknownField(t *testing.T) {
+	path := writeConfigFile(t, "targets.yaml", `
+targets:
+  - name: blog
+    uri: https://blog.lpains.net
+`)
+
+	_, err := LoadConfigCerts(path)
+
+	assert.Contains(t, err.Error(), "field uri not found")
+}
+
+func TestLoadConfigCertsValidation(t *testing.T) {
+	path := writeConfigFile(t, "targets.yaml", `
+targets:
+  - name: blog
+    type: http
+    url: not a url
+    warningDays: -1
+    ip: 10.0.0
+  - url: https://blog.lpains.net
+    sni: "bad sni!"
+    recipients: [ops@lpains.net, ops]
+`)
+
+	_, err := LoadConfigCerts(path)
+
+	assert.Equal(t, "invalid config file "+path+": "+
+		"targets[0].type should be one of: url azure aws vault; "+
+		"targets[0].url should be a valid URL; "+
+		"targets[0].warningDays should be greater than or equal to 0; "+
+		"targets[0].ip should be a valid IP address; "+
+		"targets[1].name is required; "+
+		"targets[1].sni should be a valid hostname; "+
+		"targets[1].recipients[1] should be a valid email address", err.Error())
+}
+
+func TestLoadConfigCertsDuplicateNames(t *testing.T) {
+	path := writeConfigFile(t, "targets.yaml", `
+targets:
+  - name: blog
+    url: https://blog.lpains.net
+  - name: blog
+    url: https://blog.lpains.net:8443
+`)
+
+	_, err := LoadConfigCerts(path)
+
+	assert.Equal(t, "invalid config file "+path+": targets should have unique names", err.Error())
+}
+
+func TestLoadConfigCertsEmpty(t *testing.T) {
+	path := writeConfigFile(t, "targets.yaml", "targets: []\n")
+
+	_, err := LoadConfigCerts(path)
+
+	assert.Equal(t, "invalid config file "+path+": targets should have at least 1 item", err.Error())
+}
+
+func TestLoadConfigCertsInvalidAzureUrl(t *testing.T) {
+	path := writeConfigFile(t, "targets.yaml", `
+targets:
+  - name: vault
+    type: azure
+    url: https://testfake.vault.azure.net/keys/test-fake
+`)
+
+	_, err := LoadConfigCerts(path)
+
+	assert.Equal(t, "invalid config file "+path+": targets[0].url should be an Azure Key Vault or certificate URL", err.Error())
+}
+
+func TestLoadConfigCertsAzureVault(t *testing.T) {
+	path := writeConfigFile(t, "targets.yaml", `
+targets:
+  - name: vault
+    type: azure
+    url: https://testfake.vault.azure.net/
+    include: ["api-*", "web-*"]
+    exclude: ["*-old"]
+`)
+
+	certs, err := LoadConfigCerts(path)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []models.CheckCertItem{
+		{Name: "vault", Url: "https://testfake.vault.azure.net/", Type: models.CertCheckAzureVault, Include: []string{"api-*", "web-*"}, Exclude: []string{"*-old"}},
+	}, certs)
+}
+
+func TestLoadConfigCertsInvalidVaultFilters(t *testing.T) {
+	path := writeConfigFile(t, "targets.yaml", `
+targets:
+  - name: blog
+    url: https://blog.lpains.net
+    include: ["blog"]
+`)
+
+	_, err := LoadConfigCerts(path)
+
+	assert.Equal(t, "invalid config file "+path+": targets[0].include and exclude are only supported for Azure Key Vault, AWS and Vault PKI source URLs", err.Error())
+
+	path = writeConfigFile(t, "targets.yaml", `
+targets:
+  - name: vault
+    type: azure
+    url: https://testfake.vault.azure.net
+    exclude: ["[old"]
+`)
+
+	_, err = LoadConfigCerts(path)
+
+	assert.Equal(t, "invalid config file "+path+": targets[0].exclude has an invalid name pattern [old", err.Error())
+}
+
+func TestLoadConfigCertsAWS(t *testing.T) {
+	path := writeConfigFile(t, "targets.yaml", `
+targets:
+  - name: acm
+    type: aws
+    url: acm://us-east-1
+    exclude: ["old.*"]
+  - name: iam
+    type: aws
+    url: iam://global
+  - name: api
+    type: aws
+    url: arn:aws:acm:us-east-1:123456789012:certificate/1111
+`)
+
+	certs, err := LoadConfigCerts(path)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []models.CheckCertItem{
+		{Name: "acm", Url: "acm://us-east-1", Type: models.CertCheckAWSSource, Exclude: []string{"old.*"}},
+		{Name: "iam", Url: "iam://global", Type: models.CertCheckAWSSource},
+		{Name: "api", Url: "arn:aws:acm:us-east-1:123456789012:certificate/1111", Type: models.CertCheckAWS},
+	}, certs)
+}
+
+func TestLoadConfigCertsInvalidAWSUrl(t *testing.T) {
+	path := writeConfigFile(t, "targets.yaml", `
+targets:
+  - name: bucket
+    type: aws
+    url: arn:aws:s3:::bucket
+`)
+
+	_, err := LoadConfigCerts(path)
+
+	assert.Equal(t, "invalid config file "+path+": targets[0].url should be an acm://{region} or iam://global URL or an ACM or IAM certificate ARN", err.Error())
+}
+
+func TestLoadConfigCertsVault(t *testing.T) {
+	path := writeConfigFile(t, "targets.yaml", `
+targets:
+  - name: pki
+    type: vault
+    url: https://vault:8200/v1/pki/certs
+    include: ["1a:*"]
+  - name: web
+    type: vault
+    url: https://vault:8200/v1/secret/data/tls/web
+`)
+
+	certs, err := LoadConfigCerts(path)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []models.CheckCertItem{
+		{Name: "pki", Url: "https://vault:8200/v1/pki/certs", Type: models.CertCheckVaultPKI, Include: []string{"1a:*"}},
+		{Name: "web", Url: "https://vault:8200/v1/secret/data/tls/web", Type: models.CertCheckVault},
+	}, certs)
+}
+
+func TestLoadConfigCertsInvalidVaultUrl(t *testing.T) {
+	path := writeConfigFile(t, "targets.yaml", `
+targets:
+  - name: pki
+    type: vault
+    url: https://vault:8200/v1/pki
+`)
+
+	_, err := LoadConfigCerts(path)
+
+	assert.Equal(t, "invalid config file "+path+": targets[0].url should be a Vault PKI certs, PKI cert or KV v2 data URL", err.Error())
+}
+
+func TestGetCheckStatusOverrides(t *testing.T) {
+	url := startTLSServer(t, &tls.Config{})
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(url, "https://"))
+
+	body, err := CheckCertStatus(context.Background(), models.CheckCertItem{
+		Name:        "override",
+		Url:         "https://unresolvable.invalid:" + port,
+		Type:        models.CertCheckURL,
+		IP:          "127.0.0.1",
+		SNI:         "localhost",
+		WarningDays: 10000,
+	}, 30)
+
+	assert.Nil(t, err)
+	assert.True(t, body.IsValid)
+	assert.Equal(t, "override", body.Hostname)
+	assert.True(t, body.ExpirationWarning)
+}
+
+func TestValidationErrorMsgStartsWith(t *testing.T) {
+	type prefixed struct {
+		Url  string `yaml:"url" validate:"startswith=https://"`
+		Hash string `yaml:"hash" validate:"startswith=$2"`
+	}
+
+	err := validateConfig(&prefixed{Url: "http://blog.lpains.net", Hash: "secret"})
+
+	assert.Equal(t, "url should start with https://; hash should start with $2", err.Error())
+}
+
+func TestValidationErrorMsgBcrypt(t *testing.T) {
+	type hashed struct {
+		PasswordHash string `yaml:"passwordHash" validate:"bcrypt"`
+	}
+
+	assert.Nil(t, validateConfig(&hashed{PasswordHash: "$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy"}))
+
+	err := validateConfig(&hashed{PasswordHash: "$2a$10$short"})
+
+	assert.Equal(t, "passwordHash should be a bcrypt hash", err.Error())
+}
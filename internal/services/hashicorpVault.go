@@ -0,0 +1,424 @@
+package services
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	vault "github.com/hashicorp/vault/api"
+	"github.com/jlucaspains/sharp-cert-manager/internal/models"
+)
+
+// VaultAuthConfig selects how HashiCorp Vault is authenticated. A token is
+// used as is while an AppRole role and secret ID are exchanged for a token.
+// Without either the VAULT_TOKEN environment variable is used.
+type VaultAuthConfig struct {
+	Token        string
+	RoleID       string
+	SecretID     string
+	AppRoleMount string
+}
+
+// kinds of HashiCorp Vault urls
+const (
+	vaultPKIList = "certs"
+	vaultPKICert = "cert"
+	vaultKVData  = "data"
+)
+
+// number of PKI certificates read at the same time to find the expired ones
+const vaultPKIReadWorkers = 8
+
+var vaultPKIExpiredDays atomic.Int64
+
+// SetVaultPKIExpiredDays skips PKI certificates that expired more than days
+// ago when a PKI mount is listed. Zero lists every certificate.
+func SetVaultPKIExpiredDays(days int) {
+	vaultPKIExpiredDays.Store(int64(max(days, 0)))
+}
+
+// vaultPath is a HashiCorp Vault API url split into the server address, the
+// secrets engine mount and the certificate serial or KV path it points to
+type vaultPath struct {
+	Address string
+	Mount   string
+	Kind    string
+	Path    string
+}
+
+// hashiCorpVaultClients shares one authenticated client per Vault server
+// across all HashiCorp Vault checks
+type hashiCorpVaultClients struct {
+	auth    VaultAuthConfig
+	clients map[string]*vault.Client
+	lock    sync.Mutex
+}
+
+var vaultClients = &hashiCorpVaultClients{}
+
+// SetVaultAuth sets how the HashiCorp Vault checks authenticate
+func SetVaultAuth(config VaultAuthConfig) error {
+	if (config.RoleID == "") != (config.SecretID == "") {
+		return errors.New("the AppRole Vault auth requires a role ID and secret ID")
+	}
+
+	if config.AppRoleMount == "" {
+		config.AppRoleMount = "approle"
+	}
+
+	vaultClients.lock.Lock()
+	defer vaultClients.lock.Unlock()
+
+	vaultClients.auth = config
+	vaultClients.clients = nil
+
+	return nil
+}
+
+// get returns the client of the Vault server, logging in with AppRole on
+// first use when it is configured
+func (c *hashiCorpVaultClients) get(ctx context.Context, address string) (*vault.Client, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if client, ok := c.clients[address]; ok {
+		return client, nil
+	}
+
+	config := vault.DefaultConfig()
+
+	if config.Error != nil {
+		return nil, config.Error
+	}
+
+	config.Address = address
+
+	// VAULT_CACERT wins over the app trust store
+	if transport, ok := config.HttpClient.Transport.(*http.Transport); ok && transport.TLSClientConfig.RootCAs == nil {
+		transport.TLSClientConfig.RootCAs = getRootCAs()
+	}
+
+	client, err := vault.NewClient(config)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if c.auth.Token != "" {
+		client.SetToken(c.auth.Token)
+	}
+
+	if c.auth.RoleID != "" {
+		client.ClearToken()
+		secret, err := client.Logical().WriteWithContext(ctx, "auth/"+c.auth.AppRoleMount+"/login", map[string]interface{}{
+			"role_id":   c.auth.RoleID,
+			"secret_id": c.auth.SecretID,
+		})
+
+		if err != nil {
+			return nil, fmt.Errorf("AppRole login failed: %w", err)
+		}
+
+		if secret == nil || secret.Auth == nil || secret.Auth.ClientToken == "" {
+			return nil, errors.New("AppRole login returned no token")
+		}
+
+		client.SetToken(secret.Auth.ClientToken)
+	}
+
+	if c.clients == nil {
+		c.clients = map[string]*vault.Client{}
+	}
+
+	c.clients[address] = client
+
+	return client, nil
+}
+
+// record drops the client of a server that denied access so the next check
+// logs in again e.g. after the AppRole token expired
+func (c *hashiCorpVaultClients) record(address string, err error) {
+	var responseErr *vault.ResponseError
+	if !errors.As(err, &responseErr) || responseErr.StatusCode != http.StatusForbidden {
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	delete(c.clients, address)
+}
+
+// parseVaultUrl splits a HashiCorp Vault API url in one of the formats
+// https://{server}/v1/{mount}/certs, https://{server}/v1/{mount}/cert/{serial}
+// or https://{server}/v1/{mount}/data/{path}
+func parseVaultUrl(rawUrl string) (vaultPath, bool) {
+	parsedUrl, err := url.Parse(rawUrl)
+
+	if err != nil || parsedUrl.Host == "" || !strings.HasPrefix(parsedUrl.Path, "/v1/") {
+		return vaultPath{}, false
+	}
+
+	address := parsedUrl.Scheme + "://" + parsedUrl.Host
+	segments := strings.Split(strings.Trim(strings.TrimPrefix(parsedUrl.Path, "/v1/"), "/"), "/")
+	length := len(segments)
+
+	if i := slices.Index(segments, vaultKVData); i > 0 && i < length-1 {
+		return vaultPath{Address: address, Mount: strings.Join(segments[:i], "/"), Kind: vaultKVData, Path: strings.Join(segments[i+1:], "/")}, true
+	}
+
+	if length > 1 && segments[length-1] == vaultPKIList {
+		return vaultPath{Address: address, Mount: strings.Join(segments[:length-1], "/"), Kind: vaultPKIList}, true
+	}
+
+	if length > 2 && segments[length-2] == vaultPKICert && segments[length-1] != "" {
+		return vaultPath{Address: address, Mount: strings.Join(segments[:length-2], "/"), Kind: vaultPKICert, Path: segments[length-1]}, true
+	}
+
+	return vaultPath{}, false
+}
+
+func isVaultPKIListUrl(rawUrl string) bool {
+	path, ok := parseVaultUrl(rawUrl)
+	return ok && path.Kind == vaultPKIList
+}
+
+func isVaultCertUrl(rawUrl string) bool {
+	path, ok := parseVaultUrl(rawUrl)
+	return ok && path.Kind != vaultPKIList
+}
+
+// ExpandVaultPKI lists the certificates issued by a PKI mount and returns one
+// item for each of them. The items are named after the PKI target and the
+// certificate serial and inherit its settings.
+func ExpandVaultPKI(ctx context.Context, source models.CheckCertItem) ([]models.CheckCertItem, error) {
+	path, ok := parseVaultUrl(source.Url)
+
+	if !ok || path.Kind != vaultPKIList {
+		return nil, fmt.Errorf("invalid HashiCorp Vault PKI url: %s", source.Url)
+	}
+
+	client, err := vaultClients.get(ctx, path.Address)
+
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Listing certificates from HashiCorp Vault PKI: %s/%s", path.Address, path.Mount)
+
+	secret, err := client.Logical().ListWithContext(ctx, path.Mount+"/certs")
+	vaultClients.record(path.Address, err)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := []models.CheckCertItem{}
+	if secret == nil {
+		return result, nil
+	}
+
+	serials := []string{}
+	keys, _ := secret.Data["keys"].([]interface{})
+	for _, key := range keys {
+		serial, ok := key.(string)
+
+		if ok && matchesNameFilters(serial, source.Include, source.Exclude) {
+			serials = append(serials, serial)
+		}
+	}
+
+	if days := vaultPKIExpiredDays.Load(); days > 0 {
+		serials = dropExpiredVaultPKICerts(ctx, client, path, serials, time.Duration(days)*24*time.Hour)
+	}
+
+	for _, serial := range serials {
+		result = append(result, models.CheckCertItem{
+			Name:        source.Name + "/" + serial,
+			Url:         path.Address + "/v1/" + path.Mount + "/cert/" + serial,
+			Type:        models.CertCheckVault,
+			WarningDays: source.WarningDays,
+			Tags:        source.Tags,
+			Recipients:  source.Recipients,
+		})
+	}
+
+	slices.SortFunc(result, func(a, b models.CheckCertItem) int { return strings.Compare(a.Name, b.Name) })
+
+	return result, nil
+}
+
+// dropExpiredVaultPKICerts reads the certificates with a bounded pool of
+// workers and removes the serials that expired longer ago than expiredFor.
+// Vault keeps expired certificates until the mount is tidied. A certificate
+// that cannot be read in time is kept so its check says why.
+func dropExpiredVaultPKICerts(ctx context.Context, client *vault.Client, path vaultPath, serials []string, expiredFor time.Duration) []string {
+	ctx, cancel := context.WithTimeout(ctx, getCheckTimeout())
+	defer cancel()
+
+	expired := make([]bool, len(serials))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+
+	for range min(vaultPKIReadWorkers, len(serials)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := range indexes {
+				bundle, _, err := readVaultPKICert(ctx, client, vaultPath{Address: path.Address, Mount: path.Mount, Kind: vaultPKICert, Path: serials[i]})
+
+				if err != nil {
+					continue
+				}
+
+				if certs, err := parsePEMCertificates(bundle); err == nil && len(certs) > 0 {
+					expired[i] = time.Since(certs[0].NotAfter) > expiredFor
+				}
+			}
+		}()
+	}
+
+	for i := range serials {
+		indexes <- i
+	}
+
+	close(indexes)
+	wg.Wait()
+
+	result := []string{}
+	for i, serial := range serials {
+		if !expired[i] {
+			result = append(result, serial)
+		}
+	}
+
+	return result
+}
+
+func checkVaultCertStatus(ctx context.Context, name string, rawUrl string, expirationWarningDays int) (*models.CertCheckResult, error) {
+	path, ok := parseVaultUrl(rawUrl)
+
+	if !ok || path.Kind == vaultPKIList {
+		return nil, fmt.Errorf("invalid HashiCorp Vault certificate url: %s", rawUrl)
+	}
+
+	client, err := vaultClients.get(ctx, path.Address)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var bundle string
+	var revokedAt time.Time
+	if path.Kind == vaultPKICert {
+		bundle, revokedAt, err = readVaultPKICert(ctx, client, path)
+	} else {
+		bundle, err = readVaultKVBundle(ctx, client, path)
+	}
+
+	vaultClients.record(path.Address, err)
+
+	if err != nil {
+		return nil, err
+	}
+
+	certs, err := parsePEMCertificates(bundle)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificate found in %s", rawUrl)
+	}
+
+	// bundles may list the CA first, the leaf is the first non CA certificate
+	leaf := slices.IndexFunc(certs, func(cert *x509.Certificate) bool { return !cert.IsCA })
+	if leaf < 0 {
+		leaf = 0
+	}
+
+	intermediates := slices.Delete(slices.Clone(certs), leaf, leaf+1)
+	result := prepareResult(certs[leaf], intermediates, name, "", expirationWarningDays, true, true)
+
+	if !revokedAt.IsZero() {
+		result.IsValid = false
+		result.RevocationStatus = RevocationRevoked
+		result.RevocationSource = "Vault PKI"
+		result.RevokedAt = revokedAt
+		result.ValidationIssues = append(result.ValidationIssues, fmt.Sprintf("Certificate was revoked on %s", revokedAt.Format("Jan 02, 2006")))
+	}
+
+	return result, nil
+}
+
+// readVaultPKICert returns the PEM certificate and CA chain of a serial and
+// when it was revoked, if it was
+func readVaultPKICert(ctx context.Context, client *vault.Client, path vaultPath) (string, time.Time, error) {
+	log.Printf("Getting certificate from HashiCorp Vault PKI: %s", path.Path)
+
+	secret, err := client.Logical().ReadWithContext(ctx, path.Mount+"/cert/"+path.Path)
+
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	if secret == nil {
+		return "", time.Time{}, fmt.Errorf("certificate %s not found", path.Path)
+	}
+
+	bundle, _ := secret.Data["certificate"].(string)
+	chain, _ := secret.Data["ca_chain"].([]interface{})
+	for _, cert := range chain {
+		if pem, ok := cert.(string); ok {
+			bundle += "\n" + pem
+		}
+	}
+
+	revokedAt := time.Time{}
+	if revocationTime, ok := secret.Data["revocation_time"].(json.Number); ok {
+		if seconds, err := revocationTime.Int64(); err == nil && seconds > 0 {
+			revokedAt = time.Unix(seconds, 0).UTC()
+		}
+	}
+
+	return bundle, revokedAt, nil
+}
+
+// readVaultKVBundle returns the PEM values of a KV v2 secret in key order
+func readVaultKVBundle(ctx context.Context, client *vault.Client, path vaultPath) (string, error) {
+	log.Printf("Getting certificate from HashiCorp Vault KV: %s", path.Path)
+
+	secret, err := client.KVv2(path.Mount).Get(ctx, path.Path)
+
+	if err != nil {
+		return "", err
+	}
+
+	keys := []string{}
+	for key := range secret.Data {
+		keys = append(keys, key)
+	}
+
+	slices.Sort(keys)
+
+	bundle := ""
+	for _, key := range keys {
+		if value, ok := secret.Data[key].(string); ok {
+			bundle += value + "\n"
+		}
+	}
+
+	return bundle, nil
+}
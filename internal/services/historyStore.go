@@ -0,0 +1,263 @@
+package services
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jlucaspains/sharp-cert-manager/internal/models"
+	bolt "go.etcd.io/bbolt"
+)
+
+// default number of entries kept per target
+const defaultHistoryMaxEntries = 1000
+
+// HistoryStore records the result of every check so it can be reviewed later.
+// List returns the newest entries first.
+type HistoryStore interface {
+	Record(entry models.CertHistoryEntry) error
+	List(name string, limit int) ([]models.CertHistoryEntry, error)
+	Close() error
+}
+
+var historyStore HistoryStore
+var historyStoreLock sync.RWMutex
+
+// SetHistoryStore sets the store where every check is recorded. A nil store
+// disables the history.
+func SetHistoryStore(store HistoryStore) {
+	historyStoreLock.Lock()
+	defer historyStoreLock.Unlock()
+
+	historyStore = store
+}
+
+func getHistoryStore() HistoryStore {
+	historyStoreLock.RLock()
+	defer historyStoreLock.RUnlock()
+
+	return historyStore
+}
+
+// GetCertHistory returns up to limit entries for name, newest first, with
+// the entries where the certificate changed flagged as rotated.
+func GetCertHistory(name string, limit int) ([]models.CertHistoryEntry, error) {
+	store := getHistoryStore()
+
+	if store == nil {
+		return []models.CertHistoryEntry{}, nil
+	}
+
+	// one extra entry tells whether the oldest returned one is a rotation
+	entries, err := store.List(name, limit+1)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range entries {
+		previous := findPreviousFingerprint(entries[i+1:])
+		current := entries[i].Result.Fingerprint
+		entries[i].Rotated = current != "" && previous != "" && current != previous
+	}
+
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+
+	return entries, nil
+}
+
+func findPreviousFingerprint(olderEntries []models.CertHistoryEntry) string {
+	for _, entry := range olderEntries {
+		if entry.Result.Fingerprint != "" {
+			return entry.Result.Fingerprint
+		}
+	}
+
+	return ""
+}
+
+func recordHistory(name string, result *models.CertCheckResult, checkErr error) {
+	store := getHistoryStore()
+
+	if store == nil {
+		return
+	}
+
+	entry := models.CertHistoryEntry{Name: name, CheckedAt: time.Now().UTC()}
+
+	if result != nil {
+		entry.Result = *result
+	}
+
+	if checkErr != nil {
+		entry.Error = checkErr.Error()
+	}
+
+	if err := store.Record(entry); err != nil {
+		log.Printf("Error recording history for %s: %s", name, err)
+	}
+}
+
+// MemoryHistoryStore keeps the history in memory. It is lost on restart.
+type MemoryHistoryStore struct {
+	entries    map[string][]models.CertHistoryEntry
+	maxEntries int
+	lock       sync.RWMutex
+}
+
+func NewMemoryHistoryStore(maxEntries int) *MemoryHistoryStore {
+	if maxEntries <= 0 {
+		maxEntries = defaultHistoryMaxEntries
+	}
+
+	return &MemoryHistoryStore{entries: map[string][]models.CertHistoryEntry{}, maxEntries: maxEntries}
+}
+
+func (s *MemoryHistoryStore) Record(entry models.CertHistoryEntry) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	entries := append(s.entries[entry.Name], entry)
+	if len(entries) > s.maxEntries {
+		entries = entries[len(entries)-s.maxEntries:]
+	}
+
+	s.entries[entry.Name] = entries
+
+	return nil
+}
+
+func (s *MemoryHistoryStore) List(name string, limit int) ([]models.CertHistoryEntry, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	entries := s.entries[name]
+	result := []models.CertHistoryEntry{}
+	for i := len(entries) - 1; i >= 0 && len(result) < limit; i-- {
+		result = append(result, entries[i])
+	}
+
+	return result, nil
+}
+
+func (s *MemoryHistoryStore) Close() error {
+	return nil
+}
+
+var historyBucket = []byte("history")
+
+// BoltHistoryStore keeps the history in a single bbolt database file. Each
+// target has its own bucket keyed by an increasing sequence.
+type BoltHistoryStore struct {
+	db         *bolt.DB
+	maxEntries int
+}
+
+func NewBoltHistoryStore(path string, maxEntries int) (*BoltHistoryStore, error) {
+	if maxEntries <= 0 {
+		maxEntries = defaultHistoryMaxEntries
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(historyBucket)
+		return err
+	})
+
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &BoltHistoryStore{db: db, maxEntries: maxEntries}, nil
+}
+
+func (s *BoltHistoryStore) Record(entry models.CertHistoryEntry) error {
+	value, err := json.Marshal(entry)
+
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.Bucket(historyBucket).CreateBucketIfNotExists([]byte(entry.Name))
+
+		if err != nil {
+			return err
+		}
+
+		sequence, err := bucket.NextSequence()
+
+		if err != nil {
+			return err
+		}
+
+		if err := bucket.Put(getHistoryKey(sequence), value); err != nil {
+			return err
+		}
+
+		// drop the oldest entries once the target is over the limit
+		if sequence <= uint64(s.maxEntries) {
+			return nil
+		}
+
+		cursor := bucket.Cursor()
+		oldest := sequence - uint64(s.maxEntries)
+		expired := [][]byte{}
+		for key, _ := cursor.First(); key != nil && binary.BigEndian.Uint64(key) <= oldest; key, _ = cursor.Next() {
+			expired = append(expired, key)
+		}
+
+		for _, key := range expired {
+			if err := bucket.Delete(key); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (s *BoltHistoryStore) List(name string, limit int) ([]models.CertHistoryEntry, error) {
+	result := []models.CertHistoryEntry{}
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(historyBucket).Bucket([]byte(name))
+
+		if bucket == nil {
+			return nil
+		}
+
+		cursor := bucket.Cursor()
+		for key, value := cursor.Last(); key != nil && len(result) < limit; key, value = cursor.Prev() {
+			entry := models.CertHistoryEntry{}
+
+			if err := json.Unmarshal(value, &entry); err != nil {
+				return err
+			}
+
+			result = append(result, entry)
+		}
+
+		return nil
+	})
+
+	return result, err
+}
+
+func (s *BoltHistoryStore) Close() error {
+	return s.db.Close()
+}
+
+func getHistoryKey(sequence uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, sequence)
+}
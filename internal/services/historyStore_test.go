@@ -0,0 +1,132 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jlucaspains/sharp-cert-manager/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func getHistoryEntry(name string, fingerprint string) models.CertHistoryEntry {
+	return models.CertHistoryEntry{Name: name, CheckedAt: time.Now().UTC(), Result: models.CertCheckResult{Hostname: name, Fingerprint: fingerprint}}
+}
+
+func useMemoryHistoryStore(t *testing.T) *MemoryHistoryStore {
+	store := NewMemoryHistoryStore(10)
+	SetHistoryStore(store)
+	t.Cleanup(func() { SetHistoryStore(nil) })
+
+	return store
+}
+
+func TestMemoryHistoryStore(t *testing.T) {
+	store := NewMemoryHistoryStore(2)
+
+	store.Record(getHistoryEntry("blog", "a"))
+	store.Record(getHistoryEntry("blog", "b"))
+	store.Record(getHistoryEntry("blog", "c"))
+	store.Record(getHistoryEntry("mail", "d"))
+
+	entries, err := store.List("blog", 10)
+
+	assert.Nil(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "c", entries[0].Result.Fingerprint)
+	assert.Equal(t, "b", entries[1].Result.Fingerprint)
+}
+
+func TestBoltHistoryStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	store, err := NewBoltHistoryStore(path, 2)
+	assert.Nil(t, err)
+
+	store.Record(getHistoryEntry("blog", "a"))
+	store.Record(getHistoryEntry("blog", "b"))
+	store.Record(getHistoryEntry("blog", "c"))
+	store.Record(getHistoryEntry("mail", "d"))
+	store.Close()
+
+	// entries survive reopening the file
+	store, err = NewBoltHistoryStore(path, 2)
+	assert.Nil(t, err)
+	defer store.Close()
+
+	entries, err := store.List("blog", 10)
+
+	assert.Nil(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "c", entries[0].Result.Fingerprint)
+	assert.Equal(t, "b", entries[1].Result.Fingerprint)
+
+	entries, err = store.List("blog", 1)
+
+	assert.Nil(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestBoltHistoryStoreUnknownName(t *testing.T) {
+	store, err := NewBoltHistoryStore(filepath.Join(t.TempDir(), "history.db"), 0)
+	assert.Nil(t, err)
+	defer store.Close()
+
+	entries, err := store.List("blog", 10)
+
+	assert.Nil(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestGetCertHistoryRotation(t *testing.T) {
+	store := useMemoryHistoryStore(t)
+	store.Record(getHistoryEntry("blog", "a"))
+	store.Record(getHistoryEntry("blog", "a"))
+	store.Record(models.CertHistoryEntry{Name: "blog", Error: "connection refused"})
+	store.Record(getHistoryEntry("blog", "b"))
+
+	entries, err := GetCertHistory("blog", 3)
+
+	assert.Nil(t, err)
+	assert.Len(t, entries, 3)
+	assert.True(t, entries[0].Rotated)
+	assert.False(t, entries[1].Rotated)
+	assert.False(t, entries[2].Rotated)
+}
+
+func TestGetCertHistoryNoStore(t *testing.T) {
+	SetHistoryStore(nil)
+
+	entries, err := GetCertHistory("blog", 10)
+
+	assert.Nil(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestCheckCertStatusRecordsHistory(t *testing.T) {
+	store := useMemoryHistoryStore(t)
+	url := startTLSServer(t, &tls.Config{})
+
+	result, err := CheckCertStatus(context.Background(), models.CheckCertItem{Name: "localhost", Url: url, Type: models.CertCheckURL}, 30)
+	assert.Nil(t, err)
+
+	entries, _ := store.List("localhost", 10)
+
+	assert.Len(t, entries, 1)
+	assert.Equal(t, result.Fingerprint, entries[0].Result.Fingerprint)
+	assert.NotEmpty(t, entries[0].Result.SerialNumber)
+	assert.Empty(t, entries[0].Error)
+}
+
+func TestRecordHistoryError(t *testing.T) {
+	store := useMemoryHistoryStore(t)
+
+	recordHistory("blog", nil, errors.New("connection refused"))
+
+	entries, _ := store.List("blog", 10)
+
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "connection refused", entries[0].Error)
+}
@@ -0,0 +1,17 @@
+package services
+
+import (
+	"github.com/jlucaspains/sharp-cert-manager/internal/models"
+)
+
+// LoadNotificationsConfig reads the notification channels from a YAML or
+// JSON file
+func LoadNotificationsConfig(path string) (models.NotificationsConfig, error) {
+	config := models.NotificationsConfig{}
+
+	if err := readConfigFile(path, &config); err != nil {
+		return models.NotificationsConfig{}, err
+	}
+
+	return config, nil
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadNotificationsConfig(t *testing.T) {
+	path := writeConfigFile(t, "notifications.yaml", `
+channels:
+  - name: ops
+    type: teams
+    url: https://lpains.webhook.office.com/hook
+  - name: security
+    type: email
+    smtp:
+      host: smtp.lpains.net
+      from: certs@lpains.net
+      to: [sec@lpains.net]
+    rules:
+      - tags: [public]
+        names: ["prod-*"]
+        severities: [error]
+`)
+
+	config, err := LoadNotificationsConfig(path)
+
+	assert.Nil(t, err)
+	assert.Len(t, config.Channels, 2)
+	assert.Equal(t, []string{"prod-*"}, config.Channels[1].Rules[0].Names)
+	assert.Equal(t, []string{"sec@lpains.net"}, config.Channels[1].SMTP.To)
+}
+
+func TestLoadNotificationsConfigDuplicateNames(t *testing.T) {
+	path := writeConfigFile(t, "notifications.json", `{
+	"channels": [
+		{"name": "ops", "type": "teams", "url": "https://lpains.net/hook"},
+		{"name": "ops", "type": "slack", "url": "https://lpains.net/hook"}
+	]
+}`)
+
+	_, err := LoadNotificationsConfig(path)
+
+	assert.Equal(t, "invalid config file "+path+": channels should have unique names", err.Error())
+}
+
+func TestLoadNotificationsConfigInvalid(t *testing.T) {
+	path := writeConfigFile(t, "notifications.json", `{
+	"channels": [
+		{"name": "ops", "type": "teams"},
+		{"name": "incidents", "type": "custom", "url": "https://lpains.net/hook"},
+		{"name": "sec", "type": "email", "rules": [{"severities": ["critical"]}]},
+		{"name": "oncall", "type": "pagerduty"},
+		{"name": "side", "type": "discord"}
+	]
+}`)
+
+	_, err := LoadNotificationsConfig(path)
+
+	assert.Equal(t, "invalid config file "+path+": channels[0].url is required; channels[1].template is required; "+
+		"channels[2].smtp is required; channels[2].rules[0].severities[0] should be one of: error warning info; "+
+		"channels[3].routingKey is required; channels[4].url is required", err.Error())
+}
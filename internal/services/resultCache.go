@@ -0,0 +1,74 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/jlucaspains/sharp-cert-manager/internal/models"
+)
+
+type cachedResult struct {
+	url    string
+	result *models.CertCheckResult
+}
+
+// ResultCache keeps the last known result of each target for ttl so pages
+// can be rendered without probing the target again. A zero ttl disables it.
+type ResultCache struct {
+	ttl     time.Duration
+	results map[string]cachedResult
+	lock    sync.RWMutex
+}
+
+func NewResultCache(ttl time.Duration) *ResultCache {
+	return &ResultCache{ttl: ttl, results: map[string]cachedResult{}}
+}
+
+// Get returns the cached result for item. Results cached for a different url
+// of the same target name are ignored.
+func (c *ResultCache) Get(item models.CheckCertItem) (*models.CertCheckResult, bool) {
+	if c == nil || c.ttl <= 0 {
+		return nil, false
+	}
+
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	cached, ok := c.results[item.Name]
+
+	if !ok || cached.url != item.Url || time.Since(cached.result.CheckedAt) > c.ttl {
+		return nil, false
+	}
+
+	return cached.result, true
+}
+
+func (c *ResultCache) Set(item models.CheckCertItem, result *models.CertCheckResult) {
+	if c == nil || c.ttl <= 0 || result == nil {
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.results[item.Name] = cachedResult{url: item.Url, result: result}
+}
+
+// CheckCertStatus returns the cached result for item unless refresh is set or
+// it expired, in which case the target is checked and the cache updated.
+func (c *ResultCache) CheckCertStatus(ctx context.Context, item models.CheckCertItem, expirationWarningDays int, refresh bool) (*models.CertCheckResult, error) {
+	if !refresh {
+		if result, ok := c.Get(item); ok {
+			return result, nil
+		}
+	}
+
+	result, err := CheckCertStatus(ctx, item, expirationWarningDays)
+
+	if err == nil {
+		c.Set(item, result)
+	}
+
+	return result, err
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"testing"
+	"time"
+
+	"github.com/jlucaspains/sharp-cert-manager/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResultCacheGet(t *testing.T) {
+	cache := NewResultCache(time.Minute)
+	item := models.CheckCertItem{Name: "blog", Url: "https://blog.lpains.net"}
+	cache.Set(item, &models.CertCheckResult{Hostname: "blog", CheckedAt: time.Now()})
+
+	result, ok := cache.Get(item)
+
+	assert.True(t, ok)
+	assert.Equal(t, "blog", result.Hostname)
+
+	_, ok = cache.Get(models.CheckCertItem{Name: "blog", Url: "https://other.lpains.net"})
+
+	assert.False(t, ok)
+}
+
+func TestResultCacheExpired(t *testing.T) {
+	cache := NewResultCache(time.Minute)
+	item := models.CheckCertItem{Name: "blog", Url: "https://blog.lpains.net"}
+	cache.Set(item, &models.CertCheckResult{Hostname: "blog", CheckedAt: time.Now().Add(-2 * time.Minute)})
+
+	_, ok := cache.Get(item)
+
+	assert.False(t, ok)
+}
+
+func TestResultCacheDisabled(t *testing.T) {
+	cache := NewResultCache(0)
+	item := models.CheckCertItem{Name: "blog", Url: "https://blog.lpains.net"}
+	cache.Set(item, &models.CertCheckResult{Hostname: "blog", CheckedAt: time.Now()})
+
+	_, ok := cache.Get(item)
+
+	assert.False(t, ok)
+
+	var nilCache *ResultCache
+	_, ok = nilCache.Get(item)
+
+	assert.False(t, ok)
+}
+
+func TestResultCacheCheckCertStatus(t *testing.T) {
+	cache := NewResultCache(time.Minute)
+	item := models.CheckCertItem{Name: "localhost", Url: startTLSServer(t, &tls.Config{}), Type: models.CertCheckURL}
+
+	first, err := cache.CheckCertStatus(context.Background(), item, 30, false)
+	assert.Nil(t, err)
+	assert.False(t, first.CheckedAt.IsZero())
+
+	cached, _ := cache.CheckCertStatus(context.Background(), item, 30, false)
+	assert.Same(t, first, cached)
+
+	refreshed, err := cache.CheckCertStatus(context.Background(), item, 30, true)
+	assert.Nil(t, err)
+	assert.NotSame(t, first, refreshed)
+}
@@ -0,0 +1,248 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jlucaspains/sharp-cert-manager/internal/models"
+	"golang.org/x/crypto/ocsp"
+)
+
+const (
+	RevocationGood    = "Good"
+	RevocationRevoked = "Revoked"
+	RevocationUnknown = "Unknown"
+)
+
+const (
+	revocationSourceStapled = "OCSP stapling"
+	revocationSourceOCSP    = "OCSP responder"
+	revocationSourceCRL     = "CRL"
+)
+
+// default time a revocation status is cached when the response has no next update
+const revocationCacheDuration = time.Hour
+
+var revocationClient = &http.Client{Timeout: 10 * time.Second}
+
+type revocationStatus struct {
+	status    string
+	source    string
+	revokedAt time.Time
+	expiresAt time.Time
+}
+
+var revocationCache = map[string]revocationStatus{}
+var revocationCacheLock sync.Mutex
+
+func applyRevocationStatus(ctx context.Context, result *models.CertCheckResult, cert *x509.Certificate, intermediates []*x509.Certificate, stapledResponse []byte) {
+	status := checkRevocation(ctx, cert, findIssuer(cert, intermediates), stapledResponse)
+
+	result.RevocationStatus = status.status
+	result.RevocationSource = status.source
+	result.RevokedAt = status.revokedAt
+
+	if status.status == RevocationRevoked {
+		result.IsValid = false
+		result.ValidationIssues = append(result.ValidationIssues, fmt.Sprintf("Certificate was revoked on %s", status.revokedAt.Format("Jan 02, 2006")))
+	}
+}
+
+// checkRevocation tries the stapled OCSP response first, then the OCSP
+// responders and finally the CRL distribution points of cert.
+func checkRevocation(ctx context.Context, cert *x509.Certificate, issuer *x509.Certificate, stapledResponse []byte) revocationStatus {
+	if issuer == nil {
+		return revocationStatus{status: RevocationUnknown}
+	}
+
+	if len(stapledResponse) > 0 {
+		if status, err := parseOCSPResponse(stapledResponse, cert, issuer, revocationSourceStapled); err == nil && status.status != RevocationUnknown {
+			return status
+		}
+	}
+
+	key := getRevocationCacheKey(cert)
+	if status, ok := getCachedRevocation(key); ok {
+		return status
+	}
+
+	status := queryOCSPResponders(ctx, cert, issuer)
+
+	if status.status == RevocationUnknown {
+		status = queryCRLDistributionPoints(ctx, cert, issuer)
+	}
+
+	if status.status != RevocationUnknown {
+		setCachedRevocation(key, status)
+	}
+
+	return status
+}
+
+func queryOCSPResponders(ctx context.Context, cert *x509.Certificate, issuer *x509.Certificate) revocationStatus {
+	request, err := ocsp.CreateRequest(cert, issuer, nil)
+
+	if err != nil {
+		return revocationStatus{status: RevocationUnknown}
+	}
+
+	for _, server := range cert.OCSPServer {
+		body, err := postRevocationRequest(ctx, server, request)
+
+		if err != nil {
+			log.Printf("Error querying OCSP responder %s: %s", server, err)
+			continue
+		}
+
+		status, err := parseOCSPResponse(body, cert, issuer, revocationSourceOCSP)
+
+		if err == nil && status.status != RevocationUnknown {
+			return status
+		}
+	}
+
+	return revocationStatus{status: RevocationUnknown}
+}
+
+func parseOCSPResponse(body []byte, cert *x509.Certificate, issuer *x509.Certificate, source string) (revocationStatus, error) {
+	response, err := ocsp.ParseResponseForCert(body, cert, issuer)
+
+	if err != nil {
+		return revocationStatus{status: RevocationUnknown}, err
+	}
+
+	result := revocationStatus{source: source, expiresAt: response.NextUpdate}
+
+	switch response.Status {
+	case ocsp.Good:
+		result.status = RevocationGood
+	case ocsp.Revoked:
+		result.status = RevocationRevoked
+		result.revokedAt = response.RevokedAt
+	default:
+		result.status = RevocationUnknown
+	}
+
+	return result, nil
+}
+
+func queryCRLDistributionPoints(ctx context.Context, cert *x509.Certificate, issuer *x509.Certificate) revocationStatus {
+	for _, distributionPoint := range cert.CRLDistributionPoints {
+		body, err := getRevocationList(ctx, distributionPoint)
+
+		if err != nil {
+			log.Printf("Error downloading CRL %s: %s", distributionPoint, err)
+			continue
+		}
+
+		crl, err := x509.ParseRevocationList(body)
+
+		if err != nil || crl.CheckSignatureFrom(issuer) != nil {
+			log.Printf("Invalid CRL at %s", distributionPoint)
+			continue
+		}
+
+		result := revocationStatus{status: RevocationGood, source: revocationSourceCRL, expiresAt: crl.NextUpdate}
+		for _, entry := range crl.RevokedCertificateEntries {
+			if entry.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+				result.status = RevocationRevoked
+				result.revokedAt = entry.RevocationTime
+				break
+			}
+		}
+
+		return result
+	}
+
+	return revocationStatus{status: RevocationUnknown}
+}
+
+func postRevocationRequest(ctx context.Context, url string, request []byte) ([]byte, error) {
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(request))
+
+	if err != nil {
+		return nil, err
+	}
+
+	httpRequest.Header.Set("Content-Type", "application/ocsp-request")
+	response, err := revocationClient.Do(httpRequest)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return readRevocationResponse(response)
+}
+
+func getRevocationList(ctx context.Context, url string) ([]byte, error) {
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := revocationClient.Do(httpRequest)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return readRevocationResponse(response)
+}
+
+func readRevocationResponse(response *http.Response) ([]byte, error) {
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, errors.New(response.Status)
+	}
+
+	return io.ReadAll(io.LimitReader(response.Body, 10<<20))
+}
+
+func getRevocationCacheKey(cert *x509.Certificate) string {
+	return getFingerprint(cert)
+}
+
+func getCachedRevocation(key string) (revocationStatus, bool) {
+	revocationCacheLock.Lock()
+	defer revocationCacheLock.Unlock()
+
+	status, ok := revocationCache[key]
+
+	if !ok || time.Now().After(status.expiresAt) {
+		delete(revocationCache, key)
+		return revocationStatus{}, false
+	}
+
+	return status, true
+}
+
+// setCachedRevocation also drops the expired statuses so certificates that
+// are no longer checked do not stay in the cache
+func setCachedRevocation(key string, status revocationStatus) {
+	now := time.Now()
+	maxExpiration := now.Add(revocationCacheDuration)
+	if status.expiresAt.IsZero() || status.expiresAt.After(maxExpiration) {
+		status.expiresAt = maxExpiration
+	}
+
+	revocationCacheLock.Lock()
+	defer revocationCacheLock.Unlock()
+
+	for cachedKey, cached := range revocationCache {
+		if now.After(cached.expiresAt) {
+			delete(revocationCache, cachedKey)
+		}
+	}
+
+	revocationCache[key] = status
+}
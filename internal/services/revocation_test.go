@@ -0,0 +1,196 @@
+package services
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jlucaspains/sharp-cert-manager/internal/models"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ocsp"
+)
+
+func createOCSPResponse(cert *x509.Certificate, issuer *x509.Certificate, issuerKey crypto.Signer, status int) []byte {
+	response, err := ocsp.CreateResponse(issuer, issuer, ocsp.Response{
+		Status:       status,
+		SerialNumber: cert.SerialNumber,
+		ThisUpdate:   time.Now().Add(-time.Hour),
+		NextUpdate:   time.Now().Add(time.Hour),
+		RevokedAt:    time.Now().Add(-time.Hour * 24),
+	}, issuerKey)
+
+	if err != nil {
+		panic(err)
+	}
+
+	return response
+}
+
+// startOCSPResponder answers every request with the given status and counts the requests received.
+func startOCSPResponder(t *testing.T, issuer *x509.Certificate, issuerKey crypto.Signer, status int, requests *atomic.Int32) string {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		request, err := ocsp.ParseRequest(body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		response, _ := ocsp.CreateResponse(issuer, issuer, ocsp.Response{
+			Status:       status,
+			SerialNumber: request.SerialNumber,
+			ThisUpdate:   time.Now().Add(-time.Hour),
+			NextUpdate:   time.Now().Add(time.Hour),
+			RevokedAt:    time.Now().Add(-time.Hour * 24),
+		}, issuerKey)
+		w.Header().Set("Content-Type", "application/ocsp-response")
+		w.Write(response)
+	}))
+	t.Cleanup(ts.Close)
+
+	return ts.URL
+}
+
+func TestRevocationNoIssuer(t *testing.T) {
+	leaf, _ := createTestCert(&x509.Certificate{Subject: pkix.Name{CommonName: "leaf"}}, nil, nil)
+
+	status := checkRevocation(context.Background(), leaf, nil, nil)
+
+	assert.Equal(t, RevocationUnknown, status.status)
+}
+
+func TestRevocationStapled(t *testing.T) {
+	issuer, issuerKey := createTestCA("issuer", nil, nil)
+	leaf, _ := createTestCert(&x509.Certificate{Subject: pkix.Name{CommonName: "leaf"}}, issuer, issuerKey)
+
+	status := checkRevocation(context.Background(), leaf, issuer, createOCSPResponse(leaf, issuer, issuerKey, ocsp.Revoked))
+
+	assert.Equal(t, RevocationRevoked, status.status)
+	assert.Equal(t, "OCSP stapling", status.source)
+	assert.False(t, status.revokedAt.IsZero())
+}
+
+func TestRevocationOCSPResponderCached(t *testing.T) {
+	issuer, issuerKey := createTestCA("issuer", nil, nil)
+	requests := &atomic.Int32{}
+	responder := startOCSPResponder(t, issuer, issuerKey, ocsp.Good, requests)
+	leaf, _ := createTestCert(&x509.Certificate{Subject: pkix.Name{CommonName: "leaf"}, OCSPServer: []string{responder}}, issuer, issuerKey)
+
+	status := checkRevocation(context.Background(), leaf, issuer, nil)
+	cachedStatus := checkRevocation(context.Background(), leaf, issuer, nil)
+
+	assert.Equal(t, RevocationGood, status.status)
+	assert.Equal(t, "OCSP responder", status.source)
+	assert.Equal(t, status, cachedStatus)
+	assert.Equal(t, int32(1), requests.Load())
+}
+
+func TestRevocationCachePrunesExpired(t *testing.T) {
+	setCachedRevocation("expired", revocationStatus{status: RevocationGood, expiresAt: time.Now().Add(-time.Minute)})
+	setCachedRevocation("current", revocationStatus{status: RevocationGood})
+
+	revocationCacheLock.Lock()
+	_, expired := revocationCache["expired"]
+	_, current := revocationCache["current"]
+	revocationCacheLock.Unlock()
+
+	assert.False(t, expired)
+	assert.True(t, current)
+}
+
+func TestRevocationCRLFallback(t *testing.T) {
+	issuer, issuerKey := createTestCA("issuer", nil, nil)
+	serial := big.NewInt(0)
+	crlServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		crl, _ := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+			Number:     big.NewInt(1),
+			ThisUpdate: time.Now().Add(-time.Hour),
+			NextUpdate: time.Now().Add(time.Hour),
+			RevokedCertificateEntries: []x509.RevocationListEntry{
+				{SerialNumber: serial, RevocationTime: time.Now().Add(-time.Hour * 24)},
+			},
+		}, issuer, issuerKey)
+		w.Write(crl)
+	}))
+	defer crlServer.Close()
+	brokenResponder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer brokenResponder.Close()
+
+	leaf, _ := createTestCert(&x509.Certificate{
+		Subject:               pkix.Name{CommonName: "leaf"},
+		OCSPServer:            []string{brokenResponder.URL},
+		CRLDistributionPoints: []string{crlServer.URL},
+	}, issuer, issuerKey)
+	serial.Set(leaf.SerialNumber)
+
+	status := checkRevocation(context.Background(), leaf, issuer, nil)
+
+	assert.Equal(t, RevocationRevoked, status.status)
+	assert.Equal(t, "CRL", status.source)
+}
+
+func TestRevocationCRLNotListed(t *testing.T) {
+	issuer, issuerKey := createTestCA("issuer", nil, nil)
+	crlServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		crl, _ := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+			Number:     big.NewInt(1),
+			ThisUpdate: time.Now().Add(-time.Hour),
+			NextUpdate: time.Now().Add(time.Hour),
+		}, issuer, issuerKey)
+		w.Write(crl)
+	}))
+	defer crlServer.Close()
+	leaf, _ := createTestCert(&x509.Certificate{Subject: pkix.Name{CommonName: "leaf"}, CRLDistributionPoints: []string{crlServer.URL}}, issuer, issuerKey)
+
+	status := checkRevocation(context.Background(), leaf, issuer, nil)
+
+	assert.Equal(t, RevocationGood, status.status)
+	assert.Equal(t, "CRL", status.source)
+}
+
+func TestGetCheckStatusRevoked(t *testing.T) {
+	root, rootKey := createTestCA("root", nil, nil)
+	intermediate, intermediateKey := createTestCA("intermediate", root, rootKey)
+	responder := startOCSPResponder(t, intermediate, intermediateKey, ocsp.Revoked, &atomic.Int32{})
+	leaf, leafKey := createTestCert(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: "localhost"},
+		DNSNames:    []string{"localhost"},
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)},
+		OCSPServer:  []string{responder},
+	}, intermediate, intermediateKey)
+	trustCerts(t, root)
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{leaf.Raw, intermediate.Raw}, PrivateKey: leafKey}}})
+	assert.Nil(t, err)
+	defer listener.Close()
+
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+
+	body, err := CheckCertStatus(context.Background(), models.CheckCertItem{Name: "localhost", Url: "https://" + listener.Addr().String(), Type: models.CertCheckURL}, 30)
+
+	assert.Nil(t, err)
+	assert.False(t, body.IsValid)
+	assert.Equal(t, RevocationRevoked, body.RevocationStatus)
+	assert.Equal(t, "OCSP responder", body.RevocationSource)
+	assert.Contains(t, body.ValidationIssues[0], "Certificate was revoked on")
+}
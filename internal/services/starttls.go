@@ -0,0 +1,236 @@
+package services
+
+import (
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strings"
+)
+
+// upgradeFunc runs the plain text part of a protocol on conn until the
+// server is ready to start the TLS handshake.
+type upgradeFunc func(conn net.Conn) error
+
+type starttlsProtocol struct {
+	defaultPort string
+	upgrade     upgradeFunc
+}
+
+var starttlsProtocols = map[string]starttlsProtocol{
+	"smtp":       {defaultPort: "25", upgrade: upgradeSMTP},
+	"imap":       {defaultPort: "143", upgrade: upgradeIMAP},
+	"pop3":       {defaultPort: "110", upgrade: upgradePOP3},
+	"ftp":        {defaultPort: "21", upgrade: upgradeFTP},
+	"ldap":       {defaultPort: "389", upgrade: upgradeLDAP},
+	"postgres":   {defaultPort: "5432", upgrade: upgradePostgres},
+	"postgresql": {defaultPort: "5432", upgrade: upgradePostgres},
+}
+
+func upgradeSMTP(conn net.Conn) error {
+	text := textproto.NewConn(conn)
+
+	if _, _, err := text.ReadResponse(220); err != nil {
+		return err
+	}
+
+	if err := text.PrintfLine("EHLO sharp-cert-manager"); err != nil {
+		return err
+	}
+
+	_, message, err := text.ReadResponse(250)
+	if err != nil {
+		return err
+	}
+
+	if !strings.Contains(strings.ToUpper(message), "STARTTLS") {
+		return errors.New("smtp server does not support STARTTLS")
+	}
+
+	if err := text.PrintfLine("STARTTLS"); err != nil {
+		return err
+	}
+
+	_, _, err = text.ReadResponse(220)
+
+	return err
+}
+
+func upgradeFTP(conn net.Conn) error {
+	text := textproto.NewConn(conn)
+
+	if _, _, err := text.ReadResponse(220); err != nil {
+		return err
+	}
+
+	if err := text.PrintfLine("AUTH TLS"); err != nil {
+		return err
+	}
+
+	_, _, err := text.ReadResponse(234)
+
+	return err
+}
+
+func upgradePOP3(conn net.Conn) error {
+	text := textproto.NewConn(conn)
+
+	if err := readPOP3Response(text); err != nil {
+		return err
+	}
+
+	if err := text.PrintfLine("STLS"); err != nil {
+		return err
+	}
+
+	return readPOP3Response(text)
+}
+
+func readPOP3Response(text *textproto.Conn) error {
+	line, err := text.ReadLine()
+	if err != nil {
+		return err
+	}
+
+	if !strings.HasPrefix(line, "+OK") {
+		return fmt.Errorf("unexpected pop3 response: %s", line)
+	}
+
+	return nil
+}
+
+func upgradeIMAP(conn net.Conn) error {
+	text := textproto.NewConn(conn)
+
+	line, err := text.ReadLine()
+	if err != nil {
+		return err
+	}
+
+	if !strings.HasPrefix(line, "* OK") {
+		return fmt.Errorf("unexpected imap greeting: %s", line)
+	}
+
+	if err := text.PrintfLine("a001 STARTTLS"); err != nil {
+		return err
+	}
+
+	// untagged responses may precede the tagged completion
+	for {
+		line, err = text.ReadLine()
+		if err != nil {
+			return err
+		}
+
+		if strings.HasPrefix(line, "a001 ") {
+			break
+		}
+	}
+
+	if !strings.HasPrefix(line, "a001 OK") {
+		return fmt.Errorf("imap server refused STARTTLS: %s", line)
+	}
+
+	return nil
+}
+
+// LDAPMessage { messageID 1, extendedReq [APPLICATION 23] { requestName [0] "1.3.6.1.4.1.1466.20037" } }
+var ldapStartTLSRequest = []byte{
+	0x30, 0x1d, 0x02, 0x01, 0x01, 0x77, 0x18, 0x80, 0x16,
+	'1', '.', '3', '.', '6', '.', '1', '.', '4', '.', '1', '.', '1', '4', '6', '6', '.', '2', '0', '0', '3', '7',
+}
+
+func upgradeLDAP(conn net.Conn) error {
+	if _, err := conn.Write(ldapStartTLSRequest); err != nil {
+		return err
+	}
+
+	var message asn1.RawValue
+	if _, err := asn1.Unmarshal(readBERElement(conn), &message); err != nil {
+		return fmt.Errorf("invalid ldap response: %w", err)
+	}
+
+	var messageID int
+	rest, err := asn1.Unmarshal(message.Bytes, &messageID)
+	if err != nil {
+		return fmt.Errorf("invalid ldap response: %w", err)
+	}
+
+	var response asn1.RawValue
+	if _, err := asn1.Unmarshal(rest, &response); err != nil {
+		return fmt.Errorf("invalid ldap response: %w", err)
+	}
+
+	// extendedResp is [APPLICATION 24] and starts with the resultCode enum
+	if response.Class != asn1.ClassApplication || response.Tag != 24 || len(response.Bytes) < 3 || response.Bytes[0] != 0x0a {
+		return errors.New("unexpected ldap response to StartTLS")
+	}
+
+	if resultCode := response.Bytes[2]; resultCode != 0 {
+		return fmt.Errorf("ldap server refused StartTLS with result code %d", resultCode)
+	}
+
+	return nil
+}
+
+// readBERElement reads a single BER encoded element from r without reading
+// past its end so the TLS handshake can follow on the same connection.
+func readBERElement(r io.Reader) []byte {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil
+	}
+
+	length := int(header[1])
+	if length&0x80 != 0 {
+		lengthBytes := make([]byte, length&0x7f)
+		if len(lengthBytes) > 4 {
+			return nil
+		}
+		if _, err := io.ReadFull(r, lengthBytes); err != nil {
+			return nil
+		}
+		header = append(header, lengthBytes...)
+		length = 0
+		for _, b := range lengthBytes {
+			length = length<<8 | int(b)
+		}
+	}
+
+	if length > 1<<16 {
+		return nil
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil
+	}
+
+	return append(header, body...)
+}
+
+const postgresSSLRequestCode = 80877103
+
+func upgradePostgres(conn net.Conn) error {
+	request := make([]byte, 8)
+	binary.BigEndian.PutUint32(request[0:4], 8)
+	binary.BigEndian.PutUint32(request[4:8], postgresSSLRequestCode)
+
+	if _, err := conn.Write(request); err != nil {
+		return err
+	}
+
+	response := make([]byte, 1)
+	if _, err := io.ReadFull(conn, response); err != nil {
+		return err
+	}
+
+	if response[0] != 'S' {
+		return errors.New("postgres server does not support SSL")
+	}
+
+	return nil
+}
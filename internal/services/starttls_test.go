@@ -0,0 +1,207 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/jlucaspains/sharp-cert-manager/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// startFakeServer accepts a single connection, runs the plain text part of a
+// protocol via negotiate and then completes a TLS handshake on the same conn.
+func startFakeServer(t *testing.T, negotiate func(conn net.Conn, reader *bufio.Reader) bool) string {
+	trustTestRoot(t)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	config := &tls.Config{Certificates: []tls.Certificate{createTLSCertificate("localhost")}}
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		if !negotiate(conn, bufio.NewReader(conn)) {
+			return
+		}
+
+		tls.Server(conn, config).Handshake()
+	}()
+
+	return listener.Addr().String()
+}
+
+func expectLine(reader *bufio.Reader, expected string) bool {
+	line, err := reader.ReadString('\n')
+	return err == nil && strings.TrimRight(line, "\r\n") == expected
+}
+
+func checkStartTLS(scheme string, address string) (*models.CertCheckResult, error) {
+	url := fmt.Sprintf("%s://%s", scheme, address)
+	return CheckCertStatus(context.Background(), models.CheckCertItem{Name: "localhost", Url: url, Type: models.CertCheckURL}, 30)
+}
+
+func TestStartTLSSMTP(t *testing.T) {
+	address := startFakeServer(t, func(conn net.Conn, reader *bufio.Reader) bool {
+		fmt.Fprint(conn, "220 fake ESMTP\r\n")
+		if !expectLine(reader, "EHLO sharp-cert-manager") {
+			return false
+		}
+		fmt.Fprint(conn, "250-fake\r\n250-PIPELINING\r\n250 STARTTLS\r\n")
+		if !expectLine(reader, "STARTTLS") {
+			return false
+		}
+		fmt.Fprint(conn, "220 Ready to start TLS\r\n")
+		return true
+	})
+
+	body, err := checkStartTLS("smtp", address)
+
+	assert.Nil(t, err)
+	assert.True(t, body.IsValid)
+	assert.Contains(t, body.CertDnsNames, "localhost")
+}
+
+func TestStartTLSSMTPNotSupported(t *testing.T) {
+	address := startFakeServer(t, func(conn net.Conn, reader *bufio.Reader) bool {
+		fmt.Fprint(conn, "220 fake ESMTP\r\n")
+		expectLine(reader, "EHLO sharp-cert-manager")
+		fmt.Fprint(conn, "250-fake\r\n250 PIPELINING\r\n")
+		return false
+	})
+
+	body, err := checkStartTLS("smtp", address)
+
+	assert.Equal(t, "smtp server does not support STARTTLS", err.Error())
+	assert.False(t, body.IsValid)
+}
+
+func TestStartTLSIMAP(t *testing.T) {
+	address := startFakeServer(t, func(conn net.Conn, reader *bufio.Reader) bool {
+		fmt.Fprint(conn, "* OK IMAP4rev1 ready\r\n")
+		if !expectLine(reader, "a001 STARTTLS") {
+			return false
+		}
+		fmt.Fprint(conn, "* CAPABILITY IMAP4rev1\r\na001 OK Begin TLS negotiation now\r\n")
+		return true
+	})
+
+	body, err := checkStartTLS("imap", address)
+
+	assert.Nil(t, err)
+	assert.True(t, body.IsValid)
+}
+
+func TestStartTLSIMAPRefused(t *testing.T) {
+	address := startFakeServer(t, func(conn net.Conn, reader *bufio.Reader) bool {
+		fmt.Fprint(conn, "* OK IMAP4rev1 ready\r\n")
+		expectLine(reader, "a001 STARTTLS")
+		fmt.Fprint(conn, "a001 BAD STARTTLS not available\r\n")
+		return false
+	})
+
+	_, err := checkStartTLS("imap", address)
+
+	assert.Equal(t, "imap server refused STARTTLS: a001 BAD STARTTLS not available", err.Error())
+}
+
+func TestStartTLSPOP3(t *testing.T) {
+	address := startFakeServer(t, func(conn net.Conn, reader *bufio.Reader) bool {
+		fmt.Fprint(conn, "+OK POP3 ready\r\n")
+		if !expectLine(reader, "STLS") {
+			return false
+		}
+		fmt.Fprint(conn, "+OK Begin TLS negotiation\r\n")
+		return true
+	})
+
+	body, err := checkStartTLS("pop3", address)
+
+	assert.Nil(t, err)
+	assert.True(t, body.IsValid)
+}
+
+func TestStartTLSFTP(t *testing.T) {
+	address := startFakeServer(t, func(conn net.Conn, reader *bufio.Reader) bool {
+		fmt.Fprint(conn, "220-Welcome\r\n220 fake FTP\r\n")
+		if !expectLine(reader, "AUTH TLS") {
+			return false
+		}
+		fmt.Fprint(conn, "234 Proceed with negotiation\r\n")
+		return true
+	})
+
+	body, err := checkStartTLS("ftp", address)
+
+	assert.Nil(t, err)
+	assert.True(t, body.IsValid)
+}
+
+func TestStartTLSLDAP(t *testing.T) {
+	address := startFakeServer(t, func(conn net.Conn, reader *bufio.Reader) bool {
+		request := make([]byte, len(ldapStartTLSRequest))
+		if _, err := io.ReadFull(reader, request); err != nil || string(request) != string(ldapStartTLSRequest) {
+			return false
+		}
+		// LDAPMessage { messageID 1, extendedResp { success, "", "" } }
+		conn.Write([]byte{0x30, 0x0c, 0x02, 0x01, 0x01, 0x78, 0x07, 0x0a, 0x01, 0x00, 0x04, 0x00, 0x04, 0x00})
+		return true
+	})
+
+	body, err := checkStartTLS("ldap", address)
+
+	assert.Nil(t, err)
+	assert.True(t, body.IsValid)
+}
+
+func TestStartTLSLDAPRefused(t *testing.T) {
+	address := startFakeServer(t, func(conn net.Conn, reader *bufio.Reader) bool {
+		io.ReadFull(reader, make([]byte, len(ldapStartTLSRequest)))
+		// LDAPMessage { messageID 1, extendedResp { protocolError, "", "" } }
+		conn.Write([]byte{0x30, 0x0c, 0x02, 0x01, 0x01, 0x78, 0x07, 0x0a, 0x01, 0x02, 0x04, 0x00, 0x04, 0x00})
+		return false
+	})
+
+	_, err := checkStartTLS("ldap", address)
+
+	assert.Equal(t, "ldap server refused StartTLS with result code 2", err.Error())
+}
+
+func TestStartTLSPostgres(t *testing.T) {
+	address := startFakeServer(t, func(conn net.Conn, reader *bufio.Reader) bool {
+		request := make([]byte, 8)
+		if _, err := io.ReadFull(reader, request); err != nil || binary.BigEndian.Uint32(request[4:]) != postgresSSLRequestCode {
+			return false
+		}
+		conn.Write([]byte{'S'})
+		return true
+	})
+
+	body, err := checkStartTLS("postgres", address)
+
+	assert.Nil(t, err)
+	assert.True(t, body.IsValid)
+}
+
+func TestStartTLSPostgresNotSupported(t *testing.T) {
+	address := startFakeServer(t, func(conn net.Conn, reader *bufio.Reader) bool {
+		io.ReadFull(reader, make([]byte, 8))
+		conn.Write([]byte{'N'})
+		return false
+	})
+
+	_, err := checkStartTLS("postgresql", address)
+
+	assert.Equal(t, "postgres server does not support SSL", err.Error())
+}
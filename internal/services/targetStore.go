@@ -0,0 +1,97 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/jlucaspains/sharp-cert-manager/internal/models"
+)
+
+// TargetStore persists the targets added at runtime through the API as a
+// JSON file. Targets from the environment or CONFIG_FILE are not stored here.
+type TargetStore struct {
+	path    string
+	targets []models.CheckCertItem
+	lock    sync.RWMutex
+}
+
+func NewTargetStore(path string) (*TargetStore, error) {
+	store := &TargetStore{path: path, targets: []models.CheckCertItem{}}
+	content, err := os.ReadFile(path)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(content, &store.targets); err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+func (s *TargetStore) List() []models.CheckCertItem {
+	if s == nil {
+		return []models.CheckCertItem{}
+	}
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return slices.Clone(s.targets)
+}
+
+func (s *TargetStore) Contains(name string) bool {
+	return slices.ContainsFunc(s.List(), func(c models.CheckCertItem) bool { return c.Name == name })
+}
+
+// Save replaces the stored targets and writes them to disk
+func (s *TargetStore) Save(targets []models.CheckCertItem) error {
+	content, err := json.MarshalIndent(targets, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err := writeFileAtomic(s.path, content); err != nil {
+		return err
+	}
+
+	s.targets = slices.Clone(targets)
+
+	return nil
+}
+
+// writeFileAtomic replaces the file through a rename so a crash never leaves
+// it half written
+func writeFileAtomic(path string, content []byte) error {
+	tempFile, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tempFile.Name())
+
+	if _, err := tempFile.Write(content); err != nil {
+		tempFile.Close()
+		return err
+	}
+
+	if err := tempFile.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tempFile.Name(), path)
+}
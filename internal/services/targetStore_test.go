@@ -0,0 +1,50 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jlucaspains/sharp-cert-manager/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTargetStoreMissingFile(t *testing.T) {
+	store, err := NewTargetStore(filepath.Join(t.TempDir(), "targets.json"))
+
+	assert.Nil(t, err)
+	assert.Empty(t, store.List())
+}
+
+func TestTargetStoreSaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "targets.json")
+	store, _ := NewTargetStore(path)
+
+	err := store.Save([]models.CheckCertItem{{Name: "blog", Url: "https://blog.lpains.net", Type: models.CertCheckURL, Tags: []string{"public"}}})
+	assert.Nil(t, err)
+
+	loaded, err := NewTargetStore(path)
+
+	assert.Nil(t, err)
+	assert.Equal(t, store.List(), loaded.List())
+	assert.True(t, loaded.Contains("blog"))
+	assert.False(t, loaded.Contains("mail"))
+}
+
+func TestTargetStoreInvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "targets.json")
+	os.WriteFile(path, []byte("not json"), 0644)
+
+	_, err := NewTargetStore(path)
+
+	assert.NotNil(t, err)
+}
+
+func TestTargetStoreSaveFailureKeepsTargets(t *testing.T) {
+	store, _ := NewTargetStore(filepath.Join(t.TempDir(), "missing", "targets.json"))
+
+	err := store.Save([]models.CheckCertItem{{Name: "blog"}})
+
+	assert.NotNil(t, err)
+	assert.Empty(t, store.List())
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/jlucaspains/sharp-cert-manager/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// startBlackHoleServer accepts connections and never answers
+func startBlackHoleServer(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { conn.Close() })
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+func useCheckTimeout(t *testing.T, timeout time.Duration) {
+	SetCheckTimeout(timeout)
+	t.Cleanup(func() { SetCheckTimeout(0) })
+}
+
+func TestCheckCertStatusHandshakeTimeout(t *testing.T) {
+	useCheckTimeout(t, 200*time.Millisecond)
+	address := startBlackHoleServer(t)
+
+	start := time.Now()
+	body, err := CheckCertStatus(context.Background(), models.CheckCertItem{Name: "localhost", Url: "https://" + address, Type: models.CertCheckURL}, 30)
+
+	assert.NotNil(t, err)
+	assert.False(t, body.IsValid)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
+func TestCheckCertStatusStartTLSTimeout(t *testing.T) {
+	useCheckTimeout(t, 200*time.Millisecond)
+	address := startBlackHoleServer(t)
+
+	start := time.Now()
+	_, err := CheckCertStatus(context.Background(), models.CheckCertItem{Name: "localhost", Url: "smtp://" + address, Type: models.CertCheckURL}, 30)
+
+	assert.NotNil(t, err)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
+func TestCheckCertStatusCanceled(t *testing.T) {
+	address := startBlackHoleServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := CheckCertStatus(ctx, models.CheckCertItem{Name: "localhost", Url: "imap://" + address, Type: models.CertCheckURL}, 30)
+
+	assert.NotNil(t, err)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
+func TestSetCheckTimeoutDefault(t *testing.T) {
+	SetCheckTimeout(-1)
+
+	assert.Equal(t, defaultCheckTimeout, getCheckTimeout())
+}
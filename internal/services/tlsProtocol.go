@@ -0,0 +1,77 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"slices"
+	"sync/atomic"
+
+	"github.com/jlucaspains/sharp-cert-manager/internal/models"
+)
+
+var tlsVersions = []uint16{tls.VersionTLS10, tls.VersionTLS11, tls.VersionTLS12, tls.VersionTLS13}
+
+var deprecatedTLSVersions = []uint16{tls.VersionTLS10, tls.VersionTLS11}
+
+var tlsVersionSweep atomic.Bool
+
+// SetTLSVersionSweep enables an extra handshake per TLS protocol version on
+// every URL check to report which versions the server accepts.
+func SetTLSVersionSweep(enabled bool) {
+	tlsVersionSweep.Store(enabled)
+}
+
+func getAllCipherSuites() []uint16 {
+	result := []uint16{}
+	for _, suite := range tls.CipherSuites() {
+		result = append(result, suite.ID)
+	}
+	for _, suite := range tls.InsecureCipherSuites() {
+		result = append(result, suite.ID)
+	}
+
+	return result
+}
+
+func isWeakCipherSuite(id uint16) bool {
+	return slices.ContainsFunc(tls.InsecureCipherSuites(), func(suite *tls.CipherSuite) bool { return suite.ID == id })
+}
+
+func sweepTLSVersions(ctx context.Context, address string, serverName string, upgrade upgradeFunc) []string {
+	result := []string{}
+	for _, version := range tlsVersions {
+		if _, err := probeTLS(ctx, address, serverName, upgrade, version); err == nil {
+			result = append(result, tls.VersionName(version))
+		}
+	}
+
+	return result
+}
+
+func applyConnectionState(result *models.CertCheckResult, state *tls.ConnectionState, supportedVersions []string) {
+	result.TLSVersion = tls.VersionName(state.Version)
+	result.CipherSuite = tls.CipherSuiteName(state.CipherSuite)
+	result.SupportedTLSVersions = supportedVersions
+
+	issues := []string{}
+	if slices.Contains(deprecatedTLSVersions, state.Version) {
+		issues = append(issues, fmt.Sprintf("%s is a deprecated protocol", result.TLSVersion))
+	}
+
+	for _, version := range deprecatedTLSVersions {
+		name := tls.VersionName(version)
+		if version != state.Version && slices.Contains(supportedVersions, name) {
+			issues = append(issues, fmt.Sprintf("Server accepts deprecated protocol %s", name))
+		}
+	}
+
+	if isWeakCipherSuite(state.CipherSuite) {
+		issues = append(issues, fmt.Sprintf("%s is a weak cipher suite", result.CipherSuite))
+	}
+
+	if len(issues) > 0 {
+		result.IsValid = false
+		result.ValidationIssues = append(result.ValidationIssues, issues...)
+	}
+}
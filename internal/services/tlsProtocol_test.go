@@ -0,0 +1,83 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"testing"
+
+	"github.com/jlucaspains/sharp-cert-manager/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// startTLSServer completes the handshake for every connection until the test ends.
+func startTLSServer(t *testing.T, config *tls.Config) string {
+	trustTestRoot(t)
+	config.Certificates = []tls.Certificate{createTLSCertificate("localhost")}
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	assert.Nil(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+
+	return "https://" + listener.Addr().String()
+}
+
+func TestConnectionStateTLS13(t *testing.T) {
+	url := startTLSServer(t, &tls.Config{})
+
+	body, err := CheckCertStatus(context.Background(), models.CheckCertItem{Name: "localhost", Url: url, Type: models.CertCheckURL}, 30)
+
+	assert.Nil(t, err)
+	assert.True(t, body.IsValid)
+	assert.Equal(t, "TLS 1.3", body.TLSVersion)
+	assert.Contains(t, body.CipherSuite, "TLS_")
+	assert.Empty(t, body.SupportedTLSVersions)
+}
+
+func TestConnectionStateDeprecatedProtocol(t *testing.T) {
+	url := startTLSServer(t, &tls.Config{MinVersion: tls.VersionTLS10, MaxVersion: tls.VersionTLS10})
+
+	body, err := CheckCertStatus(context.Background(), models.CheckCertItem{Name: "localhost", Url: url, Type: models.CertCheckURL}, 30)
+
+	assert.Nil(t, err)
+	assert.False(t, body.IsValid)
+	assert.Equal(t, "TLS 1.0", body.TLSVersion)
+	assert.Equal(t, []string{"TLS 1.0 is a deprecated protocol"}, body.ValidationIssues)
+}
+
+func TestConnectionStateWeakCipher(t *testing.T) {
+	url := startTLSServer(t, &tls.Config{
+		MaxVersion:   tls.VersionTLS12,
+		CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256},
+	})
+
+	body, err := CheckCertStatus(context.Background(), models.CheckCertItem{Name: "localhost", Url: url, Type: models.CertCheckURL}, 30)
+
+	assert.Nil(t, err)
+	assert.False(t, body.IsValid)
+	assert.Equal(t, "TLS 1.2", body.TLSVersion)
+	assert.Equal(t, []string{"TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256 is a weak cipher suite"}, body.ValidationIssues)
+}
+
+func TestConnectionStateVersionSweep(t *testing.T) {
+	SetTLSVersionSweep(true)
+	defer SetTLSVersionSweep(false)
+	url := startTLSServer(t, &tls.Config{MinVersion: tls.VersionTLS11, MaxVersion: tls.VersionTLS12})
+
+	body, err := CheckCertStatus(context.Background(), models.CheckCertItem{Name: "localhost", Url: url, Type: models.CertCheckURL}, 30)
+
+	assert.Nil(t, err)
+	assert.False(t, body.IsValid)
+	assert.Equal(t, "TLS 1.2", body.TLSVersion)
+	assert.Equal(t, []string{"TLS 1.1", "TLS 1.2"}, body.SupportedTLSVersions)
+	assert.Equal(t, []string{"Server accepts deprecated protocol TLS 1.1"}, body.ValidationIssues)
+}
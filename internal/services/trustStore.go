@@ -0,0 +1,141 @@
+package services
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+var rootCAs *x509.CertPool
+var rootCAsLock sync.RWMutex
+
+// SetTrustedCAFile builds the trust store used to verify certificate chains
+// from the system roots plus the PEM bundle at path. An empty path resets the
+// trust store to the system roots only.
+func SetTrustedCAFile(path string) error {
+	pool, err := x509.SystemCertPool()
+
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+
+	if path != "" {
+		pemBytes, err := os.ReadFile(path)
+
+		if err != nil {
+			return err
+		}
+
+		if !pool.AppendCertsFromPEM(pemBytes) {
+			return fmt.Errorf("no certificates found in %s", path)
+		}
+	}
+
+	rootCAsLock.Lock()
+	defer rootCAsLock.Unlock()
+	rootCAs = pool
+
+	return nil
+}
+
+func getRootCAs() *x509.CertPool {
+	rootCAsLock.RLock()
+	pool := rootCAs
+	rootCAsLock.RUnlock()
+
+	if pool == nil {
+		SetTrustedCAFile("")
+		return getRootCAs()
+	}
+
+	return pool
+}
+
+func verifyChain(cert *x509.Certificate, intermediates []*x509.Certificate) []string {
+	intermediatePool := x509.NewCertPool()
+	for _, intermediate := range intermediates {
+		intermediatePool.AddCert(intermediate)
+	}
+
+	// the leaf dates are reported by validate so verify the chain at a
+	// moment the leaf is valid to keep both issues independent
+	verifyTime := time.Now()
+	if verifyTime.After(cert.NotAfter) {
+		verifyTime = cert.NotAfter
+	} else if verifyTime.Before(cert.NotBefore) {
+		verifyTime = cert.NotBefore
+	}
+
+	_, err := cert.Verify(x509.VerifyOptions{
+		Roots:         getRootCAs(),
+		Intermediates: intermediatePool,
+		CurrentTime:   verifyTime,
+	})
+
+	if err == nil {
+		return []string{}
+	}
+
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	if errors.As(err, &unknownAuthorityErr) {
+		return []string{getUnknownAuthorityIssue(cert, intermediates)}
+	}
+
+	return []string{fmt.Sprintf("Certificate chain is not valid: %s", err)}
+}
+
+// getUnknownAuthorityIssue walks the presented chain from the leaf to find
+// out why it could not be linked to a trusted root.
+func getUnknownAuthorityIssue(cert *x509.Certificate, intermediates []*x509.Certificate) string {
+	if isSelfSigned(cert) {
+		return "Certificate is self-signed"
+	}
+
+	current := cert
+	for range intermediates {
+		parent := findIssuer(current, intermediates)
+
+		// intermediates were sent but none of them issued the leaf
+		if parent == nil && current == cert {
+			return "Certificate chain contains the wrong intermediate"
+		}
+
+		if parent == nil {
+			break
+		}
+
+		if current.CheckSignatureFrom(parent) != nil {
+			return "Certificate chain contains the wrong intermediate"
+		}
+
+		if isSelfSigned(parent) {
+			break
+		}
+
+		current = parent
+	}
+
+	if len(intermediates) == 0 {
+		return "Certificate chain is incomplete"
+	}
+
+	return "Certificate is not issued by a trusted authority"
+}
+
+func findIssuer(cert *x509.Certificate, candidates []*x509.Certificate) *x509.Certificate {
+	for _, candidate := range candidates {
+		if candidate != cert && bytes.Equal(candidate.RawSubject, cert.RawIssuer) {
+			return candidate
+		}
+	}
+
+	return nil
+}
+
+func isSelfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawSubject, cert.RawIssuer) && cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) == nil
+}
@@ -0,0 +1,205 @@
+package services
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jlucaspains/sharp-cert-manager/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+var testRoot *x509.Certificate
+var testRootKey crypto.Signer
+var testRootOnce sync.Once
+
+// createTestCert signs template with parent. A nil parent self-signs it.
+func createTestCert(template *x509.Certificate, parent *x509.Certificate, parentKey crypto.Signer) (*x509.Certificate, crypto.Signer) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		panic(err)
+	}
+
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template.SerialNumber = serial
+	if template.NotBefore.IsZero() {
+		template.NotBefore = time.Now().Add(-time.Hour * 24)
+	}
+	if template.NotAfter.IsZero() {
+		template.NotAfter = time.Now().Add(time.Hour * 24 * 60)
+	}
+
+	if parent == nil {
+		parent = template
+		parentKey = key
+	}
+
+	derBytes, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+
+	if err != nil {
+		panic(err)
+	}
+
+	cert, _ := x509.ParseCertificate(derBytes)
+
+	return cert, key
+}
+
+func createTestCA(name string, parent *x509.Certificate, parentKey crypto.Signer) (*x509.Certificate, crypto.Signer) {
+	return createTestCert(&x509.Certificate{
+		Subject:               pkix.Name{CommonName: name},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}, parent, parentKey)
+}
+
+func getTestRoot() (*x509.Certificate, crypto.Signer) {
+	testRootOnce.Do(func() {
+		testRoot, testRootKey = createTestCA("sharp-cert-manager test root", nil, nil)
+	})
+
+	return testRoot, testRootKey
+}
+
+// trustTestRoot adds the shared test root to the trust store for the duration of the test.
+func trustTestRoot(t *testing.T) {
+	root, _ := getTestRoot()
+	trustCerts(t, root)
+}
+
+func trustCerts(t *testing.T, certs ...*x509.Certificate) {
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	pemBytes := []byte{}
+	for _, cert := range certs {
+		pemBytes = append(pemBytes, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+	os.WriteFile(path, pemBytes, 0644)
+
+	assert.Nil(t, SetTrustedCAFile(path))
+	t.Cleanup(func() { SetTrustedCAFile("") })
+}
+
+func TestSetTrustedCAFileMissing(t *testing.T) {
+	err := SetTrustedCAFile(filepath.Join(t.TempDir(), "missing.pem"))
+
+	assert.NotNil(t, err)
+}
+
+func TestSetTrustedCAFileNoCerts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "empty.pem")
+	os.WriteFile(path, []byte("not a certificate"), 0644)
+
+	err := SetTrustedCAFile(path)
+
+	assert.Equal(t, "no certificates found in "+path, err.Error())
+}
+
+func TestVerifyChainTrusted(t *testing.T) {
+	root, rootKey := createTestCA("root", nil, nil)
+	intermediate, intermediateKey := createTestCA("intermediate", root, rootKey)
+	leaf, _ := createTestCert(&x509.Certificate{Subject: pkix.Name{CommonName: "leaf"}}, intermediate, intermediateKey)
+	trustCerts(t, root)
+
+	assert.Empty(t, verifyChain(leaf, []*x509.Certificate{intermediate}))
+}
+
+func TestVerifyChainSelfSigned(t *testing.T) {
+	leaf, _ := createTestCert(&x509.Certificate{Subject: pkix.Name{CommonName: "leaf"}}, nil, nil)
+
+	assert.Equal(t, []string{"Certificate is self-signed"}, verifyChain(leaf, []*x509.Certificate{}))
+}
+
+func TestVerifyChainIncomplete(t *testing.T) {
+	root, rootKey := createTestCA("root", nil, nil)
+	intermediate, intermediateKey := createTestCA("intermediate", root, rootKey)
+	leaf, _ := createTestCert(&x509.Certificate{Subject: pkix.Name{CommonName: "leaf"}}, intermediate, intermediateKey)
+	trustCerts(t, root)
+
+	assert.Equal(t, []string{"Certificate chain is incomplete"}, verifyChain(leaf, []*x509.Certificate{}))
+}
+
+func TestVerifyChainWrongIntermediate(t *testing.T) {
+	root, rootKey := createTestCA("root", nil, nil)
+	_, intermediateKey := createTestCA("intermediate", root, rootKey)
+	otherIntermediate, _ := createTestCA("intermediate", root, rootKey)
+	template := &x509.Certificate{Subject: pkix.Name{CommonName: "intermediate"}}
+	leaf, _ := createTestCert(&x509.Certificate{Subject: pkix.Name{CommonName: "leaf"}}, template, intermediateKey)
+	trustCerts(t, root)
+
+	assert.Equal(t, []string{"Certificate chain contains the wrong intermediate"}, verifyChain(leaf, []*x509.Certificate{otherIntermediate}))
+}
+
+func TestGetCheckStatusUnrelatedIntermediate(t *testing.T) {
+	root, rootKey := createTestCA("root", nil, nil)
+	intermediate, intermediateKey := createTestCA("intermediate", root, rootKey)
+	unrelated, _ := createTestCA("unrelated intermediate", root, rootKey)
+	leaf, leafKey := createTestCert(&x509.Certificate{Subject: pkix.Name{CommonName: "localhost"}, DNSNames: []string{"localhost"}, IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)}}, intermediate, intermediateKey)
+	trustCerts(t, root)
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{leaf.Raw, unrelated.Raw}, PrivateKey: leafKey}}})
+	assert.Nil(t, err)
+	defer listener.Close()
+
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+
+	body, err := CheckCertStatus(context.Background(), models.CheckCertItem{Name: "localhost", Url: "https://" + listener.Addr().String(), Type: models.CertCheckURL}, 30)
+
+	assert.Nil(t, err)
+	assert.False(t, body.IsValid)
+	assert.Equal(t, []string{"Certificate chain contains the wrong intermediate"}, body.ValidationIssues)
+}
+
+func TestVerifyChainUntrusted(t *testing.T) {
+	root, rootKey := createTestCA("root", nil, nil)
+	intermediate, intermediateKey := createTestCA("intermediate", root, rootKey)
+	leaf, _ := createTestCert(&x509.Certificate{Subject: pkix.Name{CommonName: "leaf"}}, intermediate, intermediateKey)
+
+	assert.Equal(t, []string{"Certificate is not issued by a trusted authority"}, verifyChain(leaf, []*x509.Certificate{intermediate}))
+}
+
+func TestGetCheckStatusTrustedChain(t *testing.T) {
+	root, rootKey := createTestCA("root", nil, nil)
+	intermediate, intermediateKey := createTestCA("intermediate", root, rootKey)
+	leaf, leafKey := createTestCert(&x509.Certificate{Subject: pkix.Name{CommonName: "localhost"}, DNSNames: []string{"localhost"}, IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)}}, intermediate, intermediateKey)
+	trustCerts(t, root)
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{leaf.Raw, intermediate.Raw}, PrivateKey: leafKey}}})
+	assert.Nil(t, err)
+	defer listener.Close()
+
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+
+	body, err := CheckCertStatus(context.Background(), models.CheckCertItem{Name: "localhost", Url: "https://" + listener.Addr().String(), Type: models.CertCheckURL}, 30)
+
+	assert.Nil(t, err)
+	assert.True(t, body.IsValid)
+	assert.Empty(t, body.ValidationIssues)
+	assert.Equal(t, "intermediate", body.OtherCerts[0].CommonName)
+}